@@ -0,0 +1,229 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// The actions of the entries.
+const (
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+)
+
+const (
+	defaultMaxSize    = 10 << 20
+	defaultMaxBackups = 3
+)
+
+// Entry is a single request inside the audit log.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Principal is the name of the token or the host of a client certificate. It is empty if the authentication failed.
+	Principal  string `json:"principal"`
+	Action     string `json:"action"`
+	Route      string `json:"route"`
+	Hostname   string `json:"hostname,omitempty"`
+	Status     int    `json:"status"`
+	RemoteAddr string `json:"remoteAddr"`
+	RequestID  string `json:"requestID,omitempty"`
+}
+
+// Filter selects the entries of a query. Empty fields match every entry.
+type Filter struct {
+	Principal string
+	Action    string
+	Hostname  string
+	Since     time.Time
+}
+
+// Matches checks if the entry matches all fields of the filter.
+func (f Filter) Matches(entry Entry) bool {
+	if f.Principal != "" && entry.Principal != f.Principal {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.Hostname != "" && entry.Hostname != f.Hostname {
+		return false
+	}
+	return f.Since.IsZero() || !entry.Time.Before(f.Since)
+}
+
+// NewLog opens or creates the audit log file at the path.
+// New entries get appended to the existing ones.
+func NewLog(path string) (*Log, error) {
+	l := &Log{path: path, maxSize: defaultMaxSize, maxBackups: defaultMaxBackups}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Log writes the entries as JSON lines into a file.
+// The file gets rotated to 'path.1', 'path.2' and so on when it would get bigger than the max size.
+type Log struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+	m          sync.Mutex
+}
+
+// WithMaxSize sets the size in bytes after which the file gets rotated.
+// Returns the Log.
+func (l *Log) WithMaxSize(maxSize int64) *Log {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.maxSize = maxSize
+	return l
+}
+
+// WithMaxBackups sets how many rotated files are kept.
+// Returns the Log.
+func (l *Log) WithMaxBackups(maxBackups int) *Log {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	l.maxBackups = maxBackups
+	return l
+}
+
+func (l *Log) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("audit: Could not open the log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("audit: Could not read the size of the log file: %w", err)
+	}
+
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+// Record appends the entry to the log.
+func (l *Log) Record(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("audit: Could not encode the entry: %w", err)
+	}
+	line = append(line, '\n')
+
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("audit: Could not write the entry: %w", err)
+	}
+	return nil
+}
+
+// rotate moves every file one number up, drops the oldest one and opens a new file.
+// The caller has to hold the lock.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("audit: Could not close the log file: %w", err)
+	}
+
+	if err := os.Remove(l.backupPath(l.maxBackups)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("audit: Could not remove the oldest log file: %w", err)
+	}
+	for i := l.maxBackups; i > 0; i-- {
+		if err := os.Rename(l.backupPath(i-1), l.backupPath(i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("audit: Could not rotate the log file: %w", err)
+		}
+	}
+
+	return l.open()
+}
+
+// backupPath returns the path of the rotated file with the number. Zero is the current file.
+func (l *Log) backupPath(i int) string {
+	if i == 0 {
+		return l.path
+	}
+	return fmt.Sprintf("%s.%d", l.path, i)
+}
+
+// Query returns the entries matching the filter with the newest first.
+// Entries of the rotated files are included.
+func (l *Log) Query(filter Filter, skip, limit int) ([]Entry, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	entries := make([]Entry, 0, limit)
+	for i := 0; i <= l.maxBackups && len(entries) < limit; i++ {
+		fileEntries, err := readEntries(l.backupPath(i))
+		if err != nil {
+			return []Entry{}, err
+		}
+
+		for j := len(fileEntries) - 1; j >= 0 && len(entries) < limit; j-- {
+			if !filter.Matches(fileEntries[j]) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			entries = append(entries, fileEntries[j])
+		}
+	}
+	return entries, nil
+}
+
+// readEntries reads all entries of a file in the order they got written.
+// A missing file has no entries.
+func readEntries(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []Entry{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("audit: Could not open the log file: %w", err)
+	}
+	defer file.Close()
+
+	entries := make([]Entry, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("audit: Could not decode an entry of '%s': %w", path, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("audit: Could not read the log file: %w", err)
+	}
+	return entries, nil
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	return l.file.Close()
+}
@@ -0,0 +1,82 @@
+package audit_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/stretchr/testify/require"
+)
+
+func newLog(t *testing.T) (*audit.Log, string) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := audit.NewLog(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	return l, path
+}
+
+func TestLog(t *testing.T) {
+	t.Run("should return the entries with the newest first", func(t *testing.T) {
+		l, _ := newLog(t)
+		for i := 0; i < 3; i++ {
+			require.NoError(t, l.Record(audit.Entry{Route: fmt.Sprint(i)}))
+		}
+
+		got, err := l.Query(audit.Filter{}, 1, 10)
+
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+		require.Equal(t, "1", got[0].Route)
+		require.Equal(t, "0", got[1].Route)
+	})
+
+	t.Run("should only return matching entries", func(t *testing.T) {
+		l, _ := newLog(t)
+		now := time.Now()
+		require.NoError(t, l.Record(audit.Entry{Time: now, Principal: "agents", Action: audit.ActionWrite, Hostname: "foo"}))
+		require.NoError(t, l.Record(audit.Entry{Time: now, Principal: "ops", Action: audit.ActionDelete, Hostname: "foo"}))
+		require.NoError(t, l.Record(audit.Entry{Time: now.Add(-time.Hour), Principal: "ops", Action: audit.ActionDelete, Hostname: "bar"}))
+
+		got, err := l.Query(audit.Filter{Principal: "ops", Since: now.Add(-time.Minute)}, 0, 10)
+
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, "foo", got[0].Hostname)
+		require.Equal(t, audit.ActionDelete, got[0].Action)
+	})
+
+	t.Run("should keep the entries after reopening", func(t *testing.T) {
+		l, path := newLog(t)
+		require.NoError(t, l.Record(audit.Entry{Route: "PostStats"}))
+		require.NoError(t, l.Close())
+
+		reopened, err := audit.NewLog(path)
+		require.NoError(t, err)
+		defer reopened.Close()
+		got, err := reopened.Query(audit.Filter{}, 0, 10)
+
+		require.NoError(t, err)
+		require.Equal(t, []audit.Entry{{Route: "PostStats"}}, got)
+	})
+
+	t.Run("should rotate the file and drop the oldest one", func(t *testing.T) {
+		l, path := newLog(t)
+		l.WithMaxSize(1).WithMaxBackups(2)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, l.Record(audit.Entry{Route: fmt.Sprint(i)}))
+		}
+
+		got, err := l.Query(audit.Filter{}, 0, 10)
+
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		require.Equal(t, "4", got[0].Route)
+		require.Equal(t, "2", got[2].Route)
+		_, err = os.Stat(path + ".3")
+		require.True(t, os.IsNotExist(err))
+	})
+}
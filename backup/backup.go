@@ -0,0 +1,133 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+)
+
+// Version of the backup format.
+const Version = 1
+
+const (
+	manifestFile = "manifest.json"
+	eventsFile   = "events.json"
+	hostsDir     = "hosts/"
+)
+
+var (
+	// ErrMissingManifest if the archive has no manifest and is therefore no backup.
+	ErrMissingManifest = errors.New("backup: Missing the manifest")
+	// ErrUnsupportedVersion if the backup was written with an unknown format version.
+	ErrUnsupportedVersion = errors.New("backup: Unsupported backup version")
+)
+
+// Manifest describes the backup.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Hosts   int       `json:"hosts"`
+	Events  int       `json:"events"`
+}
+
+// Write the snapshot as gzip compressed tar archive.
+// The archive contains a manifest, one JSON file per host and one file with all events.
+func Write(w io.Writer, snapshot db.Snapshot) error {
+	gzipWriter := gzip.NewWriter(w)
+	tarWriter := tar.NewWriter(gzipWriter)
+	created := time.Now()
+
+	manifest := Manifest{Version: Version, Created: created, Hosts: len(snapshot.Hosts), Events: len(snapshot.Events)}
+	if err := writeJSON(tarWriter, manifestFile, created, manifest); err != nil {
+		return err
+	}
+	for _, host := range snapshot.Hosts {
+		name := hostsDir + url.PathEscape(host.HostInfo.Hostname) + ".json"
+		if err := writeJSON(tarWriter, name, created, host); err != nil {
+			return err
+		}
+	}
+	if err := writeJSON(tarWriter, eventsFile, created, snapshot.Events); err != nil {
+		return err
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	return gzipWriter.Close()
+}
+
+func writeJSON(tarWriter *tar.Writer, name string, modTime time.Time, value interface{}) error {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("backup: Could not encode '%s': %w", name, err)
+	}
+
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), ModTime: modTime}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = tarWriter.Write(content)
+	return err
+}
+
+// Read a backup written by Write.
+// Returns ErrMissingManifest or ErrUnsupportedVersion if the archive is no readable backup.
+func Read(r io.Reader) (db.Snapshot, error) {
+	gzipReader, err := gzip.NewReader(r)
+	if err != nil {
+		return db.Snapshot{}, fmt.Errorf("backup: Could not decompress the backup: %w", err)
+	}
+	defer gzipReader.Close()
+
+	var manifest *Manifest
+	snapshot := db.Snapshot{Hosts: []db.Host{}, Events: []db.Event{}}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return db.Snapshot{}, fmt.Errorf("backup: Could not read the archive: %w", err)
+		}
+
+		content, err := ioutil.ReadAll(tarReader)
+		if err != nil {
+			return db.Snapshot{}, err
+		}
+
+		switch name := path.Clean(header.Name); {
+		case name == manifestFile:
+			manifest = &Manifest{}
+			err = json.Unmarshal(content, manifest)
+		case name == eventsFile:
+			err = json.Unmarshal(content, &snapshot.Events)
+		case strings.HasPrefix(name, hostsDir):
+			var host db.Host
+			err = json.Unmarshal(content, &host)
+			snapshot.Hosts = append(snapshot.Hosts, host)
+		}
+		if err != nil {
+			return db.Snapshot{}, fmt.Errorf("backup: Could not decode '%s': %w", header.Name, err)
+		}
+	}
+
+	if manifest == nil {
+		return db.Snapshot{}, ErrMissingManifest
+	}
+	if manifest.Version != Version {
+		return db.Snapshot{}, fmt.Errorf("%w: %d", ErrUnsupportedVersion, manifest.Version)
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,51 @@
+package backup_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/backup"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAndRead(t *testing.T) {
+	t.Run("should read the written snapshot", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		snapshot := db.Snapshot{
+			Hosts: []db.Host{
+				{HostInfo: db.HostInfo{Hostname: "foo", DataPoints: 1, LastInsert: date}, Stats: []db.Stats{{Hostname: "foo", Date: date, CPU: 1}}},
+				{HostInfo: db.HostInfo{Hostname: "bar/baz"}, Stats: []db.Stats{}},
+			},
+			Events: []db.Event{{ID: 1, Date: date, Title: "deploy", Tags: []string{"web"}}},
+		}
+
+		var buf bytes.Buffer
+		require.NoError(t, backup.Write(&buf, snapshot))
+
+		got, err := backup.Read(&buf)
+		require.NoError(t, err)
+		require.Equal(t, snapshot, got)
+	})
+
+	t.Run("should return error on an archive without manifest", func(t *testing.T) {
+		var buf bytes.Buffer
+		gzipWriter := gzip.NewWriter(&buf)
+		require.NoError(t, tar.NewWriter(gzipWriter).Close())
+		require.NoError(t, gzipWriter.Close())
+
+		_, err := backup.Read(&buf)
+
+		require.True(t, errors.Is(err, backup.ErrMissingManifest))
+	})
+
+	t.Run("should return error if it is not compressed", func(t *testing.T) {
+		_, err := backup.Read(bytes.NewBufferString("foo"))
+
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// ErrNoToken if no token for the authentication is configured.
+	ErrNoToken = errors.New("config: At least one token is required")
+	// ErrInvalidPort if the port is out of range.
+	ErrInvalidPort = errors.New("config: The port has to be between 0 and 65535")
+	// ErrUnknownDBBackend if the configured db backend does not exist.
+	ErrUnknownDBBackend = errors.New("config: Unknown db backend")
+	// ErrNegativeRetention if the retention is negative.
+	ErrNegativeRetention = errors.New("config: The retention can not be negative")
+	// ErrIncompleteTLS if only the TLS certificate or only the key is configured.
+	ErrIncompleteTLS = errors.New("config: TLS needs a certificate and a key")
+	// ErrClientCAWithoutTLS if client certificates should be verified without serving HTTPS.
+	ErrClientCAWithoutTLS = errors.New("config: A client CA needs TLS to be enabled")
+	// ErrInvalidMaxSkew if the allowed clock skew of signatures is not positive.
+	ErrInvalidMaxSkew = errors.New("config: The max skew of signatures has to be positive")
+	// ErrUnknownRateLimitKey if clients should be identified by something unknown.
+	ErrUnknownRateLimitKey = errors.New("config: Unknown rate limit key")
+	// ErrInvalidRateLimit if a limit is negative or allows no request at all.
+	ErrInvalidRateLimit = errors.New("config: A rate limit needs a positive rate and a burst of at least one")
+	// ErrUnknownNamedToken if a name is given to a token that is not configured.
+	ErrUnknownNamedToken = errors.New("config: The named token is neither a token nor an admin token")
+	// ErrInvalidAuditRotation if the audit log would be rotated without a size or with negative backups.
+	ErrInvalidAuditRotation = errors.New("config: The audit log needs a positive max size and no negative max backups")
+	// ErrUnknownAccessLogFormat if the access log should be written in an unknown format.
+	ErrUnknownAccessLogFormat = errors.New("config: Unknown access log format")
+	// ErrUnknownTracingExporter if the spans should be exported with an unknown exporter.
+	ErrUnknownTracingExporter = errors.New("config: Unknown tracing exporter")
+	// ErrInvalidSampleRatio if the sample ratio of the tracing is not between 0 and 1.
+	ErrInvalidSampleRatio = errors.New("config: The sample ratio has to be between 0 and 1")
+	// ErrInvalidMetricsListen if the address of the metrics listener has no port.
+	ErrInvalidMetricsListen = errors.New("config: The metrics listener needs an address with a port")
+	// ErrInvalidShutdownTimeout if a timeout of the shutdown is not positive.
+	ErrInvalidShutdownTimeout = errors.New("config: The timeouts of the shutdown have to be positive and its readiness delay must not be negative")
+	// ErrInvalidListen if a listen address is neither a unix socket nor a host with a port.
+	ErrInvalidListen = errors.New("config: The listen address has to be a unix:// path or a host with a port")
+	// ErrInvalidSocketMode if the permissions of the unix sockets are not octal file permissions.
+	ErrInvalidSocketMode = errors.New("config: The mode of the unix sockets has to be octal permissions like 0660")
+	// ErrMissingDBPath if a file based db backend has no path.
+	ErrMissingDBPath = errors.New("config: The db backend needs a path")
+)
+
+// Config is the configuration of gsave.
+type Config struct {
+	Port int `yaml:"port"`
+	// Listen are the addresses to serve on like ":8080" or "unix:///run/gsave.sock" instead of the port.
+	Listen      []string   `yaml:"listen"`
+	UnixSocket  UnixSocket `yaml:"unixSocket"`
+	Tokens      []string   `yaml:"tokens"`
+	AdminTokens []string   `yaml:"adminTokens"`
+	// TokenNames contains the token for every name by which its clients show up in the audit log.
+	TokenNames map[string]string `yaml:"tokenNames"`
+	DB         DB                `yaml:"db"`
+	// Retention is the duration after which stats get deleted by their date. Zero keeps them forever.
+	// Stats inserted without a date get the insert time.
+	Retention time.Duration `yaml:"retention"`
+	TLS       TLS           `yaml:"tls"`
+	Signing   Signing       `yaml:"signing"`
+	RateLimit RateLimit     `yaml:"rateLimit"`
+	Audit     Audit         `yaml:"audit"`
+	Tracing   Tracing       `yaml:"tracing"`
+	Metrics   Metrics       `yaml:"metrics"`
+	Shutdown  Shutdown      `yaml:"shutdown"`
+	Log       Log           `yaml:"log"`
+}
+
+// UnixSocket is the configuration of the unix sockets to listen on.
+type UnixSocket struct {
+	// Mode are the octal permissions of the socket files like "0660".
+	Mode string `yaml:"mode"`
+	// Group owns the socket files if it is set.
+	Group string `yaml:"group"`
+}
+
+// FileMode returns the parsed Mode.
+func (u UnixSocket) FileMode() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(u.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("%w: '%s'", ErrInvalidSocketMode, u.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// DB is the configuration of the db backend.
+type DB struct {
+	// Backend is either "memory" or "bolt".
+	Backend string `yaml:"backend"`
+	// Path is the file of the bolt backend.
+	Path string `yaml:"path"`
+}
+
+// TLS is the configuration for serving HTTPS.
+type TLS struct {
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// ClientCA enables the authentication with client certificates signed by it.
+	ClientCA string `yaml:"clientCA"`
+}
+
+// Enabled checks if HTTPS should be served.
+func (t TLS) Enabled() bool {
+	return t.Cert != ""
+}
+
+// Signing is the configuration of the HMAC signatures for posting stats.
+type Signing struct {
+	// Secret is shared with the agents. The signatures are only required if it is set.
+	Secret string `yaml:"secret"`
+	// MaxSkew is the time a signed request is valid before and after its timestamp.
+	MaxSkew time.Duration `yaml:"maxSkew"`
+}
+
+// Enabled checks if the requests need to be signed.
+func (s Signing) Enabled() bool {
+	return s.Secret != ""
+}
+
+// RateLimit is the configuration of the request limits per client.
+type RateLimit struct {
+	// Key identifies a client by its "token", its "ip" or the combination "tokenAndIP".
+	Key string `yaml:"key"`
+	// Ingest limits posting stats and events.
+	Ingest Limit `yaml:"ingest"`
+	// Read limits all other routes.
+	Read Limit `yaml:"read"`
+	// IP limits all requests of an ip independent of the key, so clients that try many tokens get throttled.
+	IP Limit `yaml:"ip"`
+}
+
+// Limit allows Burst requests at once and Rate requests per second. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (l Limit) validate() error {
+	if l.Rate < 0 || l.Burst < 0 || (l.Rate > 0 && l.Burst < 1) {
+		return fmt.Errorf("%w: rate %g, burst %d", ErrInvalidRateLimit, l.Rate, l.Burst)
+	}
+	return nil
+}
+
+// Audit is the configuration of the audit log.
+type Audit struct {
+	// Path is the file of the audit log. The audit log is disabled without it.
+	Path string `yaml:"path"`
+	// MaxSizeMB is the size in megabytes after which the file gets rotated.
+	MaxSizeMB int `yaml:"maxSizeMB"`
+	// MaxBackups is the number of rotated files that are kept.
+	MaxBackups int `yaml:"maxBackups"`
+}
+
+// Enabled checks if the requests should be recorded.
+func (a Audit) Enabled() bool {
+	return a.Path != ""
+}
+
+// Tracing is the configuration of the OpenTelemetry tracing.
+type Tracing struct {
+	// Exporter is "otlp" to send the spans with OTLP/HTTP or "stdout" to write them as JSON. Tracing is disabled without it.
+	Exporter string `yaml:"exporter"`
+	// Endpoint is the host and port of the OTLP/HTTP collector.
+	Endpoint string `yaml:"endpoint"`
+	// Insecure sends the spans to the collector without TLS.
+	Insecure bool `yaml:"insecure"`
+	// Path is a file for the stdout exporter to write the spans to instead of the standard output.
+	Path string `yaml:"path"`
+	// SampleRatio is the share of the new traces that get recorded. Traces of agents keep their decision.
+	SampleRatio float64 `yaml:"sampleRatio"`
+}
+
+// Enabled checks if the requests should be traced.
+func (t Tracing) Enabled() bool {
+	return t.Exporter != ""
+}
+
+// Metrics is the configuration of the metrics of gsave itself.
+type Metrics struct {
+	// Listen is the address of a separate listener for the metrics without authentication like "127.0.0.1:9100".
+	// The metrics are always served on '/admin/metrics' with the admin scope.
+	Listen string `yaml:"listen"`
+}
+
+// Shutdown is the configuration of the graceful shutdown.
+type Shutdown struct {
+	// ReadinessDelay is the time /readyz already fails before the server stops accepting new requests,
+	// so that load balancers can stop sending requests first.
+	ReadinessDelay time.Duration `yaml:"readinessDelay"`
+	// DrainTimeout is the time the running requests get to finish after the server stopped accepting new ones.
+	DrainTimeout time.Duration `yaml:"drainTimeout"`
+	// JobsTimeout is the time the background jobs like the retention and the interrupted requests get to stop before the db gets closed.
+	// The db is not closed if they did not stop in time.
+	JobsTimeout time.Duration `yaml:"jobsTimeout"`
+}
+
+// Log is the configuration of the logging output.
+type Log struct {
+	Level string `yaml:"level"`
+	JSON  bool   `yaml:"json"`
+	// Access enables the access log in the "common" or "combined" log format.
+	Access string `yaml:"access"`
+}
+
+// Default returns the configuration with all default values.
+func Default() Config {
+	return Config{
+		Port:       8080,
+		UnixSocket: UnixSocket{Mode: "0660"},
+		DB:         DB{Backend: "memory"},
+		Signing:    Signing{MaxSkew: 5 * time.Minute},
+		RateLimit:  RateLimit{Key: "token"},
+		Audit:      Audit{MaxSizeMB: 10, MaxBackups: 3},
+		Tracing:    Tracing{Endpoint: "localhost:4318", SampleRatio: 1},
+		Shutdown:   Shutdown{DrainTimeout: 15 * time.Second, JobsTimeout: 5 * time.Second},
+		Log:        Log{Level: log.InfoLevel.String()},
+	}
+}
+
+// Load reads the YAML config file from the path on top of the default configuration.
+// Unknown fields are treated as an error.
+func Load(path string) (Config, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("config: Could not read the file: %w", err)
+	}
+
+	cfg := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return Config{}, fmt.Errorf("config: Could not parse the file '%s': %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate checks if the configuration is usable.
+func (c Config) Validate() error {
+	if c.Port < 0 || c.Port > 65535 {
+		return ErrInvalidPort
+	}
+	for _, address := range c.Listen {
+		if err := validateListen(address); err != nil {
+			return err
+		}
+	}
+	if _, err := c.UnixSocket.FileMode(); err != nil {
+		return err
+	}
+	if len(c.Tokens) == 0 {
+		return ErrNoToken
+	}
+	for name, token := range c.TokenNames {
+		if !contains(c.Tokens, token) && !contains(c.AdminTokens, token) {
+			return fmt.Errorf("%w: '%s'", ErrUnknownNamedToken, name)
+		}
+	}
+	switch c.DB.Backend {
+	case "memory":
+	case "bolt":
+		if c.DB.Path == "" {
+			return ErrMissingDBPath
+		}
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownDBBackend, c.DB.Backend)
+	}
+	if c.Retention < 0 {
+		return ErrNegativeRetention
+	}
+	if (c.TLS.Cert == "") != (c.TLS.Key == "") {
+		return ErrIncompleteTLS
+	}
+	if c.TLS.ClientCA != "" && !c.TLS.Enabled() {
+		return ErrClientCAWithoutTLS
+	}
+	if c.Signing.MaxSkew <= 0 {
+		return ErrInvalidMaxSkew
+	}
+	switch c.RateLimit.Key {
+	case "token", "ip", "tokenAndIP":
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownRateLimitKey, c.RateLimit.Key)
+	}
+	if err := c.RateLimit.Ingest.validate(); err != nil {
+		return err
+	}
+	if err := c.RateLimit.Read.validate(); err != nil {
+		return err
+	}
+	if err := c.RateLimit.IP.validate(); err != nil {
+		return err
+	}
+	if c.Audit.MaxSizeMB <= 0 || c.Audit.MaxBackups < 0 {
+		return ErrInvalidAuditRotation
+	}
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownTracingExporter, c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return ErrInvalidSampleRatio
+	}
+	if c.Metrics.Listen != "" {
+		if _, _, err := net.SplitHostPort(c.Metrics.Listen); err != nil {
+			return fmt.Errorf("%w: '%s'", ErrInvalidMetricsListen, c.Metrics.Listen)
+		}
+	}
+	if c.Shutdown.DrainTimeout <= 0 || c.Shutdown.JobsTimeout <= 0 || c.Shutdown.ReadinessDelay < 0 {
+		return ErrInvalidShutdownTimeout
+	}
+	if _, err := log.ParseLevel(c.Log.Level); err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	switch c.Log.Access {
+	case "", "common", "combined":
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownAccessLogFormat, c.Log.Access)
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// validateListen checks if the address is a unix socket path or a TCP host with a port.
+func validateListen(address string) error {
+	if strings.HasPrefix(address, "unix://") {
+		if strings.TrimPrefix(address, "unix://") == "" {
+			return fmt.Errorf("%w: '%s'", ErrInvalidListen, address)
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(strings.TrimPrefix(address, "tcp://")); err != nil {
+		return fmt.Errorf("%w: '%s'", ErrInvalidListen, address)
+	}
+	return nil
+}
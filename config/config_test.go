@@ -0,0 +1,134 @@
+package config_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/config"
+	"github.com/stretchr/testify/require"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "gsave-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.yml")
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	t.Run("should read the file on top of the defaults", func(t *testing.T) {
+		path := writeConfig(t, `
+tokens: [foo]
+adminTokens: [bar]
+retention: 24h
+log:
+  level: debug
+`)
+
+		got, err := config.Load(path)
+		want := config.Default()
+		want.Tokens = []string{"foo"}
+		want.AdminTokens = []string{"bar"}
+		want.Retention = 24 * time.Hour
+		want.Log.Level = "debug"
+
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("should accept an empty file", func(t *testing.T) {
+		path := writeConfig(t, "")
+
+		got, err := config.Load(path)
+
+		require.NoError(t, err)
+		require.Equal(t, config.Default(), got)
+	})
+
+	t.Run("should reject unknown fields", func(t *testing.T) {
+		path := writeConfig(t, "tokenz: [foo]\n")
+
+		_, err := config.Load(path)
+
+		require.Error(t, err)
+	})
+
+	t.Run("should return error if the file does not exist", func(t *testing.T) {
+		_, err := config.Load(filepath.Join(os.TempDir(), "gsave-does-not-exist.yml"))
+
+		require.Error(t, err)
+	})
+}
+
+func TestConfig_Validate(t *testing.T) {
+	valid := func() config.Config {
+		cfg := config.Default()
+		cfg.Tokens = []string{"foo"}
+		return cfg
+	}
+
+	t.Run("should accept a valid config", func(t *testing.T) {
+		require.NoError(t, valid().Validate())
+	})
+
+	t.Run("should reject invalid configs", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			modify  func(cfg *config.Config)
+			wantErr error
+		}{
+			{"listen address without port", func(cfg *config.Config) { cfg.Listen = []string{"localhost"} }, config.ErrInvalidListen},
+			{"unix socket without path", func(cfg *config.Config) { cfg.Listen = []string{":8080", "unix://"} }, config.ErrInvalidListen},
+			{"unix socket mode not octal", func(cfg *config.Config) { cfg.UnixSocket.Mode = "rw-rw----" }, config.ErrInvalidSocketMode},
+			{"no token", func(cfg *config.Config) { cfg.Tokens = nil }, config.ErrNoToken},
+			{"port to high", func(cfg *config.Config) { cfg.Port = 70000 }, config.ErrInvalidPort},
+			{"unknown db backend", func(cfg *config.Config) { cfg.DB.Backend = "foo" }, config.ErrUnknownDBBackend},
+			{"bolt without path", func(cfg *config.Config) { cfg.DB.Backend = "bolt" }, config.ErrMissingDBPath},
+			{"negative retention", func(cfg *config.Config) { cfg.Retention = -time.Hour }, config.ErrNegativeRetention},
+			{"tls without key", func(cfg *config.Config) { cfg.TLS.Cert = "cert.pem" }, config.ErrIncompleteTLS},
+			{"client ca without tls", func(cfg *config.Config) { cfg.TLS.ClientCA = "ca.pem" }, config.ErrClientCAWithoutTLS},
+			{"no signature max skew", func(cfg *config.Config) { cfg.Signing.MaxSkew = 0 }, config.ErrInvalidMaxSkew},
+			{"unknown rate limit key", func(cfg *config.Config) { cfg.RateLimit.Key = "foo" }, config.ErrUnknownRateLimitKey},
+			{"negative rate limit", func(cfg *config.Config) { cfg.RateLimit.Read.Rate = -1 }, config.ErrInvalidRateLimit},
+			{"name of an unknown token", func(cfg *config.Config) { cfg.TokenNames = map[string]string{"ops": "bar"} }, config.ErrUnknownNamedToken},
+			{"audit log without max size", func(cfg *config.Config) { cfg.Audit.MaxSizeMB = 0 }, config.ErrInvalidAuditRotation},
+			{"unknown access log format", func(cfg *config.Config) { cfg.Log.Access = "apache" }, config.ErrUnknownAccessLogFormat},
+			{"unknown tracing exporter", func(cfg *config.Config) { cfg.Tracing.Exporter = "jaeger" }, config.ErrUnknownTracingExporter},
+			{"sample ratio over one", func(cfg *config.Config) { cfg.Tracing.SampleRatio = 2 }, config.ErrInvalidSampleRatio},
+			{"metrics listener without port", func(cfg *config.Config) { cfg.Metrics.Listen = "localhost" }, config.ErrInvalidMetricsListen},
+			{"no shutdown drain timeout", func(cfg *config.Config) { cfg.Shutdown.DrainTimeout = 0 }, config.ErrInvalidShutdownTimeout},
+			{"negative shutdown jobs timeout", func(cfg *config.Config) { cfg.Shutdown.JobsTimeout = -time.Second }, config.ErrInvalidShutdownTimeout},
+			{"negative shutdown readiness delay", func(cfg *config.Config) { cfg.Shutdown.ReadinessDelay = -time.Second }, config.ErrInvalidShutdownTimeout},
+			{"rate limit without burst", func(cfg *config.Config) { cfg.RateLimit.Ingest.Rate = 1 }, config.ErrInvalidRateLimit},
+			{"negative ip rate limit", func(cfg *config.Config) { cfg.RateLimit.IP.Rate = -1 }, config.ErrInvalidRateLimit},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				cfg := valid()
+				tt.modify(&cfg)
+
+				err := cfg.Validate()
+
+				require.True(t, errors.Is(err, tt.wantErr), "got error: %v", err)
+			})
+		}
+	})
+
+	t.Run("should reject an unknown log level", func(t *testing.T) {
+		cfg := valid()
+		cfg.Log.Level = "loud"
+
+		require.Error(t, cfg.Validate())
+	})
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/hamburghammer/gsave/backup"
+	"github.com/hamburghammer/gsave/controller/middleware"
+	"github.com/hamburghammer/gsave/db"
+)
+
+// NewAdminRouter is a constructor for the AdminRouter.
+func NewAdminRouter(db db.HostDB) *AdminRouter {
+	return &AdminRouter{db: db}
+}
+
+// AuditLog is the audit log that can be queried by the admin routes.
+type AuditLog interface {
+	Query(filter audit.Filter, skip, limit int) ([]audit.Entry, error)
+}
+
+// AdminRouter represents the controller for the administration routes.
+// All routes require the admin scope.
+type AdminRouter struct {
+	subrouter *mux.Router
+	db        db.HostDB
+	auditLog  AuditLog
+	metrics   http.Handler
+}
+
+// WithMetrics enables the route to get the metrics of gsave itself from the handler.
+// Returns the AdminRouter.
+func (ar *AdminRouter) WithMetrics(metrics http.Handler) *AdminRouter {
+	ar.metrics = metrics
+	return ar
+}
+
+// WithAuditLog enables the route to query the audit log.
+// Returns the AdminRouter.
+func (ar *AdminRouter) WithAuditLog(auditLog AuditLog) *AdminRouter {
+	ar.auditLog = auditLog
+	return ar
+}
+
+// Register registers all routes to the given subrouter.
+func (ar *AdminRouter) Register(subrouter *mux.Router) {
+	ar.subrouter = subrouter
+	subrouter.Use(middleware.AdminHandler)
+	subrouter.HandleFunc("/backup", ar.PostBackup).Methods(http.MethodPost).Name("PostBackup")
+	subrouter.HandleFunc("/vars", ar.GetVars).Methods(http.MethodGet).Name("GetVars")
+	if ar.metrics != nil {
+		subrouter.Handle("/metrics", ar.metrics).Methods(http.MethodGet).Name("GetMetrics")
+	}
+	if ar.auditLog != nil {
+		subrouter.HandleFunc("/audit", ar.GetAuditLog).Methods(http.MethodGet).Name("GetAuditLog")
+	}
+}
+
+// GetPrefix returns the the pre route for this controller.
+func (ar *AdminRouter) GetPrefix() string {
+	return "/admin"
+}
+
+// GetRouteName returns the Name of this controller.
+func (ar *AdminRouter) GetRouteName() string {
+	return "Admin"
+}
+
+// PostBackup is a HandleFunc to stream a backup of the db as gzip compressed tar archive.
+// The data gets copied without blocking the inserts so that the ingestion does not need to be stopped.
+func (ar *AdminRouter) PostBackup(w http.ResponseWriter, r *http.Request) {
+	snapshot, err := requestDB(ar.db, r).Snapshot()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	filename := fmt.Sprintf("gsave-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	if err := backup.Write(w, snapshot); err != nil {
+		// the status code was already written with the beginning of the stream
+		logInternalServerError(r).Error(err)
+	}
+}
+
+// GetVars is a HandleFunc to get the counters of gsave published with the expvar package.
+// The other expvar variables are not served because the command line contains the tokens and the signing secret.
+func (ar *AdminRouter) GetVars(w http.ResponseWriter, r *http.Request) {
+	vars := map[string]expvar.Var{
+		"throttledRequests": middleware.ThrottledRequests,
+		"authFailures":      middleware.AuthFailures,
+		"panicsRecovered":   middleware.PanicsRecovered,
+	}
+	values := make(map[string]json.RawMessage, len(vars))
+	for name, v := range vars {
+		values[name] = json.RawMessage(v.String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(values)
+}
+
+// GetAuditLog is a HandleFunc to get the entries of the audit log with the newest first.
+// The entries can be filtered with the 'principal', 'action', 'hostname' and 'since' query params.
+func (ar *AdminRouter) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	pagination, err := getSkipAndLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	filter := audit.Filter{
+		Principal: r.FormValue("principal"),
+		Action:    r.FormValue("action"),
+		Hostname:  r.FormValue("hostname"),
+	}
+	if since := r.FormValue("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			err = fmt.Errorf("Query param 'since' expected to be a RFC 3339 date: %s is not a date", since)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			logBadRequest(r).Error(err)
+			return
+		}
+	}
+
+	entries, err := ar.auditLog.Query(filter, pagination.Skip, pagination.Limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,133 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/hamburghammer/gsave/backup"
+	"github.com/hamburghammer/gsave/controller"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostBackup(t *testing.T) {
+	t.Run("streams the snapshot of the db", func(t *testing.T) {
+		snapshot := db.Snapshot{
+			Hosts:  []db.Host{{HostInfo: db.HostInfo{Hostname: "foo"}, Stats: []db.Stats{{Hostname: "foo"}}}},
+			Events: []db.Event{},
+		}
+		hostDB := &MockHostDB{}
+		hostDB.SetSnapshot(snapshot)
+		adminRouter := controller.NewAdminRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/admin/backup", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(adminRouter.PostBackup)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/gzip", rr.Header().Get("Content-Type"))
+
+		got, err := backup.Read(rr.Body)
+		require.NoError(t, err)
+		require.Equal(t, snapshot, got)
+	})
+
+	t.Run("db returns unknown error", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetSnapshotError(errors.New("unknown error"))
+		adminRouter := controller.NewAdminRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/admin/backup", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(adminRouter.PostBackup)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+type auditLogMock struct {
+	filter      audit.Filter
+	skip, limit int
+	entries     []audit.Entry
+}
+
+func (alm *auditLogMock) Query(filter audit.Filter, skip, limit int) ([]audit.Entry, error) {
+	alm.filter, alm.skip, alm.limit = filter, skip, limit
+	return alm.entries, nil
+}
+
+func TestGetVars(t *testing.T) {
+	t.Run("returns only the counters of gsave", func(t *testing.T) {
+		adminRouter := controller.NewAdminRouter(&MockHostDB{})
+
+		req, err := http.NewRequest("GET", "/admin/vars", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(adminRouter.GetVars)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var got map[string]json.RawMessage
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		require.Len(t, got, 3)
+		require.Contains(t, got, "throttledRequests")
+		require.Contains(t, got, "authFailures")
+		require.Contains(t, got, "panicsRecovered")
+		require.NotContains(t, got, "cmdline")
+	})
+}
+
+func TestGetAuditLog(t *testing.T) {
+	t.Run("returns the entries matching the query", func(t *testing.T) {
+		entries := []audit.Entry{{Principal: "ops", Action: audit.ActionDelete, Route: "DeleteHost", Hostname: "foo", Status: 200}}
+		auditLog := &auditLogMock{entries: entries}
+		adminRouter := controller.NewAdminRouter(&MockHostDB{}).WithAuditLog(auditLog)
+
+		req, err := http.NewRequest("GET", "/admin/audit?principal=ops&action=delete&hostname=foo&since=2020-01-02T15:04:05Z&skip=1&limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(adminRouter.GetAuditLog)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var got []audit.Entry
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		require.Equal(t, entries, got)
+		wantFilter := audit.Filter{Principal: "ops", Action: "delete", Hostname: "foo", Since: time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC)}
+		require.Equal(t, wantFilter, auditLog.filter)
+		require.Equal(t, 1, auditLog.skip)
+		require.Equal(t, 5, auditLog.limit)
+	})
+
+	t.Run("rejects an invalid since", func(t *testing.T) {
+		adminRouter := controller.NewAdminRouter(&MockHostDB{}).WithAuditLog(&auditLogMock{})
+
+		req, err := http.NewRequest("GET", "/admin/audit?since=yesterday", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(adminRouter.GetAuditLog)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'since' expected to be a RFC 3339 date: yesterday is not a date\n", rr.Body.String())
+	})
+}
@@ -4,16 +4,37 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/controller/middleware"
+	"github.com/hamburghammer/gsave/db"
 	log "github.com/sirupsen/logrus"
 )
 
-var (
-	logPackage             = log.WithField("Package", "controller")
-	logRequestError        = logPackage.WithField("RequestStatus", "Error")
-	logBadRequest          = logRequestError.WithField("StatusCode", http.StatusBadRequest)
-	logNotFound            = logRequestError.WithField("StatusCode", http.StatusNotFound)
-	logInternalServerError = logRequestError.WithField("StatusCode", http.StatusInternalServerError)
-)
+var logPackage = log.WithField("Package", "controller")
+
+// logRequestError returns the logger of the request for an error with the status code.
+func logRequestError(r *http.Request, statusCode int) *log.Entry {
+	return middleware.Logger(r).WithFields(logPackage.Data).WithFields(log.Fields{
+		"RequestStatus": "Error",
+		"StatusCode":    statusCode,
+	})
+}
+
+func logBadRequest(r *http.Request) *log.Entry {
+	return logRequestError(r, http.StatusBadRequest)
+}
+
+func logNotFound(r *http.Request) *log.Entry {
+	return logRequestError(r, http.StatusNotFound)
+}
+
+func logInternalServerError(r *http.Request) *log.Entry {
+	return logRequestError(r, http.StatusInternalServerError)
+}
+
+// requestDB binds the context of the request to the db so that its calls belong to the request.
+func requestDB(hostDB db.HostDB, r *http.Request) db.HostDB {
+	return db.WithContext(r.Context(), hostDB)
+}
 
 // Router is an interface that should be implemented by any controller
 // to give some information and to register the routes.
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/db"
+)
+
+// NewEventsRouter is a constructor for the EventsRouter.
+func NewEventsRouter(db db.HostDB) *EventsRouter {
+	return &EventsRouter{db: db}
+}
+
+// EventsRouter represents the controller for the fleet wide event routes.
+type EventsRouter struct {
+	subrouter *mux.Router
+	db        db.HostDB
+}
+
+// Register registers all routes to the given subrouter.
+func (er *EventsRouter) Register(subrouter *mux.Router) {
+	er.subrouter = subrouter
+	subrouter.HandleFunc("", er.GetEvents).Methods(http.MethodGet).Name("GetEvents")
+	subrouter.HandleFunc("", er.PostEvent).Methods(http.MethodPost).Name("PostEvent")
+}
+
+// GetPrefix returns the the pre route for this controller.
+func (er *EventsRouter) GetPrefix() string {
+	return "/events"
+}
+
+// GetRouteName returns the Name of this controller.
+func (er *EventsRouter) GetRouteName() string {
+	return "Events"
+}
+
+// GetEvents is a HandleFunc to get the events of all hosts.
+// The events can be filtered with the 'from', 'to' and 'tag' query params.
+func (er *EventsRouter) GetEvents(w http.ResponseWriter, r *http.Request) {
+	getEvents(requestDB(er.db, r), "", w, r)
+}
+
+// PostEvent is a HandleFunc to insert a new fleet wide event.
+func (er *EventsRouter) PostEvent(w http.ResponseWriter, r *http.Request) {
+	postEvent(requestDB(er.db, r), "", w, r)
+}
+
+// getEvents writes the events matching the query of the request.
+// If a hostname is given only the events of the host and the fleet wide events are written.
+func getEvents(hostDB db.HostDB, hostname string, w http.ResponseWriter, r *http.Request) {
+	pagination, err := getSkipAndLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	filter, err := getEventFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+	filter.Hostname = hostname
+
+	events, err := hostDB.GetEvents(filter, pagination)
+	if err != nil {
+		if errors.Is(err, db.ErrAllEntriesSkipped) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			logBadRequest(r).Error(err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
+
+// postEvent inserts the event from the request body for the host.
+// An empty hostname inserts a fleet wide event.
+// If the event has no date the current time is used.
+func postEvent(hostDB db.HostDB, hostname string, w http.ResponseWriter, r *http.Request) {
+	var event db.Event
+	err := json.NewDecoder(r.Body).Decode(&event)
+	if err != nil {
+		http.Error(w, "Could not read the body", http.StatusBadRequest)
+		logBadRequest(r).Error(fmt.Sprintf("JSON error decoding new event: %v", err))
+		return
+	}
+	if event.Title == "" {
+		http.Error(w, "Missing the 'title' of the event", http.StatusBadRequest)
+		logBadRequest(r).Error("Event without a title")
+		return
+	}
+
+	event.Hostname = hostname
+	if event.Date.IsZero() {
+		event.Date = time.Now()
+	}
+	if event.Tags == nil {
+		event.Tags = []string{}
+	}
+
+	event, err = hostDB.InsertEvent(event)
+	if err != nil {
+		http.Error(w, "Something with the DB went wrong.", http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(event)
+}
+
+// getEventFilter from the query of the request.
+// The time range is read from 'from' and 'to' in the RFC 3339 format and the tags from 'tag'.
+func getEventFilter(r *http.Request) (db.EventFilter, error) {
+	if err := r.ParseForm(); err != nil {
+		return db.EventFilter{}, err
+	}
+
+	filter := db.EventFilter{Tags: r.Form["tag"]}
+	var err error
+	if strFrom := r.FormValue("from"); strFrom != "" {
+		filter.From, err = time.Parse(time.RFC3339, strFrom)
+		if err != nil {
+			return db.EventFilter{}, fmt.Errorf("Query param 'from' expected to be a RFC 3339 date: %s is not valid", strFrom)
+		}
+	}
+	if strTo := r.FormValue("to"); strTo != "" {
+		filter.To, err = time.Parse(time.RFC3339, strTo)
+		if err != nil {
+			return db.EventFilter{}, fmt.Errorf("Query param 'to' expected to be a RFC 3339 date: %s is not valid", strTo)
+		}
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,205 @@
+package controller_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/controller"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetEvents(t *testing.T) {
+	t.Run("db has an item", func(t *testing.T) {
+		events := []db.Event{{ID: 1, Title: "deploy", Tags: []string{}}}
+		hostDB := &MockHostDB{}
+		hostDB.SetEvents(events)
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.GetEvents)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var gotBody []db.Event
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		require.Equal(t, events, gotBody)
+	})
+
+	t.Run("sets the filter from the query", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/events?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z&tag=deploy&tag=web", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.GetEvents)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		want := db.EventFilter{
+			From: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			To:   time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC),
+			Tags: []string{"deploy", "web"},
+		}
+		require.Equal(t, want, hostDB.GetEventFilter())
+	})
+
+	t.Run("sets the hostname for host events", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetEvents)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, hostname, hostDB.GetEventFilter().Hostname)
+	})
+
+	t.Run("invalid from date", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/events?from=yesterday", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.GetEvents)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'from' expected to be a RFC 3339 date: yesterday is not valid\n", rr.Body.String())
+	})
+
+	t.Run("db returns all entries skipped error", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetEventsError(db.ErrAllEntriesSkipped)
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/events", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.GetEvents)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		wantBody := fmt.Sprintf("%s\n", db.ErrAllEntriesSkipped.Error())
+		require.Equal(t, wantBody, rr.Body.String())
+	})
+}
+
+func TestPostEvent(t *testing.T) {
+	t.Run("insert fleet wide event", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		event := db.Event{Date: date, Title: "deploy", Tags: []string{"web"}, Text: "v1.0.0"}
+		hostDB := &MockHostDB{}
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(event)
+		req, err := http.NewRequest("POST", "/events", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.PostEvent)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, event, hostDB.GetInsertedEvent())
+
+		var gotBody db.Event
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+		require.Equal(t, 1, gotBody.ID)
+	})
+
+	t.Run("insert host event with the current date", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/"+hostname+"/events", bytes.NewBufferString(`{"title":"incident"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.PostEvent)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+
+		got := hostDB.GetInsertedEvent()
+		require.Equal(t, hostname, got.Hostname)
+		require.False(t, got.Date.IsZero())
+		require.Equal(t, []string{}, got.Tags)
+	})
+
+	t.Run("missing title", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/events", bytes.NewBufferString("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.PostEvent)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Missing the 'title' of the event\n", rr.Body.String())
+	})
+
+	t.Run("db returns an unknown error", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetInsertEventError(errors.New("unknown error"))
+		eventsRouter := controller.NewEventsRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/events", bytes.NewBufferString(`{"title":"deploy"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(eventsRouter.PostEvent)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		require.Equal(t, "Something with the DB went wrong.\n", rr.Body.String())
+	})
+}
@@ -0,0 +1,81 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/version"
+)
+
+// HealthRoutes are the names of the routes of the HealthRouter.
+// They are meant for probes and need no authentication.
+var HealthRoutes = []string{"GetHealth", "GetReadiness", "GetVersion"}
+
+// NewHealthRouter is a constructor for the HealthRouter.
+func NewHealthRouter(db db.HostDB) *HealthRouter {
+	return &HealthRouter{db: db}
+}
+
+// HealthRouter represents the controller for the probes of an orchestrator and the build version.
+type HealthRouter struct {
+	subrouter    *mux.Router
+	db           db.HostDB
+	shuttingDown int32
+}
+
+// SetShuttingDown marks the server as shutting down so that it is not ready anymore.
+func (hr *HealthRouter) SetShuttingDown() {
+	atomic.StoreInt32(&hr.shuttingDown, 1)
+}
+
+// Register registers all routes to the given subrouter.
+func (hr *HealthRouter) Register(subrouter *mux.Router) {
+	hr.subrouter = subrouter
+	subrouter.HandleFunc("/healthz", hr.GetHealth).Methods(http.MethodGet, http.MethodHead).Name("GetHealth")
+	subrouter.HandleFunc("/readyz", hr.GetReadiness).Methods(http.MethodGet, http.MethodHead).Name("GetReadiness")
+	subrouter.HandleFunc("/version", hr.GetVersion).Methods(http.MethodGet).Name("GetVersion")
+}
+
+// GetPrefix returns the the pre route for this controller.
+func (hr *HealthRouter) GetPrefix() string {
+	return ""
+}
+
+// GetRouteName returns the Name of this controller.
+func (hr *HealthRouter) GetRouteName() string {
+	return "Health"
+}
+
+// GetHealth is a HandleFunc that answers as long as the process is alive.
+func (hr *HealthRouter) GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok\n"))
+}
+
+// GetReadiness is a HandleFunc that checks if the server can handle requests.
+// It is not ready while shutting down or if the db backend can not be reached.
+// An empty db is ready.
+func (hr *HealthRouter) GetReadiness(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&hr.shuttingDown) == 1 {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	_, err := requestDB(hr.db, r).GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 1})
+	if err != nil && !errors.Is(err, db.ErrHostsNotFound) {
+		http.Error(w, "db not reachable", http.StatusServiceUnavailable)
+		logRequestError(r, http.StatusServiceUnavailable).Errorf("The db is not reachable: %v", err)
+		return
+	}
+
+	w.Write([]byte("ok\n"))
+}
+
+// GetVersion is a HandleFunc that returns the build version, commit and Go version.
+func (hr *HealthRouter) GetVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
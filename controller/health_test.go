@@ -0,0 +1,80 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/controller"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/version"
+	"github.com/stretchr/testify/require"
+)
+
+func serveHealth(t *testing.T, healthRouter *controller.HealthRouter, path string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	healthRouter.Register(router.PathPrefix(healthRouter.GetPrefix()).Subrouter())
+
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestGetHealth(t *testing.T) {
+	t.Run("is healthy even if the db is not reachable", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetHostsError(errors.New("unknown error"))
+
+		rr := serveHealth(t, controller.NewHealthRouter(hostDB), "/healthz")
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestGetReadiness(t *testing.T) {
+	t.Run("is ready with an empty db", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetHostsError(db.ErrHostsNotFound)
+
+		rr := serveHealth(t, controller.NewHealthRouter(hostDB), "/readyz")
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("is not ready if the db is not reachable", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetHostsError(errors.New("unknown error"))
+
+		rr := serveHealth(t, controller.NewHealthRouter(hostDB), "/readyz")
+
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+
+	t.Run("is not ready while shutting down", func(t *testing.T) {
+		healthRouter := controller.NewHealthRouter(&MockHostDB{})
+		healthRouter.SetShuttingDown()
+
+		rr := serveHealth(t, healthRouter, "/readyz")
+
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	})
+}
+
+func TestGetVersion(t *testing.T) {
+	t.Run("returns the build information", func(t *testing.T) {
+		rr := serveHealth(t, controller.NewHealthRouter(&MockHostDB{}), "/version")
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var got version.Info
+		require.NoError(t, json.NewDecoder(rr.Body).Decode(&got))
+		require.Equal(t, version.Info{Version: version.Version, Commit: version.Commit, GoVersion: runtime.Version()}, got)
+	})
+}
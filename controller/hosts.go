@@ -6,11 +6,18 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/controller/middleware"
 	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/exporter"
 )
 
+// lateStatsTolerance is how much older than the window of the top processes stats may be
+// before no newer stats are expected anymore, e.g. from agents that sent them late.
+const lateStatsTolerance = 5 * time.Minute
+
 // NewHostsRouter is a constructor for the HostsRouter.
 func NewHostsRouter(db db.HostDB) *HostsRouter {
 	return &HostsRouter{db: db}
@@ -29,6 +36,12 @@ func (hr *HostsRouter) Register(subrouter *mux.Router) {
 	subrouter.HandleFunc("/{hostname}", hr.GetHost).Methods(http.MethodGet).Name("GetHost")
 	subrouter.HandleFunc("/{hostname}/stats", hr.GetStats).Methods(http.MethodGet).Name("GetStats")
 	subrouter.HandleFunc("/{hostname}/stats", hr.PostStats).Methods(http.MethodPost).Name("PostStats")
+	subrouter.HandleFunc("/{hostname}/stats/export", hr.ExportStats).Methods(http.MethodGet).Name("ExportStats")
+	subrouter.HandleFunc("/{hostname}/events", hr.GetEvents).Methods(http.MethodGet).Name("GetHostEvents")
+	subrouter.HandleFunc("/{hostname}/events", hr.PostEvent).Methods(http.MethodPost).Name("PostHostEvent")
+	subrouter.HandleFunc("/{hostname}/processes/top", hr.GetTopProcesses).Methods(http.MethodGet).Name("GetTopProcesses")
+	subrouter.Handle("/{hostname}", middleware.AdminHandler(http.HandlerFunc(hr.DeleteHost))).Methods(http.MethodDelete).Name("DeleteHost")
+	subrouter.Handle("/{hostname}/merge", middleware.AdminHandler(http.HandlerFunc(hr.MergeHost))).Methods(http.MethodPost).Name("MergeHost")
 }
 
 // GetPrefix returns the the pre route for this controller.
@@ -43,22 +56,34 @@ func (hr *HostsRouter) GetRouteName() string {
 
 // GetHosts is a HandleFunc to get hosts out of the db with optional pagination as query params.
 func (hr *HostsRouter) GetHosts(w http.ResponseWriter, r *http.Request) {
-	pagination, err := hr.getSkipAndLimit(r)
+	pagination, err := getSkipAndLimit(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		logBadRequest.Error(err)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	query, err := getHostQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+	if err := query.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
 		return
 	}
 
-	hosts, err := hr.db.GetHosts(pagination)
+	hosts, err := requestDB(hr.db, r).GetHosts(query, pagination)
 	if err != nil {
 		if errors.Is(err, db.ErrHostsNotFound) || errors.Is(err, db.ErrAllEntriesSkipped) {
 			http.Error(w, err.Error(), http.StatusNotFound)
-			logNotFound.Error(err)
+			logNotFound(r).Error(err)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logInternalServerError.Error(err)
+		logInternalServerError(r).Error(err)
 		return
 	}
 
@@ -70,15 +95,15 @@ func (hr *HostsRouter) GetHosts(w http.ResponseWriter, r *http.Request) {
 func (hr *HostsRouter) GetHost(w http.ResponseWriter, r *http.Request) {
 	hostname := mux.Vars(r)["hostname"]
 
-	host, err := hr.db.GetHost(hostname)
+	host, err := requestDB(hr.db, r).GetHost(hostname)
 	if err != nil {
 		if errors.Is(err, db.ErrHostNotFound) {
 			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
-			logNotFound.Error(err)
+			logNotFound(r).Error(err)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logInternalServerError.Error(err)
+		logInternalServerError(r).Error(err)
 		return
 	}
 
@@ -87,32 +112,45 @@ func (hr *HostsRouter) GetHost(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetStats is a HandleFunc to get paginated stats for a host.
+// The custom metrics, mounts and network interfaces can be selected with the
+// 'metric', 'mount' and 'interface' query params.
 func (hr *HostsRouter) GetStats(w http.ResponseWriter, r *http.Request) {
 	hostname := mux.Vars(r)["hostname"]
 
-	pagination, err := hr.getSkipAndLimit(r)
+	pagination, err := getSkipAndLimit(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
-		logBadRequest.Error(err)
+		logBadRequest(r).Error(err)
 		return
 	}
 
-	stats, err := hr.db.GetStatsByHostname(hostname, pagination)
+	selection, err := hr.getStatsSelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	stats, err := requestDB(hr.db, r).GetStatsByHostname(hostname, pagination)
 	if err != nil {
 		if errors.Is(err, db.ErrHostNotFound) {
 			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
-			logNotFound.Error(err)
+			logNotFound(r).Error(err)
 			return
 		} else if errors.Is(err, db.ErrAllEntriesSkipped) {
 			http.Error(w, err.Error(), http.StatusBadRequest)
-			logNotFound.Error(err)
+			logNotFound(r).Error(err)
 			return
 		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
-		logInternalServerError.Error(err)
+		logInternalServerError(r).Error(err)
 		return
 	}
 
+	for i, stat := range stats {
+		stats[i] = selection.apply(stat)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
 }
@@ -125,21 +163,228 @@ func (hr *HostsRouter) PostStats(w http.ResponseWriter, r *http.Request) {
 	err := json.NewDecoder(r.Body).Decode(&stats)
 	if err != nil {
 		http.Error(w, "Could not read the body", http.StatusBadRequest)
-		logBadRequest.Error(fmt.Sprintf("JSON error decoding new stat: %v", err))
+		logBadRequest(r).Error(fmt.Sprintf("JSON error decoding new stat: %v", err))
+		return
+	}
+
+	if err := stats.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
 		return
 	}
 
-	err = hr.db.InsertStats(hostname, stats)
+	err = requestDB(hr.db, r).InsertStats(hostname, stats.Normalize())
 	if err != nil {
 		http.Error(w, "Something with the DB went wrong.", http.StatusInternalServerError)
-		logInternalServerError.Error(err)
+		logInternalServerError(r).Error(err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
 }
 
+// ExportStats is a HandleFunc to stream all stats of a host in the 'format' ndjson (default) or csv.
+// The custom metrics can be selected by their name with the 'metric' query param.
+func (hr *HostsRouter) ExportStats(w http.ResponseWriter, r *http.Request) {
+	hostname := mux.Vars(r)["hostname"]
+
+	strFormat := r.FormValue("format")
+	if strFormat == "" {
+		strFormat = string(exporter.NDJSON)
+	}
+	format, err := exporter.ParseFormat(strFormat)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query param 'format' expected to be 'ndjson' or 'csv': %s is not valid", strFormat), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	selection, err := hr.getStatsSelection(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	if _, err := requestDB(hr.db, r).GetHost(hostname); err != nil {
+		if errors.Is(err, db.ErrHostNotFound) {
+			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
+			logNotFound(r).Error(err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", hostname+"."+string(format)))
+	err = exporter.NewExporter(requestDB(hr.db, r)).WithMetrics(selection.metrics).Export(w, []string{hostname}, format)
+	if err != nil {
+		// the status code was already written with the beginning of the stream
+		logInternalServerError(r).Error(err)
+	}
+}
+
+// GetEvents is a HandleFunc to get the events of a host together with the fleet wide events.
+// The events can be filtered with the 'from', 'to' and 'tag' query params.
+func (hr *HostsRouter) GetEvents(w http.ResponseWriter, r *http.Request) {
+	getEvents(requestDB(hr.db, r), mux.Vars(r)["hostname"], w, r)
+}
+
+// PostEvent is a HandleFunc to insert a new event for a host.
+func (hr *HostsRouter) PostEvent(w http.ResponseWriter, r *http.Request) {
+	postEvent(requestDB(hr.db, r), mux.Vars(r)["hostname"], w, r)
+}
+
+// GetTopProcesses is a HandleFunc to get the processes of a host with the highest average usage.
+// The usage gets aggregated over all stats inside the time 'window' (default 1h) and sorted 'by' cpu or rss.
+// The newest stats are read until one is older than the window by more than the lateStatsTolerance.
+// Stats without a date are not aggregated because they can not be placed inside the window.
+// The amount of processes can be set with the 'limit' query param.
+func (hr *HostsRouter) GetTopProcesses(w http.ResponseWriter, r *http.Request) {
+	hostname := mux.Vars(r)["hostname"]
+
+	pagination, err := getSkipAndLimit(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	strWindow := r.FormValue("window")
+	if strWindow == "" {
+		strWindow = "1h"
+	}
+	window, err := time.ParseDuration(strWindow)
+	if err != nil || window <= 0 {
+		err = fmt.Errorf("Query param 'window' expected to be a positive duration: %s is not valid", strWindow)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	by := r.FormValue("by")
+	if by == "" {
+		by = "cpu"
+	}
+
+	since := time.Now().Add(-window)
+	aggregator := db.NewProcessUsageAggregator()
+	err = db.ForEachStats(requestDB(hr.db, r), hostname, func(stats db.Stats) bool {
+		if stats.Date.IsZero() {
+			return true
+		}
+		// the stats are in insert order, so older ones are only skipped until they are older than the tolerance
+		if stats.Date.Before(since) {
+			return !stats.Date.Before(since.Add(-lateStatsTolerance))
+		}
+		aggregator.Add(stats)
+		return true
+	})
+	if err != nil {
+		if errors.Is(err, db.ErrHostNotFound) {
+			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
+			logNotFound(r).Error(err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	processes, err := aggregator.Top(by, pagination.Limit)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Query param 'by' expected to be 'cpu' or 'rss': %s is not valid", by), http.StatusBadRequest)
+		logBadRequest(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(processes)
+}
+
+// DeleteHost is a HandleFunc to delete a host with all its stats. The host name gets read out of the request path.
+func (hr *HostsRouter) DeleteHost(w http.ResponseWriter, r *http.Request) {
+	hostname := mux.Vars(r)["hostname"]
+
+	err := requestDB(hr.db, r).DeleteHost(hostname)
+	if err != nil {
+		if errors.Is(err, db.ErrHostNotFound) {
+			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
+			logNotFound(r).Error(err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MergeRequest is the body of a request to merge a host into another one.
+type MergeRequest struct {
+	Target string `json:"target"`
+}
+
+// MergeHost is a HandleFunc to move all stats of a host into the target host from the body.
+// If the target host does not exist the host gets renamed.
+func (hr *HostsRouter) MergeHost(w http.ResponseWriter, r *http.Request) {
+	hostname := mux.Vars(r)["hostname"]
+
+	var mergeRequest MergeRequest
+	err := json.NewDecoder(r.Body).Decode(&mergeRequest)
+	if err != nil {
+		http.Error(w, "Could not read the body", http.StatusBadRequest)
+		logBadRequest(r).Error(fmt.Sprintf("JSON error decoding merge request: %v", err))
+		return
+	}
+	if mergeRequest.Target == "" {
+		http.Error(w, "Missing the 'target' host", http.StatusBadRequest)
+		logBadRequest(r).Error("Merge request without a target host")
+		return
+	}
+
+	err = requestDB(hr.db, r).MergeHosts(hostname, mergeRequest.Target)
+	if err != nil {
+		if errors.Is(err, db.ErrHostNotFound) {
+			http.Error(w, fmt.Sprintf("No host with the name '%s' found", hostname), http.StatusNotFound)
+			logNotFound(r).Error(err)
+			return
+		} else if errors.Is(err, db.ErrMergeSameHost) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			logBadRequest(r).Error(err)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getHostQuery reads the sort, order and filter query params.
+func getHostQuery(r *http.Request) (db.HostQuery, error) {
+	query := db.HostQuery{
+		Sort:   db.HostSort(r.FormValue("sort")),
+		Order:  db.SortOrder(r.FormValue("order")),
+		Search: r.FormValue("q"),
+		Match:  r.FormValue("match"),
+		Regex:  r.FormValue("regex"),
+	}
+
+	if strLastSeenWithin := r.FormValue("lastSeenWithin"); strLastSeenWithin != "" {
+		lastSeenWithin, err := time.ParseDuration(strLastSeenWithin)
+		if err != nil {
+			return db.HostQuery{}, fmt.Errorf("Query param 'lastSeenWithin' expected to be a duration: %s is not a duration", strLastSeenWithin)
+		}
+		query.LastSeenWithin = lastSeenWithin
+	}
+
+	return query, nil
+}
+
 // getSkipAndLimit from the query of the request.
-func (hr *HostsRouter) getSkipAndLimit(r *http.Request) (db.Pagination, error) {
+func getSkipAndLimit(r *http.Request) (db.Pagination, error) {
 	defaultLimit := "10"
 	defaultSkip := "0"
 
@@ -169,3 +414,42 @@ func (hr *HostsRouter) getSkipAndLimit(r *http.Request) (db.Pagination, error) {
 
 	return db.Pagination{Skip: int(skip), Limit: int(limit)}, nil
 }
+
+// statsSelection holds the parts of the stats that should be returned.
+// An empty list selects everything.
+type statsSelection struct {
+	metrics    []string
+	mounts     []string
+	interfaces []string
+}
+
+// apply the selection to the stats.
+func (ss statsSelection) apply(stats db.Stats) db.Stats {
+	if len(ss.metrics) > 0 {
+		stats = stats.SelectMetrics(ss.metrics)
+	}
+	if len(ss.mounts) > 0 {
+		stats = stats.SelectMounts(ss.mounts)
+	}
+	if len(ss.interfaces) > 0 {
+		stats = stats.SelectInterfaces(ss.interfaces)
+	}
+	return stats
+}
+
+// getStatsSelection from the query of the request.
+// Returns an error if one of the metric names is not valid.
+func (hr *HostsRouter) getStatsSelection(r *http.Request) (statsSelection, error) {
+	if err := r.ParseForm(); err != nil {
+		return statsSelection{}, err
+	}
+
+	metrics := r.Form["metric"]
+	for _, name := range metrics {
+		if err := db.ValidateMetricName(name); err != nil {
+			return statsSelection{}, fmt.Errorf("Query param 'metric' is not valid: %w", err)
+		}
+	}
+
+	return statsSelection{metrics: metrics, mounts: r.Form["mount"], interfaces: r.Form["interface"]}, nil
+}
@@ -7,7 +7,9 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/hamburghammer/gsave/controller"
@@ -245,6 +247,107 @@ func TestHostsRouter_GetHosts(t *testing.T) {
 		})
 
 	})
+
+	t.Run("sorting", func(t *testing.T) {
+		t.Run("passes the sort and order to the db", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?sort=lastInsert&order=desc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, db.HostQuery{Sort: db.SortByLastInsert, Order: db.OrderDesc}, hostDB.GetHostQuery())
+		})
+
+		t.Run("rejects an unknown sort", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?sort=cpu", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Equal(t, "db: Unknown host sort: 'cpu'\n", rr.Body.String())
+		})
+
+		t.Run("rejects an unknown order", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?order=up", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Equal(t, "db: Unknown sort order: 'up'\n", rr.Body.String())
+		})
+	})
+
+	t.Run("filtering", func(t *testing.T) {
+		t.Run("passes the filters to the db", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?q=web&match=web-*&regex=%5Eweb&lastSeenWithin=10m", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusOK, rr.Code)
+			want := db.HostQuery{Search: "web", Match: "web-*", Regex: "^web", LastSeenWithin: 10 * time.Minute}
+			require.Equal(t, want, hostDB.GetHostQuery())
+		})
+
+		t.Run("rejects an invalid lastSeenWithin", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?lastSeenWithin=a", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Equal(t, "Query param 'lastSeenWithin' expected to be a duration: a is not a duration\n", rr.Body.String())
+		})
+
+		t.Run("rejects an invalid regex", func(t *testing.T) {
+			hostDB := &MockHostDB{}
+			hostsRouter := controller.NewHostsRouter(hostDB)
+
+			req, err := http.NewRequest("GET", "/hosts?regex=web-(", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			handler := http.HandlerFunc(hostsRouter.GetHosts)
+			handler.ServeHTTP(rr, req)
+
+			require.Equal(t, http.StatusBadRequest, rr.Code)
+			require.Contains(t, rr.Body.String(), db.ErrInvalidHostFilter.Error())
+		})
+	})
 }
 
 func TestGetHost(t *testing.T) {
@@ -524,6 +627,91 @@ func TestGetStat(t *testing.T) {
 		require.Equal(t, stats, gotBody)
 	})
 
+	t.Run("selects metrics by name", func(t *testing.T) {
+		hostname := "foo"
+		stats := []db.Stats{{Hostname: hostname, Metrics: map[string]float64{"load1": 1, "load5": 5, "temp": 40}}}
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname(stats)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats?metric=load1&metric=temp", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var gotBody []db.Stats
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []db.Stats{{Hostname: hostname, Metrics: map[string]float64{"load1": 1, "temp": 40}}}
+		require.Equal(t, want, gotBody)
+	})
+
+	t.Run("selects mounts and interfaces", func(t *testing.T) {
+		hostname := "foo"
+		stats := []db.Stats{{
+			Hostname:   hostname,
+			Mounts:     []db.Mount{{Path: "/"}, {Path: "/var"}},
+			Interfaces: []db.NetworkInterface{{Name: "lo"}, {Name: "eth0"}},
+		}}
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname(stats)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats?mount=/var&interface=eth0", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		var gotBody []db.Stats
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []db.Stats{{
+			Hostname:   hostname,
+			Mounts:     []db.Mount{{Path: "/var"}},
+			Interfaces: []db.NetworkInterface{{Name: "eth0"}},
+		}}
+		require.Equal(t, want, gotBody)
+	})
+
+	t.Run("invalid metric name", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats?metric=1load", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'metric' is not valid: db: Invalid metric name: '1load'\n", rr.Body.String())
+	})
+
 	t.Run("db returns not found error", func(t *testing.T) {
 		hostname := "foo"
 		hostDB := &MockHostDB{}
@@ -616,6 +804,27 @@ func TestInsertStat(t *testing.T) {
 		require.Equal(t, stat, hostDB.GetInsertedStats())
 	})
 
+	t.Run("insert stat with the old disk shape from the mounts", func(t *testing.T) {
+		hostname := "foo"
+		stat := db.Stats{Hostname: hostname, Mounts: []db.Mount{{Path: "/", Used: 1, Total: 2}}}
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(stat)
+		req, err := http.NewRequest("POST", "/"+hostname+"/stats", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.PostStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusCreated, rr.Code)
+		require.Equal(t, db.Memory{Used: 1, Total: 2}, hostDB.GetInsertedStats().Disk)
+	})
+
 	t.Run("missing body", func(t *testing.T) {
 		hostname := "foo"
 		hostDB := &MockHostDB{}
@@ -635,6 +844,28 @@ func TestInsertStat(t *testing.T) {
 		require.Equal(t, "Could not read the body\n", rr.Body.String())
 	})
 
+	t.Run("invalid metric name", func(t *testing.T) {
+		hostname := "foo"
+		stat := db.Stats{Hostname: hostname, Metrics: map[string]float64{"load 1": 1}}
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(stat)
+		req, err := http.NewRequest("POST", "/"+hostname+"/stats", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.PostStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "db: Invalid metric name: 'load 1'\n", rr.Body.String())
+		require.Equal(t, "", hostDB.GetInsertStatsHostname())
+	})
+
 	t.Run("db returns an unknown error", func(t *testing.T) {
 		hostname := "foo"
 		unknownErr := errors.New("unknown error")
@@ -660,6 +891,373 @@ func TestInsertStat(t *testing.T) {
 
 }
 
+func TestExportStats(t *testing.T) {
+	t.Run("streams the stats as NDJSON by default", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname([]db.Stats{{Hostname: hostname, CPU: 1}})
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.ExportStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/x-ndjson", rr.Header().Get("Content-Type"))
+		require.Equal(t, "{\"hostname\":\"foo\",\"date\":\"0001-01-01T00:00:00Z\",\"cpu\":1,\"processes\":null,\"Disk\":{\"used\":0,\"total\":0},\"Mem\":{\"used\":0,\"total\":0}}\n", rr.Body.String())
+	})
+
+	t.Run("streams the stats as CSV", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname([]db.Stats{{Hostname: hostname, CPU: 1}})
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats/export?format=csv", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.ExportStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "text/csv", rr.Header().Get("Content-Type"))
+		require.Equal(t, "hostname,date,cpu,disk_used,disk_total,mem_used,mem_total,processes,cores,load,mounts,interfaces\nfoo,0001-01-01T00:00:00Z,1,0,0,0,0,null,,,,\n", rr.Body.String())
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats/export?format=parquet", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.ExportStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'format' expected to be 'ndjson' or 'csv': parquet is not valid\n", rr.Body.String())
+	})
+
+	t.Run("db returns not found error", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetHostError(db.ErrHostNotFound)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/stats/export", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.ExportStats)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestGetTopProcesses(t *testing.T) {
+	t.Run("aggregates the processes inside the window", func(t *testing.T) {
+		hostname := "foo"
+		now := time.Now()
+		stats := []db.Stats{
+			{Date: now, Processes: []db.Process{{Name: "postgres", CPU: 2, RSS: 20}, {Name: "nginx", CPU: 1, RSS: 100}}},
+			{Date: now.Add(-time.Minute), Processes: []db.Process{{Name: "postgres", CPU: 4, RSS: 40}}},
+			{Date: now.Add(-2 * time.Hour), Processes: []db.Process{{Name: "nginx", CPU: 100, RSS: 100}}},
+		}
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname(stats)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/processes/top?by=cpu&window=1h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetTopProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, hostname, hostDB.GetStatsByHostnameHostname())
+
+		var gotBody []db.ProcessUsage
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []db.ProcessUsage{
+			{Name: "postgres", Samples: 2, AvgCPU: 3, MaxCPU: 4, AvgRSS: 30, MaxRSS: 40},
+			{Name: "nginx", Samples: 1, AvgCPU: 1, MaxCPU: 1, AvgRSS: 100, MaxRSS: 100},
+		}
+		require.Equal(t, want, gotBody)
+	})
+
+	t.Run("skips stats without a date and stops at older stats", func(t *testing.T) {
+		hostname := "foo"
+		now := time.Now()
+		stats := []db.Stats{
+			{Processes: []db.Process{{Name: "postgres", CPU: 100, RSS: 100}}},
+			{Date: now.Add(-time.Minute), Processes: []db.Process{{Name: "postgres", CPU: 4, RSS: 40}}},
+			// older than the window but inside the tolerance for late stats
+			{Date: now.Add(-62 * time.Minute), Processes: []db.Process{{Name: "nginx", CPU: 100, RSS: 100}}},
+			{Date: now.Add(-30 * time.Minute), Processes: []db.Process{{Name: "postgres", CPU: 6, RSS: 60}}},
+			{Date: now.Add(-2 * time.Hour), Processes: []db.Process{{Name: "nginx", CPU: 100, RSS: 100}}},
+			{Date: now.Add(-time.Minute), Processes: []db.Process{{Name: "mysql", CPU: 100, RSS: 100}}},
+		}
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostname(stats)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/processes/top?window=1h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetTopProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		var gotBody []db.ProcessUsage
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []db.ProcessUsage{
+			{Name: "postgres", Samples: 2, AvgCPU: 5, MaxCPU: 6, AvgRSS: 50, MaxRSS: 60},
+		}
+		require.Equal(t, want, gotBody)
+	})
+
+	t.Run("invalid window", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/processes/top?window=-1h", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetTopProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'window' expected to be a positive duration: -1h is not valid\n", rr.Body.String())
+	})
+
+	t.Run("unknown sort field", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/processes/top?by=pid", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetTopProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Query param 'by' expected to be 'cpu' or 'rss': pid is not valid\n", rr.Body.String())
+	})
+
+	t.Run("db returns not found error", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetStatsByHostnameError(db.ErrHostNotFound)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/"+hostname+"/processes/top", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.GetTopProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+}
+
+func TestDeleteHost(t *testing.T) {
+	t.Run("delete host from url", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("DELETE", "/"+hostname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.DeleteHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		require.Equal(t, hostname, hostDB.GetDeleteHostHostname())
+	})
+
+	t.Run("db returns not found error", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetDeleteHostError(db.ErrHostNotFound)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("DELETE", "/"+hostname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.DeleteHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+
+		wantErr := fmt.Sprintf("No host with the name '%s' found\n", hostname)
+		require.Equal(t, wantErr, rr.Body.String())
+	})
+
+	t.Run("db returns unknown error", func(t *testing.T) {
+		unknownErr := errors.New("unknown error")
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetDeleteHostError(unknownErr)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("DELETE", "/"+hostname, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.DeleteHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
+
+func TestMergeHost(t *testing.T) {
+	t.Run("merge host from url into target", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(controller.MergeRequest{Target: "bar"})
+		req, err := http.NewRequest("POST", "/"+hostname+"/merge", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.MergeHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNoContent, rr.Code)
+		source, target := hostDB.GetMergeHostsSourceAndTarget()
+		require.Equal(t, hostname, source)
+		require.Equal(t, "bar", target)
+	})
+
+	t.Run("missing target", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		req, err := http.NewRequest("POST", "/"+hostname+"/merge", bytes.NewBufferString("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.MergeHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Missing the 'target' host\n", rr.Body.String())
+	})
+
+	t.Run("db returns not found error", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetMergeHostsError(db.ErrHostNotFound)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(controller.MergeRequest{Target: "bar"})
+		req, err := http.NewRequest("POST", "/"+hostname+"/merge", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.MergeHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNotFound, rr.Code)
+	})
+
+	t.Run("db returns merge same host error", func(t *testing.T) {
+		hostname := "foo"
+		hostDB := &MockHostDB{}
+		hostDB.SetMergeHostsError(db.ErrMergeSameHost)
+		hostsRouter := controller.NewHostsRouter(hostDB)
+
+		requestBody, _ := json.Marshal(controller.MergeRequest{Target: hostname})
+		req, err := http.NewRequest("POST", "/"+hostname+"/merge", bytes.NewBuffer(requestBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req = mux.SetURLVars(req, map[string]string{"hostname": hostname})
+
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(hostsRouter.MergeHost)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		wantBody := fmt.Sprintf("%s\n", db.ErrMergeSameHost.Error())
+		require.Equal(t, wantBody, rr.Body.String())
+	})
+}
+
 type MockHostDB struct {
 	hosts      []db.HostInfo
 	hostsError error
@@ -673,6 +1271,27 @@ type MockHostDB struct {
 	insertedStat      db.Stats
 	insertedStatError error
 
+	deleteHostError error
+
+	mergeSource string
+	mergeTarget string
+	mergeError  error
+
+	insertedEvent      db.Event
+	insertedEventError error
+
+	events      []db.Event
+	eventsError error
+	eventFilter db.EventFilter
+
+	deleteStatsBefore      time.Time
+	deleteStatsBeforeError error
+
+	snapshot      db.Snapshot
+	snapshotError error
+	restored      db.Snapshot
+
+	hostQuery  db.HostQuery
 	pagination db.Pagination
 	hostname   string
 }
@@ -684,7 +1303,11 @@ func (m *MockHostDB) SetHosts(hosts []db.HostInfo) {
 func (m *MockHostDB) SetHostsError(err error) {
 	m.hostsError = err
 }
-func (m *MockHostDB) GetHosts(pagination db.Pagination) ([]db.HostInfo, error) {
+func (m *MockHostDB) GetHostQuery() db.HostQuery {
+	return m.hostQuery
+}
+func (m *MockHostDB) GetHosts(query db.HostQuery, pagination db.Pagination) ([]db.HostInfo, error) {
+	m.hostQuery = query
 	m.pagination = pagination
 	if m.hostsError != nil {
 		return []db.HostInfo{}, m.hostsError
@@ -729,6 +1352,20 @@ func (m *MockHostDB) GetStatsByHostname(hostname string, pagination db.Paginatio
 	return m.stats, nil
 }
 
+// GetStatsPage returns the stats of SetStatsByHostname with the cursor as the position of the next page.
+func (m *MockHostDB) GetStatsPage(hostname string, cursor db.StatsCursor, limit int) ([]db.Stats, db.StatsCursor, error) {
+	m.hostname = hostname
+	if m.statsError != nil {
+		return []db.Stats{}, "", m.statsError
+	}
+	start, _ := strconv.Atoi(string(cursor))
+	end := start + limit
+	if end > len(m.stats) {
+		end = len(m.stats)
+	}
+	return m.stats[start:end], db.StatsCursor(strconv.Itoa(end)), nil
+}
+
 // InsertStats
 func (m *MockHostDB) GetInsertedStats() db.Stats {
 	return m.insertedStat
@@ -748,6 +1385,103 @@ func (m *MockHostDB) InsertStats(hostname string, stats db.Stats) error {
 	return nil
 }
 
+// DeleteHost
+func (m *MockHostDB) SetDeleteHostError(err error) {
+	m.deleteHostError = err
+}
+func (m *MockHostDB) GetDeleteHostHostname() string {
+	return m.hostname
+}
+func (m *MockHostDB) DeleteHost(hostname string) error {
+	m.hostname = hostname
+	return m.deleteHostError
+}
+
+// MergeHosts
+func (m *MockHostDB) SetMergeHostsError(err error) {
+	m.mergeError = err
+}
+func (m *MockHostDB) GetMergeHostsSourceAndTarget() (string, string) {
+	return m.mergeSource, m.mergeTarget
+}
+func (m *MockHostDB) MergeHosts(source, target string) error {
+	m.mergeSource = source
+	m.mergeTarget = target
+	return m.mergeError
+}
+
+// DeleteStatsBefore
+func (m *MockHostDB) GetDeleteStatsBeforeDate() time.Time {
+	return m.deleteStatsBefore
+}
+func (m *MockHostDB) SetDeleteStatsBeforeError(err error) {
+	m.deleteStatsBeforeError = err
+}
+func (m *MockHostDB) DeleteStatsBefore(date time.Time) (int, error) {
+	m.deleteStatsBefore = date
+	return 0, m.deleteStatsBeforeError
+}
+
+// InsertEvent
+func (m *MockHostDB) GetInsertedEvent() db.Event {
+	return m.insertedEvent
+}
+func (m *MockHostDB) SetInsertEventError(err error) {
+	m.insertedEventError = err
+}
+func (m *MockHostDB) InsertEvent(event db.Event) (db.Event, error) {
+	m.insertedEvent = event
+	if m.insertedEventError != nil {
+		return db.Event{}, m.insertedEventError
+	}
+	event.ID = 1
+	return event, nil
+}
+
+// GetEvents
+func (m *MockHostDB) SetEvents(events []db.Event) {
+	m.events = events
+}
+func (m *MockHostDB) SetEventsError(err error) {
+	m.eventsError = err
+}
+func (m *MockHostDB) GetEventFilter() db.EventFilter {
+	return m.eventFilter
+}
+func (m *MockHostDB) GetEvents(filter db.EventFilter, pagination db.Pagination) ([]db.Event, error) {
+	m.eventFilter = filter
+	m.pagination = pagination
+	if m.eventsError != nil {
+		return []db.Event{}, m.eventsError
+	}
+	return m.events, nil
+}
+
+// Snapshot
+func (m *MockHostDB) SetSnapshot(snapshot db.Snapshot) {
+	m.snapshot = snapshot
+}
+func (m *MockHostDB) SetSnapshotError(err error) {
+	m.snapshotError = err
+}
+func (m *MockHostDB) Snapshot() (db.Snapshot, error) {
+	return m.snapshot, m.snapshotError
+}
+
+// Restore
+func (m *MockHostDB) GetRestoredSnapshot() db.Snapshot {
+	return m.restored
+}
+func (m *MockHostDB) Restore(snapshot db.Snapshot) error {
+	m.restored = snapshot
+	return nil
+}
+
+// Close
+func (m *MockHostDB) Close() error {
+	return nil
+}
+
 func (m *MockHostDB) GetPagination() db.Pagination {
 	return m.pagination
 }
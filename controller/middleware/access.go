@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the format of the access log lines.
+type AccessLogFormat string
+
+// The formats of the access log.
+const (
+	// AccessLogOff disables the access log.
+	AccessLogOff AccessLogFormat = ""
+	// AccessLogCommon is the Common Log Format.
+	AccessLogCommon AccessLogFormat = "common"
+	// AccessLogCombined is the Combined Log Format with the referer and the user agent.
+	AccessLogCombined AccessLogFormat = "combined"
+)
+
+const clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// NewAccessLogMiddleware is a constructor for the AccessLogMiddleware struct.
+// The lines are written to stdout.
+func NewAccessLogMiddleware(format AccessLogFormat) *AccessLogMiddleware {
+	return &AccessLogMiddleware{format: format, out: os.Stdout}
+}
+
+// AccessLogMiddleware writes a line for every request in the Common or Combined Log Format.
+// The lines are written as they are and not through the logger, so tools for these formats can read them.
+// The user of a line is the principal set by the AuthHandler.
+type AccessLogMiddleware struct {
+	format AccessLogFormat
+	m      sync.RWMutex
+	out    io.Writer
+	outM   sync.Mutex
+}
+
+// WithWriter sets the writer of the lines.
+// Returns the AccessLogMiddleware.
+func (al *AccessLogMiddleware) WithWriter(out io.Writer) *AccessLogMiddleware {
+	al.out = out
+	return al
+}
+
+// SetFormat changes the format while the middleware is in use.
+func (al *AccessLogMiddleware) SetFormat(format AccessLogFormat) {
+	al.m.Lock()
+	defer al.m.Unlock()
+
+	al.format = format
+}
+
+func (al *AccessLogMiddleware) getFormat() AccessLogFormat {
+	al.m.RLock()
+	defer al.m.RUnlock()
+
+	return al.format
+}
+
+// AccessLogHandler logs the request after it got handled.
+// This handler should be added before the AuthHandler.
+func (al *AccessLogMiddleware) AccessLogHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		format := al.getFormat()
+		if format == AccessLogOff {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		start := time.Now()
+		r, principal := withPrincipal(r)
+		sl := newStatusCodeLogger(rw)
+		next.ServeHTTP(sl, r)
+
+		al.write(formatAccessLog(format, r, *principal, start, sl.statusCode, sl.size))
+	})
+}
+
+// write writes the line to the writer of the middleware.
+// The lines of concurrent requests are not interleaved.
+func (al *AccessLogMiddleware) write(line string) {
+	al.outM.Lock()
+	defer al.outM.Unlock()
+
+	if _, err := io.WriteString(al.out, line+"\n"); err != nil {
+		logPackage.Errorf("Could not write the access log: %v\n", err)
+	}
+}
+
+// formatAccessLog returns the line for the request in the format.
+func formatAccessLog(format AccessLogFormat, r *http.Request, user string, start time.Time, statusCode, size int) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if user == "" {
+		user = "-"
+	}
+	bytes := "-"
+	if size > 0 {
+		bytes = fmt.Sprint(size)
+	}
+
+	line := fmt.Sprintf(`%s - %s [%s] "%s %s %s" %d %s`,
+		host, user, start.Format(clfTimeFormat), r.Method, r.RequestURI, r.Proto, statusCode, bytes)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(` "%s" "%s"`, escapeQuotes(r.Referer()), escapeQuotes(r.UserAgent()))
+	}
+	return line
+}
+
+func escapeQuotes(s string) string {
+	return strings.ReplaceAll(s, `"`, `\"`)
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessLogHandler(t *testing.T) {
+	serve := func(format AccessLogFormat) (*bytes.Buffer, *test.Hook) {
+		hook := test.NewGlobal()
+		t.Cleanup(hook.Reset)
+		var out bytes.Buffer
+
+		req, err := http.NewRequest("GET", "/hosts?limit=5", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RequestURI = "/hosts?limit=5"
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("Token", "foo")
+		req.Header.Set("Referer", "http://example.com")
+		req.Header.Set("User-Agent", `agent "1.0"`)
+
+		handler := NewAccessLogMiddleware(format).WithWriter(&out).AccessLogHandler(
+			NewAuthMiddleware([]string{"foo"}).WithTokenNames(map[string]string{"agents": "foo"}).AuthHandler(
+				http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					rw.Write([]byte("hello"))
+				}),
+			),
+		)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return &out, hook
+	}
+
+	t.Run("should log in the common log format", func(t *testing.T) {
+		out, hook := serve(AccessLogCommon)
+
+		require.Regexp(t, `^10\.0\.0\.1 - agents \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /hosts\?limit=5 HTTP/1\.1" 200 5\n$`, out.String())
+		require.Empty(t, hook.AllEntries(), "the line should not go through the logger")
+	})
+
+	t.Run("should log in the combined log format", func(t *testing.T) {
+		out, _ := serve(AccessLogCombined)
+
+		require.Regexp(t, `" 200 5 "http://example\.com" "agent \\"1\.0\\""\n$`, out.String())
+	})
+
+	t.Run("should not log if it is disabled", func(t *testing.T) {
+		out, _ := serve(AccessLogOff)
+
+		require.Empty(t, out.String())
+	})
+}
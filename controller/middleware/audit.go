@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/audit"
+)
+
+// AuditRecorder stores the entries of the audit log.
+type AuditRecorder interface {
+	Record(entry audit.Entry) error
+}
+
+// NewAuditMiddleware is a constructor for the AuditMiddleware struct.
+func NewAuditMiddleware(recorder AuditRecorder) *AuditMiddleware {
+	return &AuditMiddleware{recorder: recorder}
+}
+
+// AuditMiddleware records who accessed which route and host with which result.
+type AuditMiddleware struct {
+	recorder     AuditRecorder
+	adminRoutes  []string
+	publicRoutes []string
+}
+
+// WithAdminRoutes sets the names of the routes that are recorded as administration instead of by their method.
+// Returns the AuditMiddleware.
+func (am *AuditMiddleware) WithAdminRoutes(routeNames ...string) *AuditMiddleware {
+	am.adminRoutes = routeNames
+	return am
+}
+
+// WithPublicRoutes sets the names of the routes that need no authentication.
+// They are not recorded so that frequent probes do not fill the audit log.
+// Returns the AuditMiddleware.
+func (am *AuditMiddleware) WithPublicRoutes(routeNames ...string) *AuditMiddleware {
+	am.publicRoutes = routeNames
+	return am
+}
+
+// AuditHandler records every request after it got handled.
+// The principal is set by the AuthHandler, so this handler has to be added before it.
+// Failed authentications are recorded without a principal.
+func (am *AuditMiddleware) AuditHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		r, principal := withPrincipal(r)
+		sl := newStatusCodeLogger(rw)
+		next.ServeHTTP(sl, r)
+
+		routeName := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			routeName = route.GetName()
+		}
+		if isIncluded(am.publicRoutes, routeName) {
+			return
+		}
+		entry := audit.Entry{
+			Time:       start,
+			Principal:  *principal,
+			Action:     am.action(routeName, r.Method),
+			Route:      routeName,
+			Hostname:   mux.Vars(r)["hostname"],
+			Status:     sl.statusCode,
+			RemoteAddr: r.RemoteAddr,
+			RequestID:  RequestID(r),
+		}
+		if err := am.recorder.Record(entry); err != nil {
+			requestLog(r).Errorf("Could not write the audit log: %v\n", err)
+		}
+	})
+}
+
+// action returns what the request did.
+func (am *AuditMiddleware) action(routeName, method string) string {
+	if isIncluded(am.adminRoutes, routeName) {
+		return audit.ActionAdmin
+	}
+
+	switch method {
+	case http.MethodGet, http.MethodHead:
+		return audit.ActionRead
+	case http.MethodDelete:
+		return audit.ActionDelete
+	default:
+		return audit.ActionWrite
+	}
+}
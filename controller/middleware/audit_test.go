@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/stretchr/testify/require"
+)
+
+type recorderMock struct {
+	entries []audit.Entry
+}
+
+func (rm *recorderMock) Record(entry audit.Entry) error {
+	rm.entries = append(rm.entries, entry)
+	return nil
+}
+
+func TestAuditHandler(t *testing.T) {
+	newRouter := func(recorder AuditRecorder) *mux.Router {
+		router := mux.NewRouter()
+		ok := func(rw http.ResponseWriter, r *http.Request) {}
+		router.HandleFunc("/hosts/{hostname}", ok).Methods(http.MethodGet).Name("GetHost")
+		router.HandleFunc("/hosts/{hostname}", ok).Methods(http.MethodDelete).Name("DeleteHost")
+		router.HandleFunc("/hosts/{hostname}/merge", ok).Methods(http.MethodPost).Name("MergeHost")
+		router.HandleFunc("/healthz", ok).Methods(http.MethodGet).Name("GetHealth")
+		router.Use(NewAuditMiddleware(recorder).WithAdminRoutes("MergeHost").WithPublicRoutes("GetHealth").AuditHandler)
+		router.Use(NewAuthMiddleware([]string{"secret-token", "other-token"}).
+			WithPublicRoutes("GetHealth").
+			WithTokenNames(map[string]string{"agents": "secret-token"}).
+			AuthHandler)
+		return router
+	}
+	serve := func(router *mux.Router, method, path, token string) {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Token", token)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("should record the name of the token and the request", func(t *testing.T) {
+		recorder := &recorderMock{}
+
+		serve(newRouter(recorder), "DELETE", "/hosts/foo", "secret-token")
+
+		require.Len(t, recorder.entries, 1)
+		entry := recorder.entries[0]
+		require.Equal(t, "agents", entry.Principal)
+		require.Equal(t, audit.ActionDelete, entry.Action)
+		require.Equal(t, "DeleteHost", entry.Route)
+		require.Equal(t, "foo", entry.Hostname)
+		require.Equal(t, http.StatusOK, entry.Status)
+		require.False(t, entry.Time.IsZero())
+	})
+
+	t.Run("should record admin routes as administration", func(t *testing.T) {
+		recorder := &recorderMock{}
+
+		serve(newRouter(recorder), "POST", "/hosts/foo/merge", "secret-token")
+
+		require.Equal(t, audit.ActionAdmin, recorder.entries[0].Action)
+	})
+
+	t.Run("should identify unnamed tokens without the token", func(t *testing.T) {
+		recorder := &recorderMock{}
+
+		serve(newRouter(recorder), "GET", "/hosts/foo", "other-token")
+
+		require.Regexp(t, "^token:[0-9a-f]{8}$", recorder.entries[0].Principal)
+		require.NotContains(t, recorder.entries[0].Principal, "other-token")
+	})
+
+	t.Run("should not record public routes", func(t *testing.T) {
+		recorder := &recorderMock{}
+
+		serve(newRouter(recorder), "GET", "/healthz", "")
+
+		require.Empty(t, recorder.entries)
+	})
+
+	t.Run("should record failed authentications without a principal", func(t *testing.T) {
+		recorder := &recorderMock{}
+
+		serve(newRouter(recorder), "GET", "/hosts/foo", "wrong-token")
+
+		require.Equal(t, "", recorder.entries[0].Principal)
+		require.Equal(t, http.StatusUnauthorized, recorder.entries[0].Status)
+	})
+}
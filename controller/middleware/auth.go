@@ -1,10 +1,30 @@
 package middleware
 
-import "net/http"
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// AuthFailures counts the rejected requests of the AuthHandler, the AdminHandler and the SignatureHandler by the reason.
+// It is published with the expvar package.
+var AuthFailures = expvar.NewMap("authFailures")
 
 // AuthMiddleware is a struct to hold a array of valid tokens.
 type AuthMiddleware struct {
-	tokens []string
+	tokens             []string
+	adminTokens        []string
+	hostIdentityRoutes []string
+	publicRoutes       []string
+	// tokenNames maps a token to its name
+	tokenNames map[string]string
+	m          sync.RWMutex
 }
 
 // NewAuthMiddleware is a constructor for the AuthMiddleware struct.
@@ -12,21 +32,106 @@ func NewAuthMiddleware(tokens []string) *AuthMiddleware {
 	return &AuthMiddleware{tokens: tokens}
 }
 
+// WithAdminTokens sets the tokens that are allowed to access routes with the admin scope.
+// Admin tokens are also valid for all other routes.
+// Returns the AuthMiddleware.
+func (am *AuthMiddleware) WithAdminTokens(tokens []string) *AuthMiddleware {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	am.adminTokens = tokens
+	return am
+}
+
+// WithHostIdentityRoutes sets the names of the routes that clients may use with a verified TLS client certificate instead of a token.
+// The hostname of the route has to match the common name or a DNS name of the certificate.
+// Returns the AuthMiddleware.
+func (am *AuthMiddleware) WithHostIdentityRoutes(routeNames ...string) *AuthMiddleware {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	am.hostIdentityRoutes = routeNames
+	return am
+}
+
+// WithPublicRoutes sets the names of the routes that need no authentication like the probes of an orchestrator.
+// Returns the AuthMiddleware.
+func (am *AuthMiddleware) WithPublicRoutes(routeNames ...string) *AuthMiddleware {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	am.publicRoutes = routeNames
+	return am
+}
+
+// WithTokenNames sets the names of the tokens by which their clients show up in the audit log.
+// The map contains the token for every name.
+// Returns the AuthMiddleware.
+func (am *AuthMiddleware) WithTokenNames(names map[string]string) *AuthMiddleware {
+	am.SetTokenNames(names)
+	return am
+}
+
+// SetTokenNames replaces the names of the tokens while the middleware is in use.
+func (am *AuthMiddleware) SetTokenNames(names map[string]string) {
+	tokenNames := make(map[string]string, len(names))
+	for name, token := range names {
+		tokenNames[token] = name
+	}
+
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	am.tokenNames = tokenNames
+}
+
+// SetTokens replaces the valid tokens and admin tokens while the middleware is in use.
+func (am *AuthMiddleware) SetTokens(tokens, adminTokens []string) {
+	am.m.Lock()
+	defer am.m.Unlock()
+
+	am.tokens = tokens
+	am.adminTokens = adminTokens
+}
+
 // AuthHandler implements the handling of a request and checks if it is authorized.
 // It checks if the 'Token' header is set and if the token is valid.
 // If the header is missing it will return a http.StatusBadRequest and if the token isn't
 // valid it will return a http.StatusUnauthorized status code.
+// If the token is an admin token it will be marked inside the request context.
+// Requests without a token but with a verified TLS client certificate are authenticated by the hostname identity of the certificate.
+// Requests to public routes are passed through without authentication.
 func (am *AuthMiddleware) AuthHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if am.isPublic(r) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
 		tokens := r.Header["Token"]
 		if len(tokens) < 1 {
+			if identities := clientCertIdentities(r); len(identities) > 0 {
+				am.serveHostIdentity(rw, r, identities, next)
+				return
+			}
+			AuthFailures.Add("missingToken", 1)
 			http.Error(rw, "Missing 'Token' header", http.StatusBadRequest)
 			return
 		}
 		token := tokens[0]
-		if !am.isValid(token) {
+		valid, admin := am.lookup(token)
+		if valid {
+			setPrincipal(r, am.principal(token))
+		}
+		if admin {
+			next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), adminKey, true)))
+			return
+		}
+		if !valid {
+			AuthFailures.Add("invalidToken", 1)
 			http.Error(rw, "The token is not valid", http.StatusUnauthorized)
-			logPackage.Warnf("Login attempt with wrong token: '%s' from ip: '%s'\n", token, r.RemoteAddr)
+			// the token is not logged because it could be a valid token with a typo or a secret of another service
+			requestLog(r).Warnf("Login attempt with a wrong token from ip: '%s'\n", r.RemoteAddr)
 			return
 		}
 
@@ -34,8 +139,128 @@ func (am *AuthMiddleware) AuthHandler(next http.Handler) http.Handler {
 	})
 }
 
-func (am *AuthMiddleware) isValid(token string) bool {
-	for _, authToken := range am.tokens {
+// isPublic checks if the route of the request needs no authentication.
+func (am *AuthMiddleware) isPublic(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+
+	am.m.RLock()
+	defer am.m.RUnlock()
+	return isIncluded(am.publicRoutes, route.GetName())
+}
+
+// serveHostIdentity only lets the request through if the route is allowed for host identities
+// and its hostname matches one of the identities.
+func (am *AuthMiddleware) serveHostIdentity(rw http.ResponseWriter, r *http.Request, identities []string, next http.Handler) {
+	route := mux.CurrentRoute(r)
+	am.m.RLock()
+	allowed := route != nil && isIncluded(am.hostIdentityRoutes, route.GetName())
+	am.m.RUnlock()
+	if !allowed {
+		AuthFailures.Add("clientCertificate", 1)
+		http.Error(rw, "The client certificate is not allowed to access this route", http.StatusForbidden)
+		requestLog(r).Warnf("Access with the client certificate of '%s' to a route without host identity from ip: '%s'\n", identities[0], r.RemoteAddr)
+		return
+	}
+
+	hostname := mux.Vars(r)["hostname"]
+	if !isIncluded(identities, hostname) {
+		AuthFailures.Add("clientCertificate", 1)
+		http.Error(rw, fmt.Sprintf("The client certificate is not valid for the host '%s'", hostname), http.StatusForbidden)
+		requestLog(r).Warnf("Access with the client certificate of '%s' to the host '%s' from ip: '%s'\n", identities[0], hostname, r.RemoteAddr)
+		return
+	}
+
+	setPrincipal(r, "host:"+hostname)
+	next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), hostIdentityKey, hostname)))
+}
+
+// principal returns the name of the token.
+// Tokens without a name are identified by a short hash so that the token itself is never written anywhere.
+func (am *AuthMiddleware) principal(token string) string {
+	am.m.RLock()
+	name, found := am.tokenNames[token]
+	am.m.RUnlock()
+	if found {
+		return name
+	}
+
+	hash := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(hash[:4])
+}
+
+// withPrincipal returns the request with a place for its principal that gets filled by the AuthHandler.
+// Handlers before the AuthHandler can read the principal after the request got handled.
+// An already existing place is shared.
+func withPrincipal(r *http.Request) (*http.Request, *string) {
+	if p, ok := r.Context().Value(principalKey).(*string); ok {
+		return r, p
+	}
+	p := new(string)
+	return r.WithContext(context.WithValue(r.Context(), principalKey, p)), p
+}
+
+// setPrincipal stores the principal of the request if a handler before the AuthHandler asked for it.
+func setPrincipal(r *http.Request, principal string) {
+	if p, ok := r.Context().Value(principalKey).(*string); ok {
+		*p = principal
+	}
+}
+
+// clientCertIdentities returns the common name and the DNS names of the verified TLS client certificate.
+func clientCertIdentities(r *http.Request) []string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	identities := make([]string, 0, len(cert.DNSNames)+1)
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	return append(identities, cert.DNSNames...)
+}
+
+// HostIdentity returns the hostname of a request that was authenticated with a TLS client certificate.
+func HostIdentity(r *http.Request) (string, bool) {
+	hostname, ok := r.Context().Value(hostIdentityKey).(string)
+	return hostname, ok
+}
+
+// AdminHandler only lets requests through that got authenticated with an admin token by the AuthHandler.
+// All other requests get rejected with a http.StatusForbidden status code.
+func AdminHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if !IsAdmin(r) {
+			AuthFailures.Add("adminScope", 1)
+			http.Error(rw, "The token has no admin scope", http.StatusForbidden)
+			requestLog(r).Warnf("Access to an admin route without admin scope from ip: '%s'\n", r.RemoteAddr)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// IsAdmin checks if the request was authenticated with an admin token.
+func IsAdmin(r *http.Request) bool {
+	admin, ok := r.Context().Value(adminKey).(bool)
+	return ok && admin
+}
+
+// lookup checks if the token is valid and if it has the admin scope.
+func (am *AuthMiddleware) lookup(token string) (valid bool, admin bool) {
+	am.m.RLock()
+	defer am.m.RUnlock()
+
+	admin = isIncluded(am.adminTokens, token)
+	return admin || isIncluded(am.tokens, token), admin
+}
+
+func isIncluded(tokens []string, token string) bool {
+	for _, authToken := range tokens {
 		if token == authToken {
 			return true
 		}
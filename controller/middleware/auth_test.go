@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/require"
 )
 
@@ -76,4 +80,251 @@ func TestAuthHandler(t *testing.T) {
 		require.Equal(t, http.StatusOK, rr.Code)
 	})
 
+	t.Run("admin token provided", func(t *testing.T) {
+		authMiddleware := NewAuthMiddleware([]string{"foo"}).WithAdminTokens([]string{"bar"})
+		req, err := http.NewRequest("GET", "/hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Token", "bar")
+
+		rr := httptest.NewRecorder()
+		handler := http.Handler(
+			authMiddleware.AuthHandler(
+				http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					require.True(t, IsAdmin(r))
+					rw.WriteHeader(http.StatusOK)
+				}),
+			),
+		)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("normal token provided has no admin scope", func(t *testing.T) {
+		authMiddleware := NewAuthMiddleware([]string{"foo"}).WithAdminTokens([]string{"bar"})
+		req, err := http.NewRequest("GET", "/hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Token", "foo")
+
+		rr := httptest.NewRecorder()
+		handler := http.Handler(
+			authMiddleware.AuthHandler(
+				http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					require.False(t, IsAdmin(r))
+					rw.WriteHeader(http.StatusOK)
+				}),
+			),
+		)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+}
+
+func TestAdminHandler(t *testing.T) {
+	t.Run("normal token gets forbidden", func(t *testing.T) {
+		authMiddleware := NewAuthMiddleware([]string{"foo"}).WithAdminTokens([]string{"bar"})
+		req, err := http.NewRequest("DELETE", "/hosts/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Token", "foo")
+
+		rr := httptest.NewRecorder()
+		handler := http.Handler(
+			authMiddleware.AuthHandler(
+				AdminHandler(
+					http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+						t.Error("Should have bin blocked by the middleware")
+					}),
+				),
+			),
+		)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, "The token has no admin scope\n", rr.Body.String())
+	})
+
+	t.Run("admin token passes", func(t *testing.T) {
+		authMiddleware := NewAuthMiddleware([]string{"foo"}).WithAdminTokens([]string{"bar"})
+		req, err := http.NewRequest("DELETE", "/hosts/foo", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Token", "bar")
+
+		rr := httptest.NewRecorder()
+		handler := http.Handler(
+			authMiddleware.AuthHandler(
+				AdminHandler(
+					http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+						rw.WriteHeader(http.StatusNoContent)
+					}),
+				),
+			),
+		)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusNoContent, rr.Code)
+	})
+}
+
+func TestAuthMiddleware_SetTokens(t *testing.T) {
+	t.Run("replaced token is not valid anymore", func(t *testing.T) {
+		authMiddleware := NewAuthMiddleware([]string{"foo"})
+		authMiddleware.SetTokens([]string{"bar"}, []string{})
+		req, err := http.NewRequest("GET", "/hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add("Token", "foo")
+
+		rr := httptest.NewRecorder()
+		handler := http.Handler(
+			authMiddleware.AuthHandler(
+				http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					t.Error("Should have bin blocked by the middleware")
+				}),
+			),
+		)
+
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+}
+
+func TestAuthHandler_PublicRoutes(t *testing.T) {
+	newRouter := func() *mux.Router {
+		router := mux.NewRouter()
+		ok := func(rw http.ResponseWriter, r *http.Request) {}
+		router.HandleFunc("/healthz", ok).Methods(http.MethodGet).Name("GetHealth")
+		router.HandleFunc("/hosts", ok).Methods(http.MethodGet).Name("GetHosts")
+		router.Use(NewAuthMiddleware([]string{"foo"}).WithPublicRoutes("GetHealth").AuthHandler)
+		return router
+	}
+
+	t.Run("public route passes without a token", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/healthz", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("other routes still need a token", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+}
+
+func TestAuthHandler_HostIdentity(t *testing.T) {
+	// newRouter routes like the server so that the route name and the hostname are known to the middleware.
+	newRouter := func(authMiddleware *AuthMiddleware) *mux.Router {
+		router := mux.NewRouter()
+		handler := func(rw http.ResponseWriter, r *http.Request) {
+			hostname, ok := HostIdentity(r)
+			require.True(t, ok)
+			rw.Write([]byte(hostname))
+		}
+		router.HandleFunc("/hosts/{hostname}/stats", handler).Methods(http.MethodPost).Name("PostStats")
+		router.HandleFunc("/hosts/{hostname}/stats", handler).Methods(http.MethodGet).Name("GetStats")
+		router.Use(authMiddleware.AuthHandler)
+		return router
+	}
+	// withClientCert adds a verified client certificate to the request.
+	withClientCert := func(req *http.Request, commonName string, dnsNames ...string) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}, DNSNames: dnsNames}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	t.Run("client certificate for the own host passes", func(t *testing.T) {
+		router := newRouter(NewAuthMiddleware([]string{"foo"}).WithHostIdentityRoutes("PostStats"))
+		req, err := http.NewRequest("POST", "/hosts/web-1/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, withClientCert(req, "web-1"))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "web-1", rr.Body.String())
+	})
+
+	t.Run("client certificate with a matching DNS name passes", func(t *testing.T) {
+		router := newRouter(NewAuthMiddleware([]string{"foo"}).WithHostIdentityRoutes("PostStats"))
+		req, err := http.NewRequest("POST", "/hosts/web-1/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, withClientCert(req, "agent", "web-0", "web-1"))
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("client certificate for another host gets forbidden", func(t *testing.T) {
+		router := newRouter(NewAuthMiddleware([]string{"foo"}).WithHostIdentityRoutes("PostStats"))
+		req, err := http.NewRequest("POST", "/hosts/web-2/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, withClientCert(req, "web-1"))
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, "The client certificate is not valid for the host 'web-2'\n", rr.Body.String())
+	})
+
+	t.Run("client certificate on another route gets forbidden", func(t *testing.T) {
+		router := newRouter(NewAuthMiddleware([]string{"foo"}).WithHostIdentityRoutes("PostStats"))
+		req, err := http.NewRequest("GET", "/hosts/web-1/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, withClientCert(req, "web-1"))
+
+		require.Equal(t, http.StatusForbidden, rr.Code)
+		require.Equal(t, "The client certificate is not allowed to access this route\n", rr.Body.String())
+	})
+
+	t.Run("unverified client certificate needs a token", func(t *testing.T) {
+		router := newRouter(NewAuthMiddleware([]string{"foo"}).WithHostIdentityRoutes("PostStats"))
+		req, err := http.NewRequest("POST", "/hosts/web-1/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.TLS = &tls.ConnectionState{}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
 }
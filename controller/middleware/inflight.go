@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// NewInFlightMiddleware is a constructor for the InFlightMiddleware struct.
+func NewInFlightMiddleware() *InFlightMiddleware {
+	return &InFlightMiddleware{}
+}
+
+// InFlightMiddleware tracks the running handlers so that a shutdown can wait for them
+// even after their connections got closed.
+type InFlightMiddleware struct {
+	running int
+	// idle is closed when no handler is running anymore
+	idle chan struct{}
+	m    sync.Mutex
+}
+
+// InFlightHandler counts the request as running until the next handler returned.
+// This handler should be added at the beginning of a handler chain.
+func (im *InFlightMiddleware) InFlightHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		im.start()
+		defer im.done()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+func (im *InFlightMiddleware) start() {
+	im.m.Lock()
+	defer im.m.Unlock()
+
+	if im.running == 0 {
+		im.idle = make(chan struct{})
+	}
+	im.running++
+}
+
+func (im *InFlightMiddleware) done() {
+	im.m.Lock()
+	defer im.m.Unlock()
+
+	im.running--
+	if im.running == 0 {
+		close(im.idle)
+	}
+}
+
+// Wait blocks until no handler is running anymore.
+// Returns the error of the context if it is done before.
+func (im *InFlightMiddleware) Wait(ctx context.Context) error {
+	im.m.Lock()
+	if im.running == 0 {
+		im.m.Unlock()
+		return nil
+	}
+	idle := im.idle
+	im.m.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInFlightHandler(t *testing.T) {
+	t.Run("should wait for the running handlers", func(t *testing.T) {
+		im := NewInFlightMiddleware()
+		started := make(chan struct{})
+		release := make(chan struct{})
+		handler := im.InFlightHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+		}))
+		go handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, im.Wait(ctx), context.DeadlineExceeded)
+
+		close(release)
+		require.NoError(t, im.Wait(context.Background()))
+	})
+
+	t.Run("should not wait without running handlers", func(t *testing.T) {
+		im := NewInFlightMiddleware()
+		handler := im.InFlightHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(t, im.Wait(ctx))
+	})
+}
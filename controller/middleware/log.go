@@ -10,6 +10,7 @@ import (
 type statusCodeLogger struct {
 	http.ResponseWriter
 	statusCode int
+	size       int
 }
 
 func newStatusCodeLogger(rw http.ResponseWriter) *statusCodeLogger {
@@ -21,6 +22,12 @@ func (sl *statusCodeLogger) WriteHeader(code int) {
 	sl.ResponseWriter.WriteHeader(code)
 }
 
+func (sl *statusCodeLogger) Write(b []byte) (int, error) {
+	n, err := sl.ResponseWriter.Write(b)
+	sl.size += n
+	return n, err
+}
+
 // RequestTimeLoggingHandler logs the time a request needs to be processed.
 // This handler should be add at the beginning of a handler chain.
 // Every request will be logged with the Trace logging level.
@@ -30,7 +37,7 @@ func RequestTimeLoggingHandler(next http.Handler) http.Handler {
 		requestBeginn := time.Now()
 		next.ServeHTTP(sl, r)
 		requestDuration := time.Since(requestBeginn)
-		logPackage.WithFields(logrus.Fields{
+		requestLog(r).WithFields(logrus.Fields{
 			"RequestTime":   requestDuration.Milliseconds(),
 			"RequestPath":   r.URL.String(),
 			"RequestMethod": r.Method,
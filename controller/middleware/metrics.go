@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// RequestObserver records the metrics of the handled requests.
+type RequestObserver interface {
+	ObserveRequest(routeName, method string, statusCode int, duration time.Duration)
+}
+
+// NewMetricsMiddleware is a constructor for the MetricsMiddleware struct.
+func NewMetricsMiddleware(observer RequestObserver) *MetricsMiddleware {
+	return &MetricsMiddleware{observer: observer}
+}
+
+// MetricsMiddleware counts the requests and measures their duration by their route.
+type MetricsMiddleware struct {
+	observer RequestObserver
+}
+
+// MetricsHandler passes every handled request to the RequestObserver.
+// This handler should be added at the beginning of a handler chain.
+func (mm *MetricsMiddleware) MetricsHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sl := newStatusCodeLogger(rw)
+		next.ServeHTTP(sl, r)
+
+		routeName := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			routeName = route.GetName()
+		}
+		mm.observer.ObserveRequest(routeName, r.Method, sl.statusCode, time.Since(start))
+	})
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+type observedRequest struct {
+	routeName  string
+	method     string
+	statusCode int
+}
+
+type requestObserverMock struct {
+	requests []observedRequest
+}
+
+func (rom *requestObserverMock) ObserveRequest(routeName, method string, statusCode int, duration time.Duration) {
+	rom.requests = append(rom.requests, observedRequest{routeName, method, statusCode})
+}
+
+func TestMetricsHandler(t *testing.T) {
+	t.Run("should observe the requests by their route name", func(t *testing.T) {
+		observer := &requestObserverMock{}
+		router := mux.NewRouter()
+		router.HandleFunc("/hosts/{hostname}", func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusNotFound)
+		}).Methods(http.MethodGet).Name("GetHost")
+		router.Use(NewMetricsMiddleware(observer).MetricsHandler)
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hosts/foo", nil))
+
+		require.Equal(t, []observedRequest{{"GetHost", http.MethodGet, http.StatusNotFound}}, observer.requests)
+	})
+
+	t.Run("should observe the status code of a recovered panic", func(t *testing.T) {
+		observer := &requestObserverMock{}
+		router := mux.NewRouter()
+		router.HandleFunc("/", func(rw http.ResponseWriter, r *http.Request) {
+			panic("foo")
+		}).Name("Root")
+		router.Use(NewMetricsMiddleware(observer).MetricsHandler)
+		router.Use(PanicRecoverHandler)
+
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+		require.Equal(t, []observedRequest{{"Root", http.MethodGet, http.StatusInternalServerError}}, observer.requests)
+	})
+}
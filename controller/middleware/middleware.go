@@ -5,3 +5,14 @@ import (
 )
 
 var logPackage = log.WithField("Package", "middleware")
+
+type contextKey int
+
+const (
+	adminKey contextKey = iota
+	hostIdentityKey
+	principalKey
+	requestIDKey
+	loggerKey
+	parentSpanKey
+)
@@ -1,6 +1,13 @@
 package middleware
 
-import "net/http"
+import (
+	"expvar"
+	"net/http"
+)
+
+// PanicsRecovered counts the panics recovered by the PanicRecoverHandler.
+// It is published with the expvar package.
+var PanicsRecovered = expvar.NewInt("panicsRecovered")
 
 // PanicRecoverHandler is a Handler to recover from any panic that happend down the handler chain.
 // If a panic occurs it will generate an error log.
@@ -8,7 +15,8 @@ func PanicRecoverHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if err := recover(); err != nil {
-				logPackage.Errorf("Recovered from a panic: %+v\n", err)
+				PanicsRecovered.Add(1)
+				requestLog(r).Errorf("Recovered from a panic: %+v\n", err)
 				http.Error(w, "Something went wrong.", 500)
 			}
 		}()
@@ -0,0 +1,213 @@
+package middleware
+
+import (
+	"expvar"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ThrottledRequests counts the requests rejected by a RateLimitMiddleware by the route name.
+// It is published with the expvar package.
+var ThrottledRequests = expvar.NewMap("throttledRequests")
+
+// bucketCleanupInterval is the interval in which the buckets of clients that are no longer limited get removed.
+const bucketCleanupInterval = time.Minute
+
+// RateLimitKey defines what identifies a client for the rate limit.
+type RateLimitKey string
+
+// The ways a client can be identified.
+const (
+	KeyByToken      RateLimitKey = "token"
+	KeyByIP         RateLimitKey = "ip"
+	KeyByTokenAndIP RateLimitKey = "tokenAndIP"
+)
+
+// Limit is the rate of a token bucket.
+// A client can do Burst requests at once and gets Rate new requests per second.
+// A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l Limit) unlimited() bool {
+	return l.Rate <= 0
+}
+
+// bucket holds the requests a client has left.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take refills the bucket since the last call and takes one request out of it.
+// It returns the time until the next request is allowed if the bucket is empty.
+func (b *bucket) take(limit Limit, now time.Time) (bool, time.Duration) {
+	b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// NewRateLimitMiddleware is a constructor for the RateLimitMiddleware struct.
+// The default limit applies to all routes without an own limit.
+func NewRateLimitMiddleware(key RateLimitKey, defaultLimit Limit) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		key:          key,
+		defaultLimit: defaultLimit,
+		routeLimits:  make(map[string]Limit),
+		buckets:      make(map[string]*bucket),
+		now:          time.Now,
+	}
+}
+
+// RateLimitMiddleware limits the requests of a client with token buckets.
+// Every route with an own limit has its own bucket per client, all other routes share one.
+type RateLimitMiddleware struct {
+	key          RateLimitKey
+	defaultLimit Limit
+	routeLimits  map[string]Limit
+	buckets      map[string]*bucket
+	lastCleanup  time.Time
+	now          func() time.Time
+	m            sync.Mutex
+}
+
+// WithRouteLimit sets the limit for the route with the name.
+// Returns the RateLimitMiddleware.
+func (rl *RateLimitMiddleware) WithRouteLimit(routeName string, limit Limit) *RateLimitMiddleware {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	rl.routeLimits[routeName] = limit
+	return rl
+}
+
+// SetLimits replaces the key and all limits while the middleware is in use.
+// All clients start with a full bucket afterwards.
+func (rl *RateLimitMiddleware) SetLimits(key RateLimitKey, defaultLimit Limit, routeLimits map[string]Limit) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	rl.key = key
+	rl.defaultLimit = defaultLimit
+	rl.routeLimits = make(map[string]Limit, len(routeLimits))
+	for routeName, limit := range routeLimits {
+		rl.routeLimits[routeName] = limit
+	}
+	rl.buckets = make(map[string]*bucket)
+}
+
+// RateLimitHandler rejects the requests of clients that are over their limit with a http.StatusTooManyRequests status code.
+// It has to run before the AuthHandler to also throttle requests with invalid tokens.
+// The 'Retry-After' header contains the seconds until the next request is allowed.
+func (rl *RateLimitMiddleware) RateLimitHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		routeName := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			routeName = route.GetName()
+		}
+
+		allowed, retryAfter := rl.allow(routeName, r)
+		if !allowed {
+			ThrottledRequests.Add(routeName, 1)
+			rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			http.Error(rw, "Too many requests", http.StatusTooManyRequests)
+			requestLog(r).Warnf("Throttled a request to the route '%s' from ip: '%s'\n", routeName, r.RemoteAddr)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// allow takes a request from the bucket of the client for the route.
+func (rl *RateLimitMiddleware) allow(routeName string, r *http.Request) (bool, time.Duration) {
+	rl.m.Lock()
+	defer rl.m.Unlock()
+
+	limit, found := rl.routeLimits[routeName]
+	if !found {
+		limit = rl.defaultLimit
+		routeName = ""
+	}
+	if limit.unlimited() {
+		return true, 0
+	}
+
+	now := rl.now()
+	rl.forgetFullBuckets(now)
+
+	key := fmt.Sprintf("%s\x00%s", routeName, rl.clientKey(r))
+	b, found := rl.buckets[key]
+	if !found {
+		b = &bucket{tokens: float64(limit.Burst), last: now}
+		rl.buckets[key] = b
+	}
+	return b.take(limit, now)
+}
+
+// clientKey identifies the client of the request.
+// The RateLimitHandler runs before the authentication, so clients with a TLS client certificate are identified
+// by the first identity of the certificate instead of a token.
+// Clients of a Unix socket have no ip and are identified by their token instead, otherwise they would share one bucket.
+func (rl *RateLimitMiddleware) clientKey(r *http.Request) string {
+	token := r.Header.Get("Token")
+	if identities := clientCertIdentities(r); len(identities) > 0 && token == "" {
+		token = "host:" + identities[0]
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = "unix:" + token
+	}
+
+	switch rl.key {
+	case KeyByIP:
+		return ip
+	case KeyByTokenAndIP:
+		return token + "\x00" + ip
+	default:
+		return token
+	}
+}
+
+// forgetFullBuckets removes the buckets that would be full again because they behave like new ones.
+// It only runs once per bucketCleanupInterval and the caller has to hold the lock.
+func (rl *RateLimitMiddleware) forgetFullBuckets(now time.Time) {
+	if now.Sub(rl.lastCleanup) < bucketCleanupInterval {
+		return
+	}
+	rl.lastCleanup = now
+
+	maxRefill := 0.0
+	for _, limit := range append([]Limit{rl.defaultLimit}, limitsOf(rl.routeLimits)...) {
+		if !limit.unlimited() {
+			maxRefill = math.Max(maxRefill, float64(limit.Burst)/limit.Rate)
+		}
+	}
+	for key, b := range rl.buckets {
+		if now.Sub(b.last).Seconds() >= maxRefill {
+			delete(rl.buckets, key)
+		}
+	}
+}
+
+func limitsOf(routeLimits map[string]Limit) []Limit {
+	limits := make([]Limit, 0, len(routeLimits))
+	for _, limit := range routeLimits {
+		limits = append(limits, limit)
+	}
+	return limits
+}
@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitHandler(t *testing.T) {
+	newRouter := func(rl *RateLimitMiddleware) *mux.Router {
+		router := mux.NewRouter()
+		ok := func(rw http.ResponseWriter, r *http.Request) {}
+		router.HandleFunc("/hosts/{hostname}/stats", ok).Methods(http.MethodPost).Name("PostStats")
+		router.HandleFunc("/hosts/{hostname}/stats", ok).Methods(http.MethodGet).Name("GetStats")
+		router.Use(rl.RateLimitHandler)
+		return router
+	}
+	serve := func(router *mux.Router, method, token, remoteAddr string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/hosts/foo/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Token", token)
+		req.RemoteAddr = remoteAddr
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should reject requests over the burst with the time to wait", func(t *testing.T) {
+		now := time.Unix(0, 0)
+		rl := NewRateLimitMiddleware(KeyByToken, Limit{Rate: 0.5, Burst: 2})
+		rl.now = func() time.Time { return now }
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		rr := serve(router, "GET", "foo", "1.1.1.1:1")
+		require.Equal(t, http.StatusTooManyRequests, rr.Code)
+		require.Equal(t, "2", rr.Header().Get("Retry-After"))
+
+		now = now.Add(2 * time.Second)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+	})
+
+	t.Run("should limit every token on its own", func(t *testing.T) {
+		rl := NewRateLimitMiddleware(KeyByToken, Limit{Rate: 0.01, Burst: 1})
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "bar", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(router, "GET", "foo", "2.2.2.2:1").Code)
+	})
+
+	t.Run("should limit every ip on its own", func(t *testing.T) {
+		rl := NewRateLimitMiddleware(KeyByIP, Limit{Rate: 0.01, Burst: 1})
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "2.2.2.2:1").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(router, "GET", "bar", "1.1.1.1:2").Code)
+	})
+
+	t.Run("should limit every token of a unix socket on its own", func(t *testing.T) {
+		rl := NewRateLimitMiddleware(KeyByIP, Limit{Rate: 0.01, Burst: 1})
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "@").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "bar", "@").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "baz", "").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(router, "GET", "foo", "").Code)
+	})
+
+	t.Run("should use the limit of the route", func(t *testing.T) {
+		rl := NewRateLimitMiddleware(KeyByToken, Limit{}).WithRouteLimit("PostStats", Limit{Rate: 0.01, Burst: 1})
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "POST", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(router, "POST", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+	})
+
+	t.Run("should apply new limits at runtime", func(t *testing.T) {
+		rl := NewRateLimitMiddleware(KeyByToken, Limit{Rate: 0.01, Burst: 1})
+		router := newRouter(rl)
+
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+		require.Equal(t, http.StatusTooManyRequests, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+
+		rl.SetLimits(KeyByToken, Limit{}, nil)
+		require.Equal(t, http.StatusOK, serve(router, "GET", "foo", "1.1.1.1:1").Code)
+	})
+}
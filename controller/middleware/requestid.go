@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// RequestIDHeader is the header with the ID of a request.
+	RequestIDHeader = "X-Request-ID"
+	// maxRequestIDLength is the longest ID of a client that is accepted.
+	maxRequestIDLength = 128
+)
+
+// RequestIDHandler gives every request an ID and a logger with it inside the request context.
+// The ID of the 'X-Request-ID' header is used if the client sent a valid one, otherwise a new one gets generated.
+// The ID is returned in the 'X-Request-ID' header of the response.
+// This handler should be added at the beginning of a handler chain.
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = newRequestID()
+		}
+
+		rw.Header().Set(RequestIDHeader, requestID)
+		ctx := context.WithValue(r.Context(), requestIDKey, requestID)
+		ctx = context.WithValue(ctx, loggerKey, log.WithField("RequestID", requestID))
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// RequestID returns the ID of the request given by the RequestIDHandler.
+func RequestID(r *http.Request) string {
+	requestID, _ := r.Context().Value(requestIDKey).(string)
+	return requestID
+}
+
+// Logger returns the logger of the request with its ID.
+// Requests that did not pass the RequestIDHandler get a logger without an ID.
+func Logger(r *http.Request) *log.Entry {
+	if logger, ok := r.Context().Value(loggerKey).(*log.Entry); ok {
+		return logger
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// requestLog returns the logger of the request with the fields of the package.
+func requestLog(r *http.Request) *log.Entry {
+	return Logger(r).WithFields(logPackage.Data)
+}
+
+// validRequestID checks if the ID of a client is short and only contains printable ASCII characters.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID generates a random ID.
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		logPackage.Errorf("Could not generate a request ID: %v\n", err)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestIDHandler(t *testing.T) {
+	serve := func(requestID string, next http.HandlerFunc) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", "/hosts", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+
+		rr := httptest.NewRecorder()
+		RequestIDHandler(next).ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should use the ID of the client", func(t *testing.T) {
+		var got string
+		rr := serve("abc-123", func(rw http.ResponseWriter, r *http.Request) { got = RequestID(r) })
+
+		require.Equal(t, "abc-123", got)
+		require.Equal(t, "abc-123", rr.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("should generate an ID without a valid one of the client", func(t *testing.T) {
+		for _, requestID := range []string{"", "with space", strings.Repeat("a", 129)} {
+			var got string
+			rr := serve(requestID, func(rw http.ResponseWriter, r *http.Request) { got = RequestID(r) })
+
+			require.Regexp(t, "^[0-9a-f]{32}$", got)
+			require.Equal(t, got, rr.Header().Get(RequestIDHeader))
+		}
+	})
+
+	t.Run("should log the panic with the ID", func(t *testing.T) {
+		hook := test.NewGlobal()
+		defer hook.Reset()
+
+		rr := serve("abc-123", func(rw http.ResponseWriter, r *http.Request) {
+			PanicRecoverHandler(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				panic("boom")
+			})).ServeHTTP(rw, r)
+		})
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+		entry := hook.LastEntry()
+		require.NotNil(t, entry)
+		require.Equal(t, logrus.ErrorLevel, entry.Level)
+		require.Equal(t, "abc-123", entry.Data["RequestID"])
+		require.Equal(t, "middleware", entry.Data["Package"])
+	})
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/signature"
+)
+
+// SignatureMiddleware verifies the HMAC signature of the requests to specific routes.
+type SignatureMiddleware struct {
+	verifier *signature.Verifier
+	routes   []string
+}
+
+// NewSignatureMiddleware is a constructor for the SignatureMiddleware struct.
+// Only requests to the routes with the given names need a signature.
+func NewSignatureMiddleware(verifier *signature.Verifier, routeNames ...string) *SignatureMiddleware {
+	return &SignatureMiddleware{verifier: verifier, routes: routeNames}
+}
+
+// SignatureHandler rejects requests to the signed routes with a missing or invalid signature with a http.StatusUnauthorized status code.
+// Requests authenticated by a TLS client certificate can not be replayed and need no signature.
+func (sm *SignatureMiddleware) SignatureHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		route := mux.CurrentRoute(r)
+		if route == nil || !isIncluded(sm.routes, route.GetName()) {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		if _, ok := HostIdentity(r); ok {
+			next.ServeHTTP(rw, r)
+			return
+		}
+
+		if err := sm.verifier.Verify(r); err != nil {
+			AuthFailures.Add("signature", 1)
+			http.Error(rw, err.Error(), http.StatusUnauthorized)
+			requestLog(r).Warnf("Request with a rejected signature from ip: '%s': %v\n", r.RemoteAddr, err)
+			return
+		}
+
+		next.ServeHTTP(rw, r)
+	})
+}
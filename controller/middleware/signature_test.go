@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/signature"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignatureHandler(t *testing.T) {
+	newRouter := func() *mux.Router {
+		router := mux.NewRouter()
+		ok := func(rw http.ResponseWriter, r *http.Request) {}
+		router.HandleFunc("/hosts/{hostname}/stats", ok).Methods(http.MethodPost).Name("PostStats")
+		router.HandleFunc("/hosts/{hostname}/stats", ok).Methods(http.MethodGet).Name("GetStats")
+		router.Use(NewSignatureMiddleware(signature.NewVerifier([]byte("secret")), "PostStats").SignatureHandler)
+		return router
+	}
+
+	t.Run("signed request passes", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/hosts/foo/stats", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		require.NoError(t, signature.Sign(req, []byte("secret")))
+
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("unsigned request gets rejected", func(t *testing.T) {
+		req, err := http.NewRequest("POST", "/hosts/foo/stats", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusUnauthorized, rr.Code)
+		require.Equal(t, signature.ErrMissingSignature.Error()+"\n", rr.Body.String())
+	})
+
+	t.Run("other routes need no signature", func(t *testing.T) {
+		req, err := http.NewRequest("GET", "/hosts/foo/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		newRouter().ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+	})
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/hamburghammer/gsave/controller/middleware"
+
+// NewTracingMiddleware is a constructor for the TracingMiddleware struct.
+func NewTracingMiddleware(provider trace.TracerProvider) *TracingMiddleware {
+	return &TracingMiddleware{tracer: provider.Tracer(tracerName), propagator: propagation.TraceContext{}}
+}
+
+// TracingMiddleware records the requests and the middlewares as OpenTelemetry spans.
+type TracingMiddleware struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// TracingHandler records every request as server span named by its route.
+// The trace of the W3C 'traceparent' header of the agent is continued.
+// This handler should be added after the RequestIDHandler.
+func (tm *TracingMiddleware) TracingHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		routeName, pathTemplate := "", ""
+		if route := mux.CurrentRoute(r); route != nil {
+			routeName = route.GetName()
+			pathTemplate, _ = route.GetPathTemplate()
+		}
+
+		ctx := tm.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		attributes := semconv.HTTPServerAttributesFromHTTPRequest("gsave", pathTemplate, r)
+		attributes = append(attributes, attribute.String("gsave.request_id", RequestID(r)))
+		if hostname, ok := mux.Vars(r)["hostname"]; ok {
+			attributes = append(attributes, attribute.String("gsave.hostname", hostname))
+		}
+		ctx, span := tm.tracer.Start(ctx, routeName, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+		defer span.End()
+
+		sl := newStatusCodeLogger(rw)
+		next.ServeHTTP(sl, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sl.statusCode)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(sl.statusCode))
+	})
+}
+
+// Traced records the middleware as span from its start until it calls the next handler or rejects the request.
+// The next handlers get the span of the request as parent again.
+func (tm *TracingMiddleware) Traced(name string, mw mux.MiddlewareFunc) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		handler := mw(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			trace.SpanFromContext(r.Context()).End()
+			parent, _ := r.Context().Value(parentSpanKey).(trace.Span)
+			next.ServeHTTP(rw, r.WithContext(trace.ContextWithSpan(r.Context(), parent)))
+		}))
+
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), parentSpanKey, trace.SpanFromContext(r.Context()))
+			ctx, span := tm.tracer.Start(ctx, "middleware."+name)
+			defer span.End()
+
+			handler.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingHandler(t *testing.T) {
+	var handlerSpan trace.SpanContext
+	newRouter := func(recorder *tracetest.SpanRecorder) *mux.Router {
+		tm := NewTracingMiddleware(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		router := mux.NewRouter()
+		router.HandleFunc("/hosts/{hostname}/stats", func(rw http.ResponseWriter, r *http.Request) {
+			handlerSpan = trace.SpanContextFromContext(r.Context())
+			rw.WriteHeader(http.StatusCreated)
+		}).Methods(http.MethodPost).Name("PostStats")
+		router.Use(tm.TracingHandler)
+		router.Use(tm.Traced("auth", NewAuthMiddleware([]string{"foo"}).AuthHandler))
+		return router
+	}
+	serve := func(router *mux.Router, token string, header http.Header) {
+		req, err := http.NewRequest("POST", "/hosts/foo/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("Token", token)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	t.Run("should continue the trace of the traceparent header", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+		header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+
+		serve(newRouter(recorder), "foo", header)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		request := spans[1]
+		require.Equal(t, "PostStats", request.Name())
+		require.Equal(t, trace.SpanKindServer, request.SpanKind())
+		require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", request.SpanContext().TraceID().String())
+		require.Equal(t, "00f067aa0ba902b7", request.Parent().SpanID().String())
+		require.True(t, request.Parent().IsRemote())
+	})
+
+	t.Run("should record the middleware as child of the request and give the handler the request span", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+
+		serve(newRouter(recorder), "foo", nil)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		require.Equal(t, "middleware.auth", spans[0].Name())
+		require.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+		require.Equal(t, codes.Unset, spans[1].Status().Code)
+		require.Equal(t, spans[1].SpanContext().SpanID(), handlerSpan.SpanID())
+	})
+
+	t.Run("should mark rejected requests", func(t *testing.T) {
+		recorder := tracetest.NewSpanRecorder()
+
+		serve(newRouter(recorder), "bar", nil)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		require.Equal(t, "middleware.auth", spans[0].Name())
+		require.Contains(t, spans[1].Attributes(), semconv.HTTPStatusCodeKey.Int(http.StatusUnauthorized))
+	})
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/db"
+)
+
+// NewProcessesRouter is a constructor for the ProcessesRouter.
+func NewProcessesRouter(db db.HostDB) *ProcessesRouter {
+	return &ProcessesRouter{db: db}
+}
+
+// ProcessesRouter represents the controller for the routes to query processes across all hosts.
+type ProcessesRouter struct {
+	subrouter *mux.Router
+	db        db.HostDB
+}
+
+// HostProcesses are the processes of a host from its latest stats.
+type HostProcesses struct {
+	Hostname  string       `json:"hostname"`
+	Date      time.Time    `json:"date"`
+	Processes []db.Process `json:"processes"`
+}
+
+// Register registers all routes to the given subrouter.
+func (pr *ProcessesRouter) Register(subrouter *mux.Router) {
+	pr.subrouter = subrouter
+	subrouter.HandleFunc("", pr.GetProcesses).Methods(http.MethodGet).Name("GetProcesses")
+}
+
+// GetPrefix returns the the pre route for this controller.
+func (pr *ProcessesRouter) GetPrefix() string {
+	return "/processes"
+}
+
+// GetRouteName returns the Name of this controller.
+func (pr *ProcessesRouter) GetRouteName() string {
+	return "Processes"
+}
+
+// GetProcesses is a HandleFunc to find all hosts that run a process with the 'name' from the query.
+// For every host the matching processes of the latest stats are returned.
+func (pr *ProcessesRouter) GetProcesses(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		http.Error(w, "Missing the query param 'name'", http.StatusBadRequest)
+		logBadRequest(r).Error("Process query without a name")
+		return
+	}
+
+	hostDB := requestDB(pr.db, r)
+	found := make([]HostProcesses, 0)
+	var lookupErr error
+	err := db.ForEachHost(hostDB, func(host db.HostInfo) bool {
+		stats, err := hostDB.GetStatsByHostname(host.Hostname, db.Pagination{Skip: 0, Limit: 1})
+		if err != nil {
+			if errors.Is(err, db.ErrHostNotFound) {
+				return true
+			}
+			lookupErr = err
+			return false
+		}
+		if len(stats) == 0 {
+			return true
+		}
+
+		processes := make([]db.Process, 0)
+		for _, process := range stats[0].Processes {
+			if process.Name == name {
+				processes = append(processes, process)
+			}
+		}
+		if len(processes) > 0 {
+			found = append(found, HostProcesses{Hostname: host.Hostname, Date: stats[0].Date, Processes: processes})
+		}
+		return true
+	})
+	if err == nil {
+		err = lookupErr
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		logInternalServerError(r).Error(err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
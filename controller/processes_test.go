@@ -0,0 +1,95 @@
+package controller_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hamburghammer/gsave/controller"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetProcesses(t *testing.T) {
+	t.Run("finds the processes on all hosts", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetHosts([]db.HostInfo{{Hostname: "foo"}, {Hostname: "bar"}})
+		hostDB.SetStatsByHostname([]db.Stats{{Processes: []db.Process{{Name: "postgres", Pid: 1}, {Name: "nginx", Pid: 2}}}})
+		processesRouter := controller.NewProcessesRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/processes?name=postgres", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(processesRouter.GetProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var gotBody []controller.HostProcesses
+		err = json.NewDecoder(rr.Body).Decode(&gotBody)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []controller.HostProcesses{
+			{Hostname: "foo", Processes: []db.Process{{Name: "postgres", Pid: 1}}},
+			{Hostname: "bar", Processes: []db.Process{{Name: "postgres", Pid: 1}}},
+		}
+		require.Equal(t, want, gotBody)
+	})
+
+	t.Run("returns an empty list on an empty db", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		hostDB.SetHostsError(db.ErrHostsNotFound)
+		processesRouter := controller.NewProcessesRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/processes?name=postgres", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(processesRouter.GetProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusOK, rr.Code)
+		require.Equal(t, "[]\n", rr.Body.String())
+	})
+
+	t.Run("missing name", func(t *testing.T) {
+		hostDB := &MockHostDB{}
+		processesRouter := controller.NewProcessesRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/processes", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(processesRouter.GetProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Equal(t, "Missing the query param 'name'\n", rr.Body.String())
+	})
+
+	t.Run("db returns unknown error", func(t *testing.T) {
+		unknownErr := errors.New("unknown error")
+		hostDB := &MockHostDB{}
+		hostDB.SetHostsError(unknownErr)
+		processesRouter := controller.NewProcessesRouter(hostDB)
+
+		req, err := http.NewRequest("GET", "/processes?name=postgres", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler := http.HandlerFunc(processesRouter.GetProcesses)
+		handler.ServeHTTP(rr, req)
+
+		require.Equal(t, http.StatusInternalServerError, rr.Code)
+	})
+}
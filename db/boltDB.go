@@ -0,0 +1,680 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	hostsBucket  = []byte("hosts")
+	statsBucket  = []byte("stats")
+	eventsBucket = []byte("events")
+)
+
+// NewBoltDB opens or creates the single file key/value store at the path.
+func NewBoltDB(path string) (*BoltDB, error) {
+	store, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("db: Could not open the bolt db '%s': %w", path, err)
+	}
+
+	err = store.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{hostsBucket, statsBucket, eventsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return migrateStatsKeys(tx)
+	})
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("db: Could not create the bolt buckets: %w", err)
+	}
+
+	return &BoltDB{store: store}, nil
+}
+
+// BoltDB a persistent single file DB implementing the db.HostDB interface.
+// The HostInfos are stored by the hostname and the stats inside a bucket per host.
+// The stats keys are the reversed insert sequence of the host bucket so that iterating returns the newest stats first.
+// Unlike a timestamp the sequence can not go backwards with the clock of the system.
+type BoltDB struct {
+	store *bolt.DB
+}
+
+// Close waits for the running transactions and closes the underlying file.
+// Every transaction is already synced to the file on its commit.
+func (db *BoltDB) Close() error {
+	return db.store.Close()
+}
+
+// statsKeyLen is the length of the keys of the stats.
+const statsKeyLen = 8
+
+// statsKey builds a key that sorts newer sequences first.
+func statsKey(sequence uint64) []byte {
+	key := make([]byte, statsKeyLen)
+	binary.BigEndian.PutUint64(key, math.MaxUint64-sequence)
+	return key
+}
+
+// migrateStatsKeys rewrites the stats of hosts with the former keys of the insert timestamp and a sequence.
+// The order of the stats is kept.
+func migrateStatsKeys(tx *bolt.Tx) error {
+	hostnames := make([][]byte, 0)
+	err := tx.Bucket(statsBucket).ForEach(func(hostname, value []byte) error {
+		bucket := tx.Bucket(statsBucket).Bucket(hostname)
+		if bucket == nil {
+			return nil
+		}
+		if key, _ := bucket.Cursor().First(); key != nil && len(key) != statsKeyLen {
+			hostnames = append(hostnames, hostname)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, hostname := range hostnames {
+		stats, err := readStats(tx.Bucket(statsBucket).Bucket(hostname))
+		if err != nil {
+			return err
+		}
+		if err := writeStats(tx, hostname, stats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func eventKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+	return key
+}
+
+func getHostInfo(tx *bolt.Tx, hostname string) (HostInfo, error) {
+	value := tx.Bucket(hostsBucket).Get([]byte(hostname))
+	if value == nil {
+		return HostInfo{}, ErrHostNotFound
+	}
+
+	var hostInfo HostInfo
+	err := json.Unmarshal(value, &hostInfo)
+	return hostInfo, err
+}
+
+func putJSON(bucket *bolt.Bucket, key []byte, value interface{}) error {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put(key, encoded)
+}
+
+// readStats decodes all stats of the host bucket with the newest first.
+func readStats(bucket *bolt.Bucket) ([]Stats, error) {
+	stats := make([]Stats, 0)
+	err := bucket.ForEach(func(key, value []byte) error {
+		var stat Stats
+		if err := json.Unmarshal(value, &stat); err != nil {
+			return err
+		}
+		stats = append(stats, stat)
+		return nil
+	})
+	return stats, err
+}
+
+// writeHost replaces the host with its stats.
+// The stats are expected to be ordered with the newest first.
+func writeHost(tx *bolt.Tx, host Host) error {
+	hostname := []byte(host.HostInfo.Hostname)
+	if err := writeStats(tx, hostname, host.Stats); err != nil {
+		return err
+	}
+
+	host.HostInfo.DataPoints = len(host.Stats)
+	return putJSON(tx.Bucket(hostsBucket), hostname, host.HostInfo)
+}
+
+// writeStats replaces the stats bucket of the host.
+// The stats are expected to be ordered with the newest first and get the sequences counting down from their amount.
+func writeStats(tx *bolt.Tx, hostname []byte, stats []Stats) error {
+	if tx.Bucket(statsBucket).Bucket(hostname) != nil {
+		if err := tx.Bucket(statsBucket).DeleteBucket(hostname); err != nil {
+			return err
+		}
+	}
+	bucket, err := tx.Bucket(statsBucket).CreateBucket(hostname)
+	if err != nil {
+		return err
+	}
+
+	for i, stat := range stats {
+		if err := putJSON(bucket, statsKey(uint64(len(stats)-i)), stat); err != nil {
+			return err
+		}
+	}
+	return bucket.SetSequence(uint64(len(stats)))
+}
+
+// deleteHost removes the host with its stats.
+func deleteHost(tx *bolt.Tx, hostname string) error {
+	if err := tx.Bucket(hostsBucket).Delete([]byte(hostname)); err != nil {
+		return err
+	}
+	if tx.Bucket(statsBucket).Bucket([]byte(hostname)) == nil {
+		return nil
+	}
+	return tx.Bucket(statsBucket).DeleteBucket([]byte(hostname))
+}
+
+// GetHosts returns a paginated result of all hosts matching the query sorted by it.
+// Without filters a sort by the hostname walks the keys, otherwise the matching hosts are read and sorted.
+// Filters by a hostname prefix seek to the prefix instead of reading all hosts.
+// It returns an error if no host was found or all entries are beeing skiped.
+func (db *BoltDB) GetHosts(query HostQuery, pagination Pagination) ([]HostInfo, error) {
+	if err := query.Validate(); err != nil {
+		return []HostInfo{}, err
+	}
+	if query.filtered() || !query.sortedByHostname() {
+		hosts, err := db.matchingHosts(query)
+		if err != nil {
+			return []HostInfo{}, err
+		}
+		sortHosts(hosts, query)
+		return pageHosts(hosts, pagination)
+	}
+
+	hosts := make([]HostInfo, 0)
+	err := db.store.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(hostsBucket)
+		records := bucket.Stats().KeyN
+		if records == 0 {
+			return ErrHostsNotFound
+		}
+		if records < pagination.Skip {
+			return ErrAllEntriesSkipped
+		}
+
+		cursor := bucket.Cursor()
+		first, next := cursor.First, cursor.Next
+		if query.descending() {
+			first, next = cursor.Last, cursor.Prev
+		}
+		key, value := first()
+		for i := 0; key != nil && i < pagination.Skip; i++ {
+			key, value = next()
+		}
+		for ; key != nil && len(hosts) < pagination.Limit; key, value = next() {
+			var hostInfo HostInfo
+			if err := json.Unmarshal(value, &hostInfo); err != nil {
+				return err
+			}
+			hosts = append(hosts, hostInfo)
+		}
+		return nil
+	})
+	if err != nil {
+		return []HostInfo{}, err
+	}
+
+	return hosts, nil
+}
+
+// matchingHosts reads the HostInfos of all hosts matching the query.
+func (db *BoltDB) matchingHosts(query HostQuery) ([]HostInfo, error) {
+	matches, err := query.filter(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := make([]HostInfo, 0)
+	err = db.store.View(func(tx *bolt.Tx) error {
+		prefix := []byte(query.hostnamePrefix())
+		cursor := tx.Bucket(hostsBucket).Cursor()
+		for key, value := cursor.Seek(prefix); key != nil && bytes.HasPrefix(key, prefix); key, value = cursor.Next() {
+			var hostInfo HostInfo
+			if err := json.Unmarshal(value, &hostInfo); err != nil {
+				return err
+			}
+			if matches(hostInfo) {
+				hosts = append(hosts, hostInfo)
+			}
+		}
+		return nil
+	})
+	return hosts, err
+}
+
+// GetHost returns a host with the matching hostname.
+// If no host could be found it will return an error.
+func (db *BoltDB) GetHost(hostname string) (HostInfo, error) {
+	var hostInfo HostInfo
+	err := db.store.View(func(tx *bolt.Tx) error {
+		var err error
+		hostInfo, err = getHostInfo(tx, hostname)
+		return err
+	})
+	if err != nil {
+		return HostInfo{}, err
+	}
+
+	return hostInfo, nil
+}
+
+// GetStatsByHostname gets all Stats in a paginated form from a specific host with the newest first.
+// It returns errors if no host is found or if all entries are beeing skiped.
+func (db *BoltDB) GetStatsByHostname(hostname string, pagination Pagination) ([]Stats, error) {
+	stats := make([]Stats, 0)
+	err := db.store.View(func(tx *bolt.Tx) error {
+		hostInfo, err := getHostInfo(tx, hostname)
+		if err != nil {
+			return err
+		}
+		if hostInfo.DataPoints < pagination.Skip {
+			return ErrAllEntriesSkipped
+		}
+
+		bucket := tx.Bucket(statsBucket).Bucket([]byte(hostname))
+		if bucket == nil {
+			return nil
+		}
+		cursor := bucket.Cursor()
+		key, value := cursor.First()
+		for i := 0; key != nil && i < pagination.Skip; i++ {
+			key, value = cursor.Next()
+		}
+		for ; key != nil && len(stats) < pagination.Limit; key, value = cursor.Next() {
+			var stat Stats
+			if err := json.Unmarshal(value, &stat); err != nil {
+				return err
+			}
+			stats = append(stats, stat)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Stats{}, err
+	}
+
+	return stats, nil
+}
+
+// GetStatsPage gets up to limit stats of a specific host with the newest first that are older than the cursor.
+// The cursor is the key of the last returned stat and the next page seeks to it.
+// Stats inserted meanwhile get keys that sort before the cursor and deleted ones are just skipped.
+// It returns errors if no host is found or if the cursor is not a key.
+func (db *BoltDB) GetStatsPage(hostname string, cursor StatsCursor, limit int) ([]Stats, StatsCursor, error) {
+	if cursor != "" && len(cursor) != statsKeyLen {
+		return []Stats{}, "", fmt.Errorf("%w: '%x'", ErrInvalidStatsCursor, cursor)
+	}
+
+	stats := make([]Stats, 0)
+	next := cursor
+	err := db.store.View(func(tx *bolt.Tx) error {
+		if _, err := getHostInfo(tx, hostname); err != nil {
+			return err
+		}
+		bucket := tx.Bucket(statsBucket).Bucket([]byte(hostname))
+		if bucket == nil {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		key, value := c.First()
+		if cursor != "" {
+			key, value = c.Seek([]byte(cursor))
+			if bytes.Equal(key, []byte(cursor)) {
+				key, value = c.Next()
+			}
+		}
+		for ; key != nil && len(stats) < limit; key, value = c.Next() {
+			var stat Stats
+			if err := json.Unmarshal(value, &stat); err != nil {
+				return err
+			}
+			stats = append(stats, stat)
+			next = StatsCursor(key)
+		}
+		return nil
+	})
+	if err != nil {
+		return []Stats{}, "", err
+	}
+
+	return stats, next, nil
+}
+
+// InsertStats into the DB.
+// It creates a new host if it does not exist and updates the HostInfos.
+// Stats without a date get the insert time.
+func (db *BoltDB) InsertStats(hostname string, stats Stats) error {
+	return db.store.Update(func(tx *bolt.Tx) error {
+		hostInfo, err := getHostInfo(tx, hostname)
+		if err == ErrHostNotFound {
+			hostInfo = HostInfo{Hostname: hostname}
+		} else if err != nil {
+			return err
+		}
+
+		bucket, err := tx.Bucket(statsBucket).CreateBucketIfNotExists([]byte(hostname))
+		if err != nil {
+			return err
+		}
+		sequence, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if stats.Date.IsZero() {
+			stats.Date = now.UTC()
+		}
+		if err := putJSON(bucket, statsKey(sequence), stats); err != nil {
+			return err
+		}
+
+		hostInfo.DataPoints++
+		hostInfo.LastInsert = now
+		return putJSON(tx.Bucket(hostsBucket), []byte(hostname), hostInfo)
+	})
+}
+
+// DeleteHost removes the host with all its stats and events.
+// It returns an error if no host could be found.
+func (db *BoltDB) DeleteHost(hostname string) error {
+	return db.store.Update(func(tx *bolt.Tx) error {
+		if _, err := getHostInfo(tx, hostname); err != nil {
+			return err
+		}
+		if err := deleteHost(tx, hostname); err != nil {
+			return err
+		}
+
+		return updateEvents(tx, func(event *Event) (keep bool) {
+			return event.Hostname != hostname
+		})
+	})
+}
+
+// MergeHosts moves the stats of the source host into the target host.
+// If the target host does not exist the source host will be renamed.
+// Existing stats get interleaved by their date and the HostInfos are recalculated.
+func (db *BoltDB) MergeHosts(source, target string) error {
+	if source == target {
+		return ErrMergeSameHost
+	}
+
+	return db.store.Update(func(tx *bolt.Tx) error {
+		sourceInfo, err := getHostInfo(tx, source)
+		if err != nil {
+			return err
+		}
+		targetInfo, err := getHostInfo(tx, target)
+		if err == ErrHostNotFound {
+			targetInfo = HostInfo{Hostname: target}
+		} else if err != nil {
+			return err
+		}
+
+		stats := make([]Stats, 0)
+		if bucket := tx.Bucket(statsBucket).Bucket([]byte(target)); bucket != nil {
+			if stats, err = readStats(bucket); err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket(statsBucket).Bucket([]byte(source)); bucket != nil {
+			sourceStats, err := readStats(bucket)
+			if err != nil {
+				return err
+			}
+			for _, stat := range sourceStats {
+				stat.Hostname = target
+				stats = append(stats, stat)
+			}
+		}
+		sortStatsByDate(stats)
+
+		if sourceInfo.LastInsert.After(targetInfo.LastInsert) {
+			targetInfo.LastInsert = sourceInfo.LastInsert
+		}
+		if err := writeHost(tx, Host{HostInfo: targetInfo, Stats: stats}); err != nil {
+			return err
+		}
+		if err := deleteHost(tx, source); err != nil {
+			return err
+		}
+
+		return updateEvents(tx, func(event *Event) (keep bool) {
+			if event.Hostname == source {
+				event.Hostname = target
+			}
+			return true
+		})
+	})
+}
+
+// DeleteStatsBefore removes the stats older than the date from all hosts and updates the DataPoints.
+// Stats without a date are kept.
+// The keys are the insert sequences and not the dates of the stats, so every stat has to be checked.
+func (db *BoltDB) DeleteStatsBefore(date time.Time) (int, error) {
+	deleted := 0
+	err := db.store.Update(func(tx *bolt.Tx) error {
+		// the hosts bucket must not be changed while iterating over it
+		updated := make(map[string]HostInfo)
+		err := tx.Bucket(hostsBucket).ForEach(func(hostname, value []byte) error {
+			bucket := tx.Bucket(statsBucket).Bucket(hostname)
+			if bucket == nil {
+				return nil
+			}
+
+			keys := make([][]byte, 0)
+			err := bucket.ForEach(func(key, value []byte) error {
+				// only the date is needed to decide if the stat gets deleted
+				var stat struct {
+					Date time.Time `json:"date"`
+				}
+				if err := json.Unmarshal(value, &stat); err != nil {
+					return err
+				}
+				if !stat.Date.IsZero() && stat.Date.Before(date) {
+					keys = append(keys, key)
+				}
+				return nil
+			})
+			if err != nil || len(keys) == 0 {
+				return err
+			}
+
+			for _, key := range keys {
+				if err := bucket.Delete(key); err != nil {
+					return err
+				}
+			}
+
+			var hostInfo HostInfo
+			if err := json.Unmarshal(value, &hostInfo); err != nil {
+				return err
+			}
+			hostInfo.DataPoints -= len(keys)
+			updated[string(hostname)] = hostInfo
+			deleted += len(keys)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for hostname, hostInfo := range updated {
+			if err := putJSON(tx.Bucket(hostsBucket), []byte(hostname), hostInfo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return deleted, err
+}
+
+// updateEvents calls fn for every event and stores the changes.
+// Events for which fn returns false get deleted.
+func updateEvents(tx *bolt.Tx, fn func(event *Event) (keep bool)) error {
+	bucket := tx.Bucket(eventsBucket)
+	events, err := readEvents(bucket)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		if !fn(&event) {
+			if err := bucket.Delete(eventKey(event.ID)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := putJSON(bucket, eventKey(event.ID), event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readEvents(bucket *bolt.Bucket) ([]Event, error) {
+	events := make([]Event, 0)
+	err := bucket.ForEach(func(key, value []byte) error {
+		var event Event
+		if err := json.Unmarshal(value, &event); err != nil {
+			return err
+		}
+		events = append(events, event)
+		return nil
+	})
+	return events, err
+}
+
+// InsertEvent into the DB.
+// The event gets a new ID assigned.
+func (db *BoltDB) InsertEvent(event Event) (Event, error) {
+	err := db.store.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(eventsBucket)
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		event.ID = int(id)
+		return putJSON(bucket, eventKey(event.ID), event)
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// GetEvents gets all events matching the filter in a paginated form with the newest first.
+// It returns an error if all entries are beeing skiped.
+func (db *BoltDB) GetEvents(filter EventFilter, pagination Pagination) ([]Event, error) {
+	events := make([]Event, 0)
+	err := db.store.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(eventsBucket).ForEach(func(key, value []byte) error {
+			var event Event
+			if err := json.Unmarshal(value, &event); err != nil {
+				return err
+			}
+			if filter.Matches(event) {
+				events = append(events, event)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return []Event{}, err
+	}
+	sortEventsByDate(events)
+
+	records := len(events)
+	if records < pagination.Skip {
+		return []Event{}, ErrAllEntriesSkipped
+	} else if records < (pagination.Skip + pagination.Limit) {
+		return events[pagination.Skip:], nil
+	}
+
+	return events[pagination.Skip:(pagination.Skip + pagination.Limit)], nil
+}
+
+// Snapshot returns a consistent copy of all hosts and events from a single read transaction.
+func (db *BoltDB) Snapshot() (Snapshot, error) {
+	snapshot := Snapshot{Hosts: make([]Host, 0), Events: make([]Event, 0)}
+	err := db.store.View(func(tx *bolt.Tx) error {
+		err := tx.Bucket(hostsBucket).ForEach(func(hostname, value []byte) error {
+			host := Host{Stats: make([]Stats, 0)}
+			if err := json.Unmarshal(value, &host.HostInfo); err != nil {
+				return err
+			}
+			if bucket := tx.Bucket(statsBucket).Bucket(hostname); bucket != nil {
+				var err error
+				if host.Stats, err = readStats(bucket); err != nil {
+					return err
+				}
+			}
+			snapshot.Hosts = append(snapshot.Hosts, host)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		snapshot.Events, err = readEvents(tx.Bucket(eventsBucket))
+		return err
+	})
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	return snapshot, nil
+}
+
+// Restore replaces all hosts and events with the ones from the snapshot inside a single transaction.
+func (db *BoltDB) Restore(snapshot Snapshot) error {
+	return db.store.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{hostsBucket, statsBucket, eventsBucket} {
+			if err := tx.DeleteBucket(name); err != nil {
+				return err
+			}
+			if _, err := tx.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+
+		for _, host := range snapshot.Hosts {
+			if err := writeHost(tx, host); err != nil {
+				return err
+			}
+		}
+
+		events := make([]Event, len(snapshot.Events))
+		copy(events, snapshot.Events)
+		sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+		bucket := tx.Bucket(eventsBucket)
+		for _, event := range events {
+			if err := putJSON(bucket, eventKey(event.ID), event); err != nil {
+				return err
+			}
+		}
+		if len(events) > 0 {
+			return bucket.SetSequence(uint64(events[len(events)-1].ID))
+		}
+		return nil
+	})
+}
@@ -0,0 +1,224 @@
+package db_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/dbtest"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newBoltDB(t *testing.T) *db.BoltDB {
+	t.Helper()
+	boltDB, err := db.NewBoltDB(filepath.Join(t.TempDir(), "gsave.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { boltDB.Close() })
+	return boltDB
+}
+
+// withoutLastInsert removes the insert time which differs between two dbs.
+func withoutLastInsert(hosts []db.HostInfo) []db.HostInfo {
+	for i := range hosts {
+		hosts[i].LastInsert = time.Time{}
+	}
+	return hosts
+}
+
+func TestBoltDB_Conformance(t *testing.T) {
+	dbtest.RunConformance(t, func() db.HostDB { return newBoltDB(t) })
+}
+
+func TestBoltDB_Parity(t *testing.T) {
+	date := time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+	scenario := func(t *testing.T, hostDB db.HostDB) {
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date, CPU: 1}))
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date.Add(2 * time.Hour), CPU: 2}))
+		require.NoError(t, hostDB.InsertStats("bar", db.Stats{Hostname: "bar", Date: date.Add(time.Hour), CPU: 3}))
+		require.NoError(t, hostDB.InsertStats("baz", db.Stats{Hostname: "baz", Date: date.Add(3 * time.Hour), CPU: 4}))
+		_, err := hostDB.InsertEvent(db.Event{Hostname: "bar", Date: date, Title: "deploy"})
+		require.NoError(t, err)
+		_, err = hostDB.InsertEvent(db.Event{Date: date.Add(time.Hour), Title: "fleet"})
+		require.NoError(t, err)
+	}
+
+	memDB := db.NewInMemoryDB()
+	boltDB := newBoltDB(t)
+	scenario(t, memDB)
+	scenario(t, boltDB)
+
+	requireSameStats := func(t *testing.T, hostname string, pagination db.Pagination) {
+		want, wantErr := memDB.GetStatsByHostname(hostname, pagination)
+		got, gotErr := boltDB.GetStatsByHostname(hostname, pagination)
+		require.Equal(t, wantErr, gotErr)
+		require.Equal(t, want, got)
+	}
+
+	t.Run("should return the stats with the newest insert first", func(t *testing.T) {
+		requireSameStats(t, "foo", db.Pagination{Skip: 0, Limit: 10})
+		requireSameStats(t, "foo", db.Pagination{Skip: 1, Limit: 10})
+		requireSameStats(t, "foo", db.Pagination{Skip: 2, Limit: 10})
+		requireSameStats(t, "foo", db.Pagination{Skip: 0, Limit: 1})
+	})
+
+	t.Run("should return the same errors", func(t *testing.T) {
+		requireSameStats(t, "foo", db.Pagination{Skip: 3, Limit: 10})
+		requireSameStats(t, "unknown", db.Pagination{Skip: 0, Limit: 10})
+
+		_, wantErr := memDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 4, Limit: 10})
+		_, gotErr := boltDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 4, Limit: 10})
+		require.Equal(t, wantErr, gotErr)
+
+		_, gotErr = boltDB.GetHost("unknown")
+		require.Equal(t, db.ErrHostNotFound, gotErr)
+		require.Equal(t, db.ErrHostNotFound, boltDB.DeleteHost("unknown"))
+		require.Equal(t, db.ErrMergeSameHost, boltDB.MergeHosts("foo", "foo"))
+	})
+
+	t.Run("should return the same host infos", func(t *testing.T) {
+		got, err := boltDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.ElementsMatch(t, []db.HostInfo{
+			{Hostname: "bar", DataPoints: 1},
+			{Hostname: "baz", DataPoints: 1},
+			{Hostname: "foo", DataPoints: 2},
+		}, withoutLastInsert(got))
+
+		got, err = boltDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 1, Limit: 1})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+	})
+
+	t.Run("should merge the hosts by date", func(t *testing.T) {
+		require.NoError(t, memDB.MergeHosts("bar", "foo"))
+		require.NoError(t, boltDB.MergeHosts("bar", "foo"))
+		requireSameStats(t, "foo", db.Pagination{Skip: 0, Limit: 10})
+		requireSameStats(t, "bar", db.Pagination{Skip: 0, Limit: 10})
+
+		want, err := memDB.GetHost("foo")
+		require.NoError(t, err)
+		got, err := boltDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, want.DataPoints, got.DataPoints)
+
+		wantEvents, wantErr := memDB.GetEvents(db.EventFilter{Hostname: "foo"}, db.Pagination{Skip: 0, Limit: 10})
+		gotEvents, gotErr := boltDB.GetEvents(db.EventFilter{Hostname: "foo"}, db.Pagination{Skip: 0, Limit: 10})
+		require.Equal(t, wantErr, gotErr)
+		require.Equal(t, wantEvents, gotEvents)
+	})
+
+	t.Run("should delete the old stats", func(t *testing.T) {
+		want, err := memDB.DeleteStatsBefore(date.Add(time.Minute))
+		require.NoError(t, err)
+		got, err := boltDB.DeleteStatsBefore(date.Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+		requireSameStats(t, "foo", db.Pagination{Skip: 0, Limit: 10})
+		requireSameStats(t, "baz", db.Pagination{Skip: 0, Limit: 10})
+	})
+
+	t.Run("should delete the host with its events", func(t *testing.T) {
+		require.NoError(t, memDB.DeleteHost("foo"))
+		require.NoError(t, boltDB.DeleteHost("foo"))
+		requireSameStats(t, "foo", db.Pagination{Skip: 0, Limit: 10})
+
+		wantEvents, err := memDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		gotEvents, err := boltDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, wantEvents, gotEvents)
+	})
+}
+
+func TestBoltDB_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gsave.db")
+	stats := db.Stats{Hostname: "foo", Date: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC), CPU: 1}
+
+	t.Run("should keep the data after reopening the file", func(t *testing.T) {
+		boltDB, err := db.NewBoltDB(path)
+		require.NoError(t, err)
+		require.NoError(t, boltDB.InsertStats("foo", stats))
+		_, err = boltDB.InsertEvent(db.Event{Title: "deploy"})
+		require.NoError(t, err)
+		require.NoError(t, boltDB.Close())
+
+		boltDB, err = db.NewBoltDB(path)
+		require.NoError(t, err)
+		defer boltDB.Close()
+
+		got, err := boltDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{stats}, got)
+
+		event, err := boltDB.InsertEvent(db.Event{Title: "restart"})
+		require.NoError(t, err)
+		require.Equal(t, 2, event.ID)
+	})
+
+	t.Run("should migrate the keys of the insert timestamp", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gsave.db")
+		store, err := bolt.Open(path, 0600, nil)
+		require.NoError(t, err)
+		err = store.Update(func(tx *bolt.Tx) error {
+			hosts, err := tx.CreateBucket([]byte("hosts"))
+			require.NoError(t, err)
+			require.NoError(t, hosts.Put([]byte("foo"), []byte(`{"hostname":"foo","dataPoints":2}`)))
+			statsBucket, err := tx.CreateBucket([]byte("stats"))
+			require.NoError(t, err)
+			bucket, err := statsBucket.CreateBucket([]byte("foo"))
+			require.NoError(t, err)
+			// the former keys are the reversed timestamp followed by the reversed sequence
+			for sequence, cpu := range []float64{1, 2} {
+				key := make([]byte, 16)
+				binary.BigEndian.PutUint64(key, uint64(math.MaxInt64-int64(1000+sequence)))
+				binary.BigEndian.PutUint64(key[8:], math.MaxUint64-uint64(sequence+1))
+				require.NoError(t, bucket.Put(key, []byte(fmt.Sprintf(`{"hostname":"foo","cpu":%g}`, cpu))))
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, store.Close())
+
+		boltDB, err := db.NewBoltDB(path)
+		require.NoError(t, err)
+		defer boltDB.Close()
+		require.NoError(t, boltDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC), CPU: 3}))
+
+		got, err := boltDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 3)
+		require.Equal(t, []float64{3, 2, 1}, []float64{got[0].CPU, got[1].CPU, got[2].CPU})
+	})
+}
+
+func TestBoltDB_SnapshotAndRestore(t *testing.T) {
+	t.Run("should restore a snapshot of the memory db", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Hostname: "foo", CPU: 1}))
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Hostname: "foo", CPU: 2}))
+		_, err := memDB.InsertEvent(db.Event{Title: "deploy"})
+		require.NoError(t, err)
+		snapshot, err := memDB.Snapshot()
+		require.NoError(t, err)
+
+		boltDB := newBoltDB(t)
+		require.NoError(t, boltDB.InsertStats("bar", db.Stats{Hostname: "bar"}))
+		require.NoError(t, boltDB.Restore(snapshot))
+
+		got, err := boltDB.Snapshot()
+		require.NoError(t, err)
+		require.Equal(t, snapshot.Events, got.Events)
+		require.Len(t, got.Hosts, 1)
+		require.Equal(t, snapshot.Hosts[0].Stats, got.Hosts[0].Stats)
+		require.Equal(t, snapshot.Hosts[0].HostInfo.DataPoints, got.Hosts[0].HostInfo.DataPoints)
+
+		event, err := boltDB.InsertEvent(db.Event{Title: "restart"})
+		require.NoError(t, err)
+		require.Equal(t, 2, event.ID)
+	})
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// chunkSize is the number of stats in one chunk.
+const chunkSize = 256
+
+// statsChunks is an append-only list of stats in insert order.
+// The stats are kept in fixed size chunks so that an append never copies the existing stats.
+// Every stat gets a sequence that grows with every append, so that a position stays valid while stats get appended.
+type statsChunks struct {
+	chunks []statsChunk
+	length int
+	// bytes is the estimated memory of the stats.
+	bytes int
+	// sequence of the newest stat.
+	sequence uint64
+}
+
+// statsChunk holds up to chunkSize stats with the range of their dates.
+type statsChunk struct {
+	stats []sequencedStats
+	// oldest and newest are the dates of the stats that have one.
+	oldest, newest time.Time
+	// undated is the number of stats without a date.
+	undated int
+	bytes   int
+}
+
+// sequencedStats are stats with the sequence of their insert.
+type sequencedStats struct {
+	sequence uint64
+	stats    Stats
+}
+
+// newStatsChunks builds the chunks from stats ordered with the newest first.
+func newStatsChunks(stats []Stats) statsChunks {
+	c := statsChunks{}
+	for i := len(stats) - 1; i >= 0; i-- {
+		c.append(stats[i])
+	}
+	return c
+}
+
+// append the stat as the newest entry.
+func (c *statsChunks) append(stat Stats) {
+	c.sequence++
+	c.appendSequenced(sequencedStats{sequence: c.sequence, stats: stat})
+}
+
+func (c *statsChunks) appendSequenced(entry sequencedStats) {
+	if c.length%chunkSize == 0 {
+		c.chunks = append(c.chunks, statsChunk{stats: make([]sequencedStats, 0, chunkSize)})
+	}
+	c.chunks[len(c.chunks)-1].add(entry)
+	c.length++
+	c.bytes += entry.stats.size()
+}
+
+func (chunk *statsChunk) add(entry sequencedStats) {
+	chunk.stats = append(chunk.stats, entry)
+	chunk.bytes += entry.stats.size()
+
+	date := entry.stats.Date
+	switch {
+	case date.IsZero():
+		chunk.undated++
+	case chunk.oldest.IsZero():
+		chunk.oldest, chunk.newest = date, date
+	case date.Before(chunk.oldest):
+		chunk.oldest = date
+	case date.After(chunk.newest):
+		chunk.newest = date
+	}
+}
+
+// allBefore reports if every stat of the chunk has a date before the given one.
+func (chunk *statsChunk) allBefore(date time.Time) bool {
+	return chunk.undated == 0 && !chunk.newest.IsZero() && chunk.newest.Before(date)
+}
+
+// anyBefore reports if at least one stat of the chunk has a date before the given one.
+func (chunk *statsChunk) anyBefore(date time.Time) bool {
+	return !chunk.oldest.IsZero() && chunk.oldest.Before(date)
+}
+
+// len returns the number of stats.
+func (c *statsChunks) len() int {
+	return c.length
+}
+
+// size returns the estimated memory of the stats in bytes.
+func (c *statsChunks) size() int {
+	return c.bytes
+}
+
+// at returns the entry at the position counted from the oldest one.
+func (c *statsChunks) at(position int) sequencedStats {
+	return c.chunks[position/chunkSize].stats[position%chunkSize]
+}
+
+// newestFirst returns a copy of up to limit stats after skipping the newest ones.
+func (c *statsChunks) newestFirst(skip, limit int) []Stats {
+	count := c.length - skip
+	if count > limit {
+		count = limit
+	}
+	if count <= 0 {
+		return []Stats{}
+	}
+
+	stats := make([]Stats, 0, count)
+	for position := c.length - 1 - skip; len(stats) < count; position-- {
+		stats = append(stats, c.at(position).stats)
+	}
+	return stats
+}
+
+// before returns a copy of up to limit stats with the newest first that got a lower sequence than the given one.
+// It also returns the sequence of the last returned stat.
+func (c *statsChunks) before(sequence uint64, limit int) ([]Stats, uint64) {
+	// the sequences grow with the position
+	position := sort.Search(c.length, func(i int) bool { return c.at(i).sequence >= sequence }) - 1
+
+	stats := make([]Stats, 0)
+	last := sequence
+	for ; position >= 0 && len(stats) < limit; position-- {
+		entry := c.at(position)
+		stats = append(stats, entry.stats)
+		last = entry.sequence
+	}
+	return stats, last
+}
+
+// deleteBefore removes the stats with a date before the given one and returns how many got removed.
+// Stats without a date are kept. Only the date ranges of the chunks are checked if nothing has to be removed.
+// Expired chunks at the oldest end are dropped as a whole, the stats of the other chunks only get copied
+// if they contain expired stats, e.g. because they were sent late.
+// The sequences of the stats are kept.
+func (c *statsChunks) deleteBefore(date time.Time) int {
+	length := c.length
+
+	dropped := 0
+	for dropped < len(c.chunks) && c.chunks[dropped].allBefore(date) {
+		c.length -= len(c.chunks[dropped].stats)
+		c.bytes -= c.chunks[dropped].bytes
+		dropped++
+	}
+	if dropped > 0 {
+		// all dropped chunks are full, so the positions of the remaining stats can still be calculated
+		c.chunks = append([]statsChunk(nil), c.chunks[dropped:]...)
+	}
+
+	for i := range c.chunks {
+		if c.chunks[i].anyBefore(date) {
+			*c = c.filter(func(stats Stats) bool {
+				return stats.Date.IsZero() || !stats.Date.Before(date)
+			})
+			break
+		}
+	}
+	return length - c.length
+}
+
+// filter returns new chunks with the stats for which keep returns true.
+// The sequences of the stats are kept.
+func (c *statsChunks) filter(keep func(stats Stats) bool) statsChunks {
+	filtered := statsChunks{sequence: c.sequence}
+	for _, chunk := range c.chunks {
+		for _, entry := range chunk.stats {
+			if keep(entry.stats) {
+				filtered.appendSequenced(entry)
+			}
+		}
+	}
+	return filtered
+}
+
+// all returns a copy of all stats with the newest first.
+func (c *statsChunks) all() []Stats {
+	return c.newestFirst(0, c.length)
+}
@@ -0,0 +1,18 @@
+package db
+
+import "context"
+
+// ContextBinder is implemented by HostDBs that use the context of a request, e.g. to trace their calls.
+type ContextBinder interface {
+	// WithContext returns a HostDB that uses the context for all its calls.
+	WithContext(ctx context.Context) HostDB
+}
+
+// WithContext binds the context to the HostDB if it is a ContextBinder.
+// Otherwise the HostDB is returned unchanged.
+func WithContext(ctx context.Context, hostDB HostDB) HostDB {
+	if binder, ok := hostDB.(ContextBinder); ok {
+		return binder.WithContext(ctx)
+	}
+	return hostDB
+}
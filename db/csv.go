@@ -0,0 +1,161 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVMetricPrefix is the prefix of the CSV columns holding custom metrics.
+const CSVMetricPrefix = "metric."
+
+var (
+	// ErrUnknownCSVColumn if a CSV header contains a column that can not be mapped to the stats.
+	ErrUnknownCSVColumn = errors.New("db: Unknown CSV column")
+	// ErrCSVColumnCount if a CSV record has another amount of columns than the header.
+	ErrCSVColumnCount = errors.New("db: Wrong number of CSV columns")
+)
+
+// CSVColumns are the columns of the flattened stats in the CSV format.
+// The processes, cores, load, mounts and interfaces are JSON encoded columns
+// and the custom metrics follow as 'metric.<name>' columns.
+var CSVColumns = []string{"hostname", "date", "cpu", "disk_used", "disk_total", "mem_used", "mem_total", "processes",
+	"cores", "load", "mounts", "interfaces"}
+
+// CSVHeader returns the CSV header for the stats with the custom metrics.
+func CSVHeader(metrics []string) []string {
+	header := make([]string, 0, len(CSVColumns)+len(metrics))
+	header = append(header, CSVColumns...)
+	for _, metric := range metrics {
+		header = append(header, CSVMetricPrefix+metric)
+	}
+	return header
+}
+
+// CSVRecord flattens the stats into a CSV record matching the CSVHeader with the same metrics.
+// Metrics that the stats don't have are left empty.
+func (s Stats) CSVRecord(metrics []string) ([]string, error) {
+	processes, err := json.Marshal(s.Processes)
+	if err != nil {
+		return []string{}, err
+	}
+	details := make([]string, 0, 4)
+	for _, detail := range []struct {
+		value interface{}
+		empty bool
+	}{
+		{s.Cores, s.Cores == nil},
+		{s.Load, s.Load == nil},
+		{s.Mounts, s.Mounts == nil},
+		{s.Interfaces, s.Interfaces == nil},
+	} {
+		if detail.empty {
+			details = append(details, "")
+			continue
+		}
+		encoded, err := json.Marshal(detail.value)
+		if err != nil {
+			return []string{}, err
+		}
+		details = append(details, string(encoded))
+	}
+
+	record := []string{
+		s.Hostname,
+		s.Date.Format(time.RFC3339Nano),
+		strconv.FormatFloat(s.CPU, 'f', -1, 64),
+		strconv.Itoa(s.Disk.Used),
+		strconv.Itoa(s.Disk.Total),
+		strconv.Itoa(s.Mem.Used),
+		strconv.Itoa(s.Mem.Total),
+		string(processes),
+	}
+	record = append(record, details...)
+	for _, metric := range metrics {
+		value, found := s.Metrics[metric]
+		if !found {
+			record = append(record, "")
+			continue
+		}
+		record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+
+	return record, nil
+}
+
+// ValidateCSVHeader checks if all columns of the header can be mapped to the stats.
+// Returns ErrUnknownCSVColumn or ErrInvalidMetricName for columns that can not be mapped.
+func ValidateCSVHeader(header []string) error {
+	for _, column := range header {
+		if strings.HasPrefix(column, CSVMetricPrefix) {
+			if err := ValidateMetricName(strings.TrimPrefix(column, CSVMetricPrefix)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isIncluded(CSVColumns, column) {
+			return fmt.Errorf("%w: '%s'", ErrUnknownCSVColumn, column)
+		}
+	}
+	return nil
+}
+
+// StatsFromCSVRecord reads the stats from a CSV record with the given header.
+// Empty values are left at their zero value.
+func StatsFromCSVRecord(header, record []string) (Stats, error) {
+	if len(header) != len(record) {
+		return Stats{}, fmt.Errorf("%w: expected %d but got %d", ErrCSVColumnCount, len(header), len(record))
+	}
+
+	var stats Stats
+	for i, column := range header {
+		value := record[i]
+		if value == "" {
+			continue
+		}
+
+		var err error
+		switch column {
+		case "hostname":
+			stats.Hostname = value
+		case "date":
+			stats.Date, err = time.Parse(time.RFC3339Nano, value)
+		case "cpu":
+			stats.CPU, err = strconv.ParseFloat(value, 64)
+		case "disk_used":
+			stats.Disk.Used, err = strconv.Atoi(value)
+		case "disk_total":
+			stats.Disk.Total, err = strconv.Atoi(value)
+		case "mem_used":
+			stats.Mem.Used, err = strconv.Atoi(value)
+		case "mem_total":
+			stats.Mem.Total, err = strconv.Atoi(value)
+		case "processes":
+			err = json.Unmarshal([]byte(value), &stats.Processes)
+		case "cores":
+			err = json.Unmarshal([]byte(value), &stats.Cores)
+		case "load":
+			err = json.Unmarshal([]byte(value), &stats.Load)
+		case "mounts":
+			err = json.Unmarshal([]byte(value), &stats.Mounts)
+		case "interfaces":
+			err = json.Unmarshal([]byte(value), &stats.Interfaces)
+		default:
+			if !strings.HasPrefix(column, CSVMetricPrefix) {
+				return Stats{}, fmt.Errorf("%w: '%s'", ErrUnknownCSVColumn, column)
+			}
+			if stats.Metrics == nil {
+				stats.Metrics = make(map[string]float64)
+			}
+			stats.Metrics[strings.TrimPrefix(column, CSVMetricPrefix)], err = strconv.ParseFloat(value, 64)
+		}
+		if err != nil {
+			return Stats{}, fmt.Errorf("db: Could not read the CSV column '%s': %w", column, err)
+		}
+	}
+
+	return stats, nil
+}
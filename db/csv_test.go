@@ -0,0 +1,83 @@
+package db_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats_CSVRecord(t *testing.T) {
+	t.Run("should flatten the stats and read them back", func(t *testing.T) {
+		stats := db.Stats{
+			Hostname:   "foo",
+			Date:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			CPU:        0.5,
+			Processes:  []db.Process{{Name: "bash", Pid: 1, StartTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}},
+			Disk:       db.Memory{Used: 1, Total: 2},
+			Mem:        db.Memory{Used: 3, Total: 4},
+			Metrics:    map[string]float64{"load1": 1.5},
+			Cores:      []float64{0.25, 0.75},
+			Load:       &db.LoadAverage{Load1: 1, Load5: 2, Load15: 3},
+			Mounts:     []db.Mount{{Path: "/", FsType: "ext4", Used: 1, Total: 2, InodesUsed: 3, InodesTotal: 4}},
+			Interfaces: []db.NetworkInterface{{Name: "eth0", RxBytes: 1, TxBytes: 2, RxErrors: 3, TxErrors: 4}},
+		}
+		header := db.CSVHeader([]string{"load1", "temp"})
+
+		record, err := stats.CSVRecord([]string{"load1", "temp"})
+		require.NoError(t, err)
+		require.Len(t, record, len(header))
+		require.Equal(t, "", record[len(record)-1])
+
+		got, err := db.StatsFromCSVRecord(header, record)
+		require.NoError(t, err)
+		require.Equal(t, stats, got)
+	})
+}
+
+func TestStats_CSVRecord_WithoutDetails(t *testing.T) {
+	t.Run("should keep missing details empty", func(t *testing.T) {
+		stats := db.Stats{Hostname: "foo", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+		record, err := stats.CSVRecord(nil)
+		require.NoError(t, err)
+		got, err := db.StatsFromCSVRecord(db.CSVHeader(nil), record)
+
+		require.NoError(t, err)
+		require.Equal(t, stats, got)
+	})
+}
+
+func TestStatsFromCSVRecord(t *testing.T) {
+	t.Run("should return error on wrong column count", func(t *testing.T) {
+		_, err := db.StatsFromCSVRecord([]string{"hostname", "cpu"}, []string{"foo"})
+
+		require.True(t, errors.Is(err, db.ErrCSVColumnCount))
+	})
+
+	t.Run("should return error on invalid value", func(t *testing.T) {
+		_, err := db.StatsFromCSVRecord([]string{"cpu"}, []string{"much"})
+
+		require.Error(t, err)
+	})
+}
+
+func TestValidateCSVHeader(t *testing.T) {
+	t.Run("should accept known columns and metrics", func(t *testing.T) {
+		require.NoError(t, db.ValidateCSVHeader(db.CSVHeader([]string{"load1"})))
+	})
+
+	t.Run("should reject unknown columns", func(t *testing.T) {
+		err := db.ValidateCSVHeader([]string{"hostname", "temperature"})
+
+		require.True(t, errors.Is(err, db.ErrUnknownCSVColumn))
+	})
+
+	t.Run("should reject invalid metric names", func(t *testing.T) {
+		err := db.ValidateCSVHeader([]string{"metric.1load"})
+
+		require.True(t, errors.Is(err, db.ErrInvalidMetricName))
+	})
+}
@@ -1,6 +1,9 @@
 package db
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	// ErrHostNotFound error if the host could not be found.
@@ -9,13 +12,20 @@ var (
 	ErrHostsNotFound = errors.New("db: No hosts found")
 	// ErrAllEntriesSkipped if all entries are beeing skiped.
 	ErrAllEntriesSkipped = errors.New("db: All entries skipped")
+	// ErrMergeSameHost if a host should be merged into itself.
+	ErrMergeSameHost = errors.New("db: Can not merge a host into itself")
+	// ErrInvalidMetricName if a custom metric has a name that is not allowed.
+	ErrInvalidMetricName = errors.New("db: Invalid metric name")
+	// ErrInvalidStatsCursor if a StatsCursor was not returned by the same backend.
+	ErrInvalidStatsCursor = errors.New("db: Invalid stats cursor")
 )
 
 // HostDB is an interface to acquire information of the hosts saved inside the DB and to update them.
 type HostDB interface {
-	// GetHosts returns all hosts respecting to the pagination.
+	// GetHosts returns all hosts sorted by the query respecting to the pagination.
 	// Returns an ErrHostsNotFound if no hosts could be found or ErrAllEntriesSkipped if the skip values is to high.
-	GetHosts(pagination Pagination) ([]HostInfo, error)
+	// Returns ErrUnknownHostSort or ErrUnknownSortOrder for an invalid query.
+	GetHosts(query HostQuery, pagination Pagination) ([]HostInfo, error)
 
 	// GetHost by the hostname.
 	// Returns ErrHostNotFound if no host with the host name could be found.
@@ -25,10 +35,61 @@ type HostDB interface {
 	// Returns ErrHostNotFound if no host with the host name could be found or ErrAllEntriesSkipped if the skip values is to high.
 	GetStatsByHostname(hostname string, pagination Pagination) ([]Stats, error)
 
+	// GetStatsPage gets up to limit stats entries for a hostname with the newest first that are older than the cursor.
+	// An empty cursor starts with the newest stats. The returned cursor points to the last returned entry.
+	// Unlike a skip the cursor is not shifted by stats inserted meanwhile, so no entry is returned twice while walking all pages.
+	// Returns ErrHostNotFound if no host with the host name could be found or ErrInvalidStatsCursor for a cursor of another backend.
+	GetStatsPage(hostname string, cursor StatsCursor, limit int) ([]Stats, StatsCursor, error)
+
 	// InsertStats insert a new stats dataset into the db.
+	// Stats without a date get the insert time as date, so that the retention can delete them.
 	InsertStats(hostname string, stats Stats) error
+
+	// DeleteHost removes a host with all of its stats and events.
+	// Returns ErrHostNotFound if no host with the host name could be found.
+	DeleteHost(hostname string) error
+
+	// MergeHosts moves all stats and events from the source host into the target host and removes the source host.
+	// If the target does not exist the source host gets renamed.
+	// The merged stats are ordered by their date with the newest first.
+	// Returns ErrHostNotFound if the source host could not be found or ErrMergeSameHost if source and target are the same.
+	MergeHosts(source, target string) error
+
+	// DeleteStatsBefore removes all stats of all hosts with a date before the given date.
+	// Stats without a date, e.g. from a restored backup, are kept. Returns the amount of deleted stats.
+	DeleteStatsBefore(date time.Time) (int, error)
+
+	// InsertEvent inserts a new event into the db.
+	// Returns the event with its new ID.
+	InsertEvent(event Event) (Event, error)
+
+	// GetEvents returns all events matching the filter with the newest first respecting the pagination.
+	// Returns ErrAllEntriesSkipped if the skip values is to high.
+	GetEvents(filter EventFilter, pagination Pagination) ([]Event, error)
+
+	// Snapshot returns a copy of all hosts with their stats and all events without blocking the inserts.
+	// The stats of every host are copied consistently.
+	Snapshot() (Snapshot, error)
+
+	// Restore replaces all data inside the db with the snapshot.
+	Restore(snapshot Snapshot) error
+
+	// Close flushes the data and releases the resources of the backend like an open file.
+	// The db must not be used after it got closed.
+	Close() error
 }
 
+// Snapshot is a consistent copy of all data inside a db.
+// It is independent of the backend so that data can be moved between backends.
+type Snapshot struct {
+	Hosts  []Host
+	Events []Event
+}
+
+// StatsCursor is the position of a stats entry of a host returned by GetStatsPage.
+// Its content depends on the backend.
+type StatsCursor string
+
 type Pagination struct {
 	Skip  int
 	Limit int
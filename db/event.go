@@ -0,0 +1,60 @@
+package db
+
+import (
+	"sort"
+	"time"
+)
+
+// Event is an annotation like a deploy or an incident that can be overlaid on the stats.
+// Events without a hostname are fleet wide.
+type Event struct {
+	ID       int       `json:"id"`
+	Hostname string    `json:"hostname,omitempty"`
+	Date     time.Time `json:"date"`
+	Title    string    `json:"title"`
+	Tags     []string  `json:"tags"`
+	Text     string    `json:"text"`
+}
+
+// EventFilter describes which events should be returned.
+// Zero values don't filter.
+type EventFilter struct {
+	// Hostname selects the events of the host together with the fleet wide events.
+	Hostname string
+	// From is the inclusive beginning of the time range.
+	From time.Time
+	// To is the inclusive end of the time range.
+	To time.Time
+	// Tags that all have to be set on an event.
+	Tags []string
+}
+
+// Matches checks if the event passes the filter.
+func (ef EventFilter) Matches(event Event) bool {
+	if ef.Hostname != "" && event.Hostname != "" && event.Hostname != ef.Hostname {
+		return false
+	}
+	if !ef.From.IsZero() && event.Date.Before(ef.From) {
+		return false
+	}
+	if !ef.To.IsZero() && event.Date.After(ef.To) {
+		return false
+	}
+	for _, tag := range ef.Tags {
+		if !isIncluded(event.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortEventsByDate sorts the events in place with the newest date first.
+// Events with the same date are sorted by their ID with the newest first.
+func sortEventsByDate(events []Event) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Date.Equal(events[j].Date) {
+			return events[i].ID > events[j].ID
+		}
+		return events[i].Date.After(events[j].Date)
+	})
+}
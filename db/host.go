@@ -1,6 +1,23 @@
 package db
 
-import "time"
+import (
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnknownHostSort if the hosts should be sorted by an unknown field.
+	ErrUnknownHostSort = errors.New("db: Unknown host sort")
+	// ErrUnknownSortOrder if the sort order is neither ascending nor descending.
+	ErrUnknownSortOrder = errors.New("db: Unknown sort order")
+	// ErrInvalidHostFilter if a filter of the HostQuery can not be used.
+	ErrInvalidHostFilter = errors.New("db: Invalid host filter")
+)
 
 // Host representation of a Host inside the DB.
 type Host struct {
@@ -14,3 +31,161 @@ type HostInfo struct {
 	DataPoints int
 	LastInsert time.Time
 }
+
+// HostSort is the field of the HostInfo to sort the hosts by.
+type HostSort string
+
+// The fields the hosts can be sorted by.
+const (
+	SortByHostname   HostSort = "hostname"
+	SortByLastInsert HostSort = "lastInsert"
+	SortByDataPoints HostSort = "dataPoints"
+)
+
+// SortOrder is the direction of a sort.
+type SortOrder string
+
+// The directions of a sort.
+const (
+	OrderAsc  SortOrder = "asc"
+	OrderDesc SortOrder = "desc"
+)
+
+// HostQuery defines which hosts GetHosts returns and in which order.
+// The zero value returns all hosts sorted by the hostname in ascending order.
+type HostQuery struct {
+	Sort  HostSort
+	Order SortOrder
+
+	// Search keeps the hosts with a hostname containing the string.
+	Search string
+	// Match keeps the hosts with a hostname matching the glob pattern like "web-*".
+	Match string
+	// Regex keeps the hosts with a hostname matching the regular expression.
+	Regex string
+	// LastSeenWithin keeps the hosts with a LastInsert inside the duration. Zero disables the filter.
+	LastSeenWithin time.Duration
+}
+
+// Validate checks if the sort and the order are known.
+func (q HostQuery) Validate() error {
+	switch q.Sort {
+	case "", SortByHostname, SortByLastInsert, SortByDataPoints:
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownHostSort, q.Sort)
+	}
+
+	switch q.Order {
+	case "", OrderAsc, OrderDesc:
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownSortOrder, q.Order)
+	}
+
+	_, err := q.filter(time.Now())
+	return err
+}
+
+// filtered checks if the query has any filter set.
+func (q HostQuery) filtered() bool {
+	return q.Search != "" || q.Match != "" || q.Regex != "" || q.LastSeenWithin != 0
+}
+
+// filter returns a function that checks if a host matches all filters of the query.
+func (q HostQuery) filter(now time.Time) (func(host HostInfo) bool, error) {
+	if _, err := path.Match(q.Match, ""); err != nil {
+		return nil, fmt.Errorf("%w: match '%s': %v", ErrInvalidHostFilter, q.Match, err)
+	}
+	regex, err := regexp.Compile(q.Regex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: regex '%s': %v", ErrInvalidHostFilter, q.Regex, err)
+	}
+	if q.LastSeenWithin < 0 {
+		return nil, fmt.Errorf("%w: negative lastSeenWithin '%s'", ErrInvalidHostFilter, q.LastSeenWithin)
+	}
+
+	return func(host HostInfo) bool {
+		if !strings.Contains(host.Hostname, q.Search) {
+			return false
+		}
+		if q.Match != "" {
+			if matched, _ := path.Match(q.Match, host.Hostname); !matched {
+				return false
+			}
+		}
+		if q.Regex != "" && !regex.MatchString(host.Hostname) {
+			return false
+		}
+		if q.LastSeenWithin != 0 && host.LastInsert.Before(now.Add(-q.LastSeenWithin)) {
+			return false
+		}
+		return true
+	}, nil
+}
+
+// hostnamePrefix returns a prefix that all hostnames matching the query start with.
+// Backends with hosts ordered by the hostname can seek to it instead of reading all hosts.
+func (q HostQuery) hostnamePrefix() string {
+	prefix := q.Match
+	if i := strings.IndexAny(prefix, `*?[\`); i >= 0 {
+		prefix = prefix[:i]
+	}
+
+	// only an anchored regex guarantees that its literal prefix is at the beginning of the hostname
+	if strings.HasPrefix(q.Regex, "^") {
+		if regex, err := regexp.Compile(q.Regex); err == nil {
+			if regexPrefix, _ := regex.LiteralPrefix(); len(regexPrefix) > len(prefix) {
+				prefix = regexPrefix
+			}
+		}
+	}
+	return prefix
+}
+
+// sortedByHostname checks if the hosts are only sorted by the hostname.
+func (q HostQuery) sortedByHostname() bool {
+	return q.Sort == "" || q.Sort == SortByHostname
+}
+
+// descending checks if the sort order is reversed.
+func (q HostQuery) descending() bool {
+	return q.Order == OrderDesc
+}
+
+// sortHosts sorts the hosts by the query.
+// Hosts with equal values are sorted by the hostname in ascending order so that the result is deterministic.
+func sortHosts(hosts []HostInfo, query HostQuery) {
+	less := func(a, b HostInfo) bool {
+		switch query.Sort {
+		case SortByLastInsert:
+			if !a.LastInsert.Equal(b.LastInsert) {
+				return a.LastInsert.Before(b.LastInsert) != query.descending()
+			}
+		case SortByDataPoints:
+			if a.DataPoints != b.DataPoints {
+				return (a.DataPoints < b.DataPoints) != query.descending()
+			}
+		default:
+			return (a.Hostname < b.Hostname) != query.descending()
+		}
+		return a.Hostname < b.Hostname
+	}
+
+	sort.Slice(hosts, func(i, j int) bool { return less(hosts[i], hosts[j]) })
+}
+
+// pageHosts returns the hosts of the page.
+// It returns an error if there are no hosts or all entries are beeing skiped.
+func pageHosts(hosts []HostInfo, pagination Pagination) ([]HostInfo, error) {
+	if len(hosts) == 0 {
+		return []HostInfo{}, ErrHostsNotFound
+	}
+
+	records := len(hosts)
+	if records < pagination.Skip {
+		return []HostInfo{}, ErrAllEntriesSkipped
+	} else if records < (pagination.Skip + pagination.Limit) {
+		return hosts[pagination.Skip:], nil
+	}
+
+	return hosts[pagination.Skip:(pagination.Skip + pagination.Limit)], nil
+}
@@ -1,129 +1,389 @@
 package db
 
 import (
+	"fmt"
+	"math"
+	"strconv"
 	"sync"
 	"time"
 )
 
 // NewInMemoryDB a constructor to build a new inMemoryDB.
 func NewInMemoryDB() *InMemoryDB {
-	return &InMemoryDB{storage: make(map[string]Host), m: sync.Mutex{}}
+	return &InMemoryDB{storage: make(map[string]*memHost)}
 }
 
 // InMemoryDB a in memory DB implementing the db.HostDB interface.
+//
+// The storage is an index of hosts guarded by a RWMutex and every host has its own lock.
+// Operations on a single host only hold a read lock on the index so that hosts can be read and written in parallel.
+// Creating, deleting and merging hosts need the write lock of the index.
+// The lock of the index is always acquired before the lock of a host or the events.
 type InMemoryDB struct {
-	storage map[string]Host
-	m       sync.Mutex
+	storage map[string]*memHost
+	m       sync.RWMutex
+
+	events  []Event
+	eventID int
+	eventsM sync.RWMutex
+}
+
+// Close does nothing because the InMemoryDB holds no resources.
+func (db *InMemoryDB) Close() error {
+	return nil
+}
+
+// memHost is a host inside the InMemoryDB.
+type memHost struct {
+	info  HostInfo
+	stats statsChunks
+	m     sync.RWMutex
+}
+
+func newMemHost(host Host) *memHost {
+	return &memHost{info: host.HostInfo, stats: newStatsChunks(host.Stats)}
 }
 
 // WithCustomStorage allows to put a custom map as DB storage.
+// The stats of the hosts are expected to be ordered with the newest first.
 // Returns a new InMemoryDB.
 func (db *InMemoryDB) WithCustomStorage(storage map[string]Host) *InMemoryDB {
-	db.m.Lock()
-	defer db.m.Unlock()
+	hosts := make(map[string]*memHost, len(storage))
+	for hostname, host := range storage {
+		hosts[hostname] = newMemHost(host)
+	}
 
-	return &InMemoryDB{storage: storage, m: sync.Mutex{}}
+	return &InMemoryDB{storage: hosts}
 }
 
-// GetHosts returns a paginated result of all hosts.
+// GetHosts returns a paginated result of all hosts matching the query sorted by it.
 // It returns an error if no host was found or all entries are beeing skiped.
-func (db *InMemoryDB) GetHosts(pagination Pagination) ([]HostInfo, error) {
-	db.m.Lock()
-	defer db.m.Unlock()
-
-	hosts := make([]HostInfo, 0)
-	for _, value := range db.storage {
-		hosts = append(hosts, value.HostInfo)
+func (db *InMemoryDB) GetHosts(query HostQuery, pagination Pagination) ([]HostInfo, error) {
+	if err := query.Validate(); err != nil {
+		return []HostInfo{}, err
 	}
-
-	if len(hosts) == 0 {
-		return []HostInfo{}, ErrHostsNotFound
+	matches, err := query.filter(time.Now())
+	if err != nil {
+		return []HostInfo{}, err
 	}
 
-	records := len(hosts)
-	if records < pagination.Skip {
-		return []HostInfo{}, ErrAllEntriesSkipped
-	} else if records < (pagination.Skip + pagination.Limit) {
-		hosts = hosts[pagination.Skip:]
-		foundHosts := make([]HostInfo, len(hosts))
-		copy(foundHosts, hosts)
-		return foundHosts, nil
+	db.m.RLock()
+	hosts := make([]HostInfo, 0, len(db.storage))
+	for _, host := range db.storage {
+		host.m.RLock()
+		if matches(host.info) {
+			hosts = append(hosts, host.info)
+		}
+		host.m.RUnlock()
 	}
+	db.m.RUnlock()
 
-	hosts = hosts[pagination.Skip:(pagination.Skip + pagination.Limit)]
-	foundHosts := make([]HostInfo, len(hosts))
-	copy(foundHosts, hosts)
-	return foundHosts, nil
+	sortHosts(hosts, query)
+	return pageHosts(hosts, pagination)
 }
 
 // GetHost returns a host with the matching hostname.
 // If no host could be found it will return an error.
 func (db *InMemoryDB) GetHost(hostname string) (HostInfo, error) {
-	db.m.Lock()
-	defer db.m.Unlock()
+	db.m.RLock()
+	defer db.m.RUnlock()
 
 	host, found := db.storage[hostname]
 	if !found {
 		return HostInfo{}, ErrHostNotFound
 	}
 
-	return host.HostInfo, nil
+	host.m.RLock()
+	defer host.m.RUnlock()
+	return host.info, nil
 }
 
 // GetStatsByHostname gets all Stats in a paginated form from a specific host.
 // It returns errors if no host is found or if all entries are beeing skiped.
 func (db *InMemoryDB) GetStatsByHostname(hostname string, pagination Pagination) ([]Stats, error) {
-	db.m.Lock()
-	defer db.m.Unlock()
+	db.m.RLock()
+	defer db.m.RUnlock()
 
 	host, found := db.storage[hostname]
 	if !found {
 		return []Stats{}, ErrHostNotFound
 	}
 
-	records := len(host.Stats)
-	if records < pagination.Skip {
+	host.m.RLock()
+	defer host.m.RUnlock()
+
+	if host.stats.len() < pagination.Skip {
 		return []Stats{}, ErrAllEntriesSkipped
-	} else if records < (pagination.Skip + pagination.Limit) {
-		stats := host.Stats[pagination.Skip:]
-		foundStats := make([]Stats, len(stats))
-		copy(foundStats, stats)
-		return foundStats, nil
 	}
 
-	stats := host.Stats[pagination.Skip:(pagination.Skip + pagination.Limit)]
-	foundStats := make([]Stats, len(stats))
-	copy(foundStats, stats)
-	return foundStats, nil
+	return host.stats.newestFirst(pagination.Skip, pagination.Limit), nil
+}
+
+// GetStatsPage gets up to limit stats of a specific host with the newest first that are older than the cursor.
+// The cursor is the insert sequence of the last returned stat.
+// It returns errors if no host is found or if the cursor is not a sequence.
+func (db *InMemoryDB) GetStatsPage(hostname string, cursor StatsCursor, limit int) ([]Stats, StatsCursor, error) {
+	sequence := uint64(math.MaxUint64)
+	if cursor != "" {
+		var err error
+		if sequence, err = strconv.ParseUint(string(cursor), 10, 64); err != nil {
+			return []Stats{}, "", fmt.Errorf("%w: '%s'", ErrInvalidStatsCursor, cursor)
+		}
+	}
+
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	host, found := db.storage[hostname]
+	if !found {
+		return []Stats{}, "", ErrHostNotFound
+	}
+
+	host.m.RLock()
+	defer host.m.RUnlock()
+
+	stats, last := host.stats.before(sequence, limit)
+	if len(stats) == 0 {
+		return stats, cursor, nil
+	}
+	return stats, StatsCursor(strconv.FormatUint(last, 10)), nil
 }
 
 // InsertStats into the DB.
 // To do so it takes the hostname of the Hostname field and creates a new host inside the DB and/or adds the stat to it.
-// The HostInfos are also beeing updated.
+// The HostInfos are also beeing updated and stats without a date get the insert time.
 // This implementation won't return an error but its declared to implement the db.HostDB interface.
 func (db *InMemoryDB) InsertStats(hostname string, stats Stats) error {
+	db.m.RLock()
+	host, found := db.storage[hostname]
+	if found {
+		host.m.Lock()
+		host.insert(stats)
+		host.m.Unlock()
+		db.m.RUnlock()
+		return nil
+	}
+	db.m.RUnlock()
+
 	db.m.Lock()
 	defer db.m.Unlock()
 
-	host, found := db.storage[hostname]
+	// the host could have been created while no lock was held
+	host, found = db.storage[hostname]
 	if !found {
-		hostInfo := HostInfo{Hostname: hostname, DataPoints: 1, LastInsert: time.Now()}
-		db.storage[hostname] = Host{HostInfo: hostInfo, Stats: []Stats{stats}}
-		return nil
+		host = newMemHost(Host{HostInfo: HostInfo{Hostname: hostname}})
+		db.storage[hostname] = host
+	}
+	host.insert(stats)
+	return nil
+}
+
+// insert appends the stats and updates the HostInfo.
+// The caller has to hold the lock of the host.
+// Stats without a date get the insert time.
+func (host *memHost) insert(stats Stats) {
+	now := time.Now()
+	if stats.Date.IsZero() {
+		stats.Date = now.UTC()
+	}
+	host.stats.append(stats)
+	host.info.DataPoints++
+	host.info.LastInsert = now
+}
+
+// DeleteHost removes the host with all its stats and events from the storage.
+// It returns an error if no host could be found.
+func (db *InMemoryDB) DeleteHost(hostname string) error {
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	if _, found := db.storage[hostname]; !found {
+		return ErrHostNotFound
+	}
+	delete(db.storage, hostname)
+
+	db.eventsM.Lock()
+	defer db.eventsM.Unlock()
+
+	events := make([]Event, 0, len(db.events))
+	for _, event := range db.events {
+		if event.Hostname != hostname {
+			events = append(events, event)
+		}
+	}
+	db.events = events
+	return nil
+}
+
+// MergeHosts moves the stats of the source host into the target host.
+// If the target host does not exist the source host will be renamed.
+// Existing stats get interleaved by their date and the HostInfos are recalculated.
+func (db *InMemoryDB) MergeHosts(source, target string) error {
+	if source == target {
+		return ErrMergeSameHost
+	}
+
+	db.m.Lock()
+	defer db.m.Unlock()
+
+	sourceHost, found := db.storage[source]
+	if !found {
+		return ErrHostNotFound
+	}
+
+	targetHost, found := db.storage[target]
+	if !found {
+		targetHost = newMemHost(Host{HostInfo: HostInfo{Hostname: target}})
+	}
+
+	stats := make([]Stats, 0, sourceHost.stats.len()+targetHost.stats.len())
+	stats = append(stats, targetHost.stats.all()...)
+	for _, stat := range sourceHost.stats.all() {
+		stat.Hostname = target
+		stats = append(stats, stat)
 	}
+	sortStatsByDate(stats)
 
-	host.Stats = db.insertAtBeginning(host.Stats, stats)
-	host.HostInfo.DataPoints++
-	host.HostInfo.LastInsert = time.Now()
+	hostInfo := targetHost.info
+	hostInfo.DataPoints = len(stats)
+	if sourceHost.info.LastInsert.After(hostInfo.LastInsert) {
+		hostInfo.LastInsert = sourceHost.info.LastInsert
+	}
+
+	db.storage[target] = newMemHost(Host{HostInfo: hostInfo, Stats: stats})
+	delete(db.storage, source)
 
-	db.storage[hostname] = host
+	db.eventsM.Lock()
+	defer db.eventsM.Unlock()
+
+	for i, event := range db.events {
+		if event.Hostname == source {
+			db.events[i].Hostname = target
+		}
+	}
 	return nil
 }
 
-func (db *InMemoryDB) insertAtBeginning(stats []Stats, stat Stats) []Stats {
-	stats = append(stats, Stats{})
-	copy(stats[1:], stats)
-	stats[0] = stat
+// DeleteStatsBefore removes the stats older than the date from all hosts and updates the DataPoints.
+// Stats without a date are kept.
+// Only one host at a time is locked and hosts without old stats are skipped by the date ranges of their chunks.
+// This implementation won't return an error but its declared to implement the db.HostDB interface.
+func (db *InMemoryDB) DeleteStatsBefore(date time.Time) (int, error) {
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	deleted := 0
+	for _, host := range db.storage {
+		host.m.Lock()
+		// the sequences are kept so that the cursors of running walks stay valid
+		if removed := host.stats.deleteBefore(date); removed > 0 {
+			deleted += removed
+			host.info.DataPoints = host.stats.len()
+		}
+		host.m.Unlock()
+	}
+	return deleted, nil
+}
+
+// InsertEvent into the DB.
+// The event gets a new ID assigned.
+// This implementation won't return an error but its declared to implement the db.HostDB interface.
+func (db *InMemoryDB) InsertEvent(event Event) (Event, error) {
+	db.eventsM.Lock()
+	defer db.eventsM.Unlock()
+
+	db.eventID++
+	event.ID = db.eventID
+	db.events = append(db.events, event)
+	return event, nil
+}
+
+// GetEvents gets all events matching the filter in a paginated form with the newest first.
+// It returns an error if all entries are beeing skiped.
+func (db *InMemoryDB) GetEvents(filter EventFilter, pagination Pagination) ([]Event, error) {
+	db.eventsM.RLock()
+	events := make([]Event, 0)
+	for _, event := range db.events {
+		if filter.Matches(event) {
+			events = append(events, event)
+		}
+	}
+	db.eventsM.RUnlock()
+	sortEventsByDate(events)
 
-	return stats
+	records := len(events)
+	if records < pagination.Skip {
+		return []Event{}, ErrAllEntriesSkipped
+	} else if records < (pagination.Skip + pagination.Limit) {
+		return events[pagination.Skip:], nil
+	}
+
+	return events[pagination.Skip:(pagination.Skip + pagination.Limit)], nil
+}
+
+// MemoryUsage estimates the bytes the stats of all hosts occupy in memory.
+// The size is tracked on every change so that no stats need to be read.
+func (db *InMemoryDB) MemoryUsage() int {
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	usage := 0
+	for _, host := range db.storage {
+		host.m.RLock()
+		usage += host.stats.size()
+		host.m.RUnlock()
+	}
+	return usage
+}
+
+// Snapshot returns a copy of all hosts and events.
+// Only the read lock of the index and of one host at a time is held, so stats can be inserted during the copy.
+// Every host is copied consistently, but stats inserted into another host meanwhile may be part of the snapshot.
+// This implementation won't return an error but its declared to implement the db.HostDB interface.
+func (db *InMemoryDB) Snapshot() (Snapshot, error) {
+	db.m.RLock()
+	defer db.m.RUnlock()
+
+	hosts := make([]Host, 0, len(db.storage))
+	for _, host := range db.storage {
+		host.m.RLock()
+		hosts = append(hosts, Host{HostInfo: host.info, Stats: host.stats.all()})
+		host.m.RUnlock()
+	}
+
+	db.eventsM.RLock()
+	defer db.eventsM.RUnlock()
+
+	events := make([]Event, len(db.events))
+	copy(events, db.events)
+
+	return Snapshot{Hosts: hosts, Events: events}, nil
+}
+
+// Restore replaces the storage and the events with the ones from the snapshot.
+// This implementation won't return an error but its declared to implement the db.HostDB interface.
+func (db *InMemoryDB) Restore(snapshot Snapshot) error {
+	storage := make(map[string]*memHost, len(snapshot.Hosts))
+	for _, host := range snapshot.Hosts {
+		storage[host.HostInfo.Hostname] = newMemHost(host)
+	}
+
+	events := make([]Event, len(snapshot.Events))
+	copy(events, snapshot.Events)
+	eventID := 0
+	for _, event := range events {
+		if event.ID > eventID {
+			eventID = event.ID
+		}
+	}
+
+	db.m.Lock()
+	defer db.m.Unlock()
+	db.eventsM.Lock()
+	defer db.eventsM.Unlock()
+
+	db.storage = storage
+	db.events = events
+	db.eventID = eventID
+	return nil
 }
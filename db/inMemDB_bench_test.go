@@ -0,0 +1,87 @@
+package db_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+)
+
+const benchHosts = 100
+
+func newBenchDB(b *testing.B, statsPerHost int) (*db.InMemoryDB, []string) {
+	b.Helper()
+	memDB := db.NewInMemoryDB()
+	hostnames := make([]string, benchHosts)
+	for i := range hostnames {
+		hostnames[i] = fmt.Sprintf("host-%d", i)
+		for j := 0; j < statsPerHost; j++ {
+			if err := memDB.InsertStats(hostnames[i], db.Stats{Hostname: hostnames[i], CPU: float64(j)}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	return memDB, hostnames
+}
+
+func BenchmarkInMemoryDB_InsertStats(b *testing.B) {
+	memDB := db.NewInMemoryDB()
+	stats := db.Stats{Hostname: "foo"}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := memDB.InsertStats("foo", stats); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkInMemoryDB_ParallelReadWrite simulates many agents inserting stats while the API gets read.
+// writePercent of the operations are inserts, a tenth of the rest lists the hosts and the others read the newest stats.
+func BenchmarkInMemoryDB_ParallelReadWrite(b *testing.B) {
+	for _, writePercent := range []int{10, 50, 90} {
+		b.Run(fmt.Sprintf("writes=%d%%", writePercent), func(b *testing.B) {
+			memDB, hostnames := newBenchDB(b, 1000)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				r := rand.New(rand.NewSource(rand.Int63()))
+				for pb.Next() {
+					hostname := hostnames[r.Intn(len(hostnames))]
+					switch op := r.Intn(100); {
+					case op < writePercent:
+						if err := memDB.InsertStats(hostname, db.Stats{Hostname: hostname}); err != nil {
+							b.Fatal(err)
+						}
+					case op < writePercent+(100-writePercent)/10:
+						if _, err := memDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 10}); err != nil {
+							b.Fatal(err)
+						}
+					default:
+						if _, err := memDB.GetStatsByHostname(hostname, db.Pagination{Skip: 0, Limit: 10}); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkInMemoryDB_DeleteStatsBefore runs the retention over hosts that have no stats to delete, like most of its runs.
+func BenchmarkInMemoryDB_DeleteStatsBefore(b *testing.B) {
+	memDB, _ := newBenchDB(b, 1000)
+	date := time.Now().Add(-time.Hour)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := memDB.DeleteStatsBefore(date); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
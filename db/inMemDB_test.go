@@ -5,9 +5,14 @@ import (
 	"time"
 
 	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/dbtest"
 	"github.com/stretchr/testify/require"
 )
 
+func TestInMemoryDB_Conformance(t *testing.T) {
+	dbtest.RunConformance(t, func() db.HostDB { return db.NewInMemoryDB() })
+}
+
 func TestGetHosts(t *testing.T) {
 	t.Run("should return all 2 hosts", func(t *testing.T) {
 		storage := make(map[string]db.Host)
@@ -16,8 +21,8 @@ func TestGetHosts(t *testing.T) {
 
 		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
 
-		got, err := memDB.GetHosts(db.Pagination{0, 2})
-		want := []db.HostInfo{{Hostname: "foo"}, {Hostname: "bar"}}
+		got, err := memDB.GetHosts(db.HostQuery{}, db.Pagination{0, 2})
+		want := []db.HostInfo{{Hostname: "bar"}, {Hostname: "foo"}}
 
 		require.NoError(t, err)
 		require.EqualValues(t, want, got)
@@ -25,7 +30,7 @@ func TestGetHosts(t *testing.T) {
 
 	t.Run("should not find hosts on empty db", func(t *testing.T) {
 		memDB := db.NewInMemoryDB()
-		_, gotErr := memDB.GetHosts(db.Pagination{Skip: 0, Limit: 0})
+		_, gotErr := memDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 0})
 		want := db.ErrHostsNotFound.Error()
 
 		require.EqualError(t, gotErr, want)
@@ -37,7 +42,7 @@ func TestGetHosts(t *testing.T) {
 
 		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
 
-		_, gotErr := memDB.GetHosts(db.Pagination{Skip: 2, Limit: 0})
+		_, gotErr := memDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 2, Limit: 0})
 		want := db.ErrAllEntriesSkipped.Error()
 
 		require.EqualError(t, gotErr, want)
@@ -50,7 +55,7 @@ func TestGetHosts(t *testing.T) {
 
 		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
 
-		got, err := memDB.GetHosts(db.Pagination{Skip: 0, Limit: 3})
+		got, err := memDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 3})
 		want := 2
 
 		require.NoError(t, err)
@@ -142,6 +147,33 @@ func TestGetStatsByHostname(t *testing.T) {
 	})
 }
 
+func TestGetStatsByHostname_ManyStats(t *testing.T) {
+	t.Run("should paginate over more stats than fit into one chunk", func(t *testing.T) {
+		// the custom storage is ordered with the newest first
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		stats := make([]db.Stats, 0, 500)
+		for i := 499; i >= 0; i-- {
+			stats = append(stats, db.Stats{Hostname: "foo", Date: date, CPU: float64(i)})
+		}
+		storage := map[string]db.Host{"foo": {HostInfo: db.HostInfo{Hostname: "foo"}, Stats: stats}}
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+		for i := 500; i < 1000; i++ {
+			require.NoError(t, memDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date, CPU: float64(i)}))
+		}
+
+		for _, pagination := range []db.Pagination{{Skip: 0, Limit: 1000}, {Skip: 250, Limit: 300}, {Skip: 995, Limit: 10}} {
+			got, err := memDB.GetStatsByHostname("foo", pagination)
+			require.NoError(t, err)
+
+			want := make([]db.Stats, 0)
+			for i := 999 - pagination.Skip; i >= 0 && len(want) < pagination.Limit; i-- {
+				want = append(want, db.Stats{Hostname: "foo", Date: date, CPU: float64(i)})
+			}
+			require.Equal(t, want, got)
+		}
+	})
+}
+
 func TestInsertStats_UpdateHostInfos(t *testing.T) {
 	t.Run("should add new host in storage if not existing", func(t *testing.T) {
 		hostname := "foo"
@@ -188,7 +220,7 @@ func TestInsertStats_UpdateHostInfos(t *testing.T) {
 func TestInsertStats_AddStatsToHost(t *testing.T) {
 	t.Run("should add the stats to a new host", func(t *testing.T) {
 		hostname := "foo"
-		stats := db.Stats{Hostname: hostname}
+		stats := db.Stats{Hostname: hostname, Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
 
 		memDB := db.NewInMemoryDB()
 
@@ -227,3 +259,312 @@ func TestInsertStats_AddStatsToHost(t *testing.T) {
 
 	})
 }
+
+func TestDeleteHost(t *testing.T) {
+	t.Run("should remove the host from the storage", func(t *testing.T) {
+		hostname := "foo"
+
+		storage := make(map[string]db.Host)
+		storage[hostname] = db.Host{HostInfo: db.HostInfo{Hostname: hostname}}
+
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+
+		err := memDB.DeleteHost(hostname)
+		require.NoError(t, err)
+
+		_, gotErr := memDB.GetHost(hostname)
+		require.EqualError(t, gotErr, db.ErrHostNotFound.Error())
+	})
+
+	t.Run("should return error if no host matching the name was found", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+
+		gotErr := memDB.DeleteHost("foo")
+		want := db.ErrHostNotFound.Error()
+
+		require.EqualError(t, gotErr, want)
+	})
+}
+
+func TestMergeHosts(t *testing.T) {
+	t.Run("should rename the host if the target does not exist", func(t *testing.T) {
+		lastInsert := time.Now()
+		stats := []db.Stats{{Hostname: "foo"}}
+
+		storage := make(map[string]db.Host)
+		storage["foo"] = db.Host{HostInfo: db.HostInfo{Hostname: "foo", DataPoints: 1, LastInsert: lastInsert}, Stats: stats}
+
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+
+		err := memDB.MergeHosts("foo", "bar")
+		require.NoError(t, err)
+
+		_, err = memDB.GetHost("foo")
+		require.EqualError(t, err, db.ErrHostNotFound.Error())
+
+		got, err := memDB.GetHost("bar")
+		require.NoError(t, err)
+		require.Equal(t, db.HostInfo{Hostname: "bar", DataPoints: 1, LastInsert: lastInsert}, got)
+
+		gotStats, err := memDB.GetStatsByHostname("bar", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{{Hostname: "bar"}}, gotStats)
+	})
+
+	t.Run("should interleave the stats by date and update the host info", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		oldInsert := date
+		newInsert := date.Add(time.Hour)
+
+		storage := make(map[string]db.Host)
+		storage["foo"] = db.Host{
+			HostInfo: db.HostInfo{Hostname: "foo", DataPoints: 2, LastInsert: newInsert},
+			Stats:    []db.Stats{{Hostname: "foo", Date: date.Add(3 * time.Minute)}, {Hostname: "foo", Date: date.Add(time.Minute)}},
+		}
+		storage["bar"] = db.Host{
+			HostInfo: db.HostInfo{Hostname: "bar", DataPoints: 2, LastInsert: oldInsert},
+			Stats:    []db.Stats{{Hostname: "bar", Date: date.Add(2 * time.Minute)}, {Hostname: "bar", Date: date}},
+		}
+
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+
+		err := memDB.MergeHosts("foo", "bar")
+		require.NoError(t, err)
+
+		got, err := memDB.GetHost("bar")
+		require.NoError(t, err)
+		require.Equal(t, db.HostInfo{Hostname: "bar", DataPoints: 4, LastInsert: newInsert}, got)
+
+		gotStats, err := memDB.GetStatsByHostname("bar", db.Pagination{Skip: 0, Limit: 10})
+		want := []db.Stats{
+			{Hostname: "bar", Date: date.Add(3 * time.Minute)},
+			{Hostname: "bar", Date: date.Add(2 * time.Minute)},
+			{Hostname: "bar", Date: date.Add(time.Minute)},
+			{Hostname: "bar", Date: date},
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, want, gotStats)
+	})
+
+	t.Run("should return error if the source host was not found", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+
+		gotErr := memDB.MergeHosts("foo", "bar")
+		want := db.ErrHostNotFound.Error()
+
+		require.EqualError(t, gotErr, want)
+	})
+
+	t.Run("should return error if source and target are the same", func(t *testing.T) {
+		storage := make(map[string]db.Host)
+		storage["foo"] = db.Host{HostInfo: db.HostInfo{Hostname: "foo"}}
+
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+
+		gotErr := memDB.MergeHosts("foo", "foo")
+		want := db.ErrMergeSameHost.Error()
+
+		require.EqualError(t, gotErr, want)
+	})
+}
+
+func TestEvents(t *testing.T) {
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("should assign ids to new events", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+
+		first, err := memDB.InsertEvent(db.Event{Title: "first"})
+		require.NoError(t, err)
+		second, err := memDB.InsertEvent(db.Event{Title: "second"})
+		require.NoError(t, err)
+
+		require.Equal(t, 1, first.ID)
+		require.Equal(t, 2, second.ID)
+	})
+
+	t.Run("should return the events of a host and the fleet wide events with the newest first", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertEvent(db.Event{Hostname: "foo", Date: date, Title: "foo"})
+		memDB.InsertEvent(db.Event{Hostname: "bar", Date: date, Title: "bar"})
+		memDB.InsertEvent(db.Event{Date: date.Add(time.Hour), Title: "fleet"})
+
+		got, err := memDB.GetEvents(db.EventFilter{Hostname: "foo"}, db.Pagination{Skip: 0, Limit: 10})
+		want := []db.Event{
+			{ID: 3, Date: date.Add(time.Hour), Title: "fleet"},
+			{ID: 1, Hostname: "foo", Date: date, Title: "foo"},
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("should filter by time range and tags", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertEvent(db.Event{Date: date, Title: "old", Tags: []string{"deploy"}})
+		memDB.InsertEvent(db.Event{Date: date.Add(time.Hour), Title: "incident", Tags: []string{"incident"}})
+		memDB.InsertEvent(db.Event{Date: date.Add(time.Hour), Title: "deploy", Tags: []string{"deploy", "web"}})
+
+		filter := db.EventFilter{From: date.Add(time.Minute), To: date.Add(2 * time.Hour), Tags: []string{"deploy"}}
+		got, err := memDB.GetEvents(filter, db.Pagination{Skip: 0, Limit: 10})
+
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, "deploy", got[0].Title)
+	})
+
+	t.Run("should return error if all entries are beeing skiped", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+
+		_, gotErr := memDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 1, Limit: 10})
+
+		require.EqualError(t, gotErr, db.ErrAllEntriesSkipped.Error())
+	})
+
+	t.Run("should delete and merge the events with the host", func(t *testing.T) {
+		storage := make(map[string]db.Host)
+		storage["foo"] = db.Host{HostInfo: db.HostInfo{Hostname: "foo"}}
+		storage["bar"] = db.Host{HostInfo: db.HostInfo{Hostname: "bar"}}
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+		memDB.InsertEvent(db.Event{Hostname: "foo", Title: "foo"})
+		memDB.InsertEvent(db.Event{Hostname: "bar", Title: "bar"})
+
+		require.NoError(t, memDB.MergeHosts("foo", "baz"))
+		got, err := memDB.GetEvents(db.EventFilter{Hostname: "baz"}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Event{{ID: 1, Hostname: "baz", Title: "foo"}}, got)
+
+		require.NoError(t, memDB.DeleteHost("bar"))
+		got, err = memDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+	})
+}
+
+func TestDeleteStatsBefore(t *testing.T) {
+	t.Run("should delete old stats and keep stats without a date", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		stats := []db.Stats{{Date: date.Add(time.Hour)}, {Date: date}, {}, {Date: date.Add(-time.Hour)}}
+
+		storage := make(map[string]db.Host)
+		storage["foo"] = db.Host{HostInfo: db.HostInfo{Hostname: "foo", DataPoints: 4}, Stats: stats}
+
+		memDB := db.NewInMemoryDB().WithCustomStorage(storage)
+
+		deleted, err := memDB.DeleteStatsBefore(date)
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted)
+
+		got, err := memDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, stats[:3], got)
+
+		host, err := memDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 3, host.DataPoints)
+	})
+
+	t.Run("should delete old stats over many chunks", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		memDB := db.NewInMemoryDB()
+		for i := 0; i < 1000; i++ {
+			require.NoError(t, memDB.InsertStats("foo", db.Stats{Date: date.Add(time.Duration(i) * time.Minute), CPU: float64(i)}))
+		}
+		// a late stat inside a chunk that is not expired as a whole
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Date: date, CPU: -1}))
+
+		deleted, err := memDB.DeleteStatsBefore(date.Add(600 * time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 601, deleted)
+
+		got, err := memDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 1000})
+		require.NoError(t, err)
+		require.Len(t, got, 400)
+		require.Equal(t, float64(999), got[0].CPU)
+		require.Equal(t, float64(600), got[399].CPU)
+
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Date: date.Add(1000 * time.Minute), CPU: 1000}))
+		got, err = memDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 2})
+		require.NoError(t, err)
+		require.Equal(t, []float64{1000, 999}, []float64{got[0].CPU, got[1].CPU})
+
+		deleted, err = memDB.DeleteStatsBefore(date.Add(600 * time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 0, deleted)
+	})
+}
+
+func TestMemoryUsage(t *testing.T) {
+	t.Run("should grow with the inserted stats", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		require.Equal(t, 0, memDB.MemoryUsage())
+
+		memDB.InsertStats("foo", db.Stats{Hostname: "foo"})
+		small := memDB.MemoryUsage()
+		require.Greater(t, small, 0)
+
+		memDB.InsertStats("foo", db.Stats{Hostname: "foo", Processes: []db.Process{{Name: "gsave", Command: "/usr/bin/gsave"}}})
+		require.Greater(t, memDB.MemoryUsage(), 2*small)
+	})
+
+	t.Run("should shrink with deleted stats and hosts", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertStats("foo", db.Stats{Date: time.Now().Add(-time.Hour)})
+		memDB.InsertStats("foo", db.Stats{Date: time.Now()})
+		memDB.InsertStats("bar", db.Stats{})
+		full := memDB.MemoryUsage()
+
+		_, err := memDB.DeleteStatsBefore(time.Now().Add(-time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, full*2/3, memDB.MemoryUsage())
+
+		require.NoError(t, memDB.DeleteHost("bar"))
+		require.Equal(t, full/3, memDB.MemoryUsage())
+	})
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	t.Run("should restore the snapshot into another db", func(t *testing.T) {
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		memDB := db.NewInMemoryDB()
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date, CPU: 1}))
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date, CPU: 2}))
+		_, err := memDB.InsertEvent(db.Event{Title: "deploy"})
+		require.NoError(t, err)
+
+		snapshot, err := memDB.Snapshot()
+		require.NoError(t, err)
+
+		restoredDB := db.NewInMemoryDB()
+		require.NoError(t, restoredDB.InsertStats("bar", db.Stats{}))
+		require.NoError(t, restoredDB.Restore(snapshot))
+
+		_, err = restoredDB.GetHost("bar")
+		require.EqualError(t, err, db.ErrHostNotFound.Error(), "the old data should be replaced")
+
+		wantHost, _ := memDB.GetHost("foo")
+		gotHost, err := restoredDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, wantHost, gotHost)
+
+		gotStats, err := restoredDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{{Hostname: "foo", Date: date, CPU: 2}, {Hostname: "foo", Date: date, CPU: 1}}, gotStats)
+
+		event, err := restoredDB.InsertEvent(db.Event{Title: "incident"})
+		require.NoError(t, err)
+		require.Equal(t, 2, event.ID, "the event ids should continue")
+	})
+
+	t.Run("should not change the snapshot on new inserts", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{}))
+
+		snapshot, err := memDB.Snapshot()
+		require.NoError(t, err)
+		require.NoError(t, memDB.InsertStats("foo", db.Stats{}))
+
+		require.Len(t, snapshot.Hosts[0].Stats, 1)
+	})
+}
@@ -0,0 +1,53 @@
+package db
+
+import "errors"
+
+// pageSize is the amount of entries that get requested at once while iterating.
+const pageSize = 100
+
+// ForEachHost calls fn for every host inside the db ordered by the hostname until fn returns false.
+// An empty db is not treated as an error.
+func ForEachHost(hostDB HostDB, fn func(host HostInfo) bool) error {
+	for skip := 0; ; skip += pageSize {
+		hosts, err := hostDB.GetHosts(HostQuery{}, Pagination{Skip: skip, Limit: pageSize})
+		if err != nil {
+			if errors.Is(err, ErrHostsNotFound) || errors.Is(err, ErrAllEntriesSkipped) {
+				return nil
+			}
+			return err
+		}
+
+		for _, host := range hosts {
+			if !fn(host) {
+				return nil
+			}
+		}
+		if len(hosts) < pageSize {
+			return nil
+		}
+	}
+}
+
+// ForEachStats calls fn for every stats entry of the host, newest first, until fn returns false.
+// The stats are read page by page with a cursor, so stats inserted during the walk are neither returned
+// nor shift the following pages.
+// Returns ErrHostNotFound if no host with the host name could be found.
+func ForEachStats(hostDB HostDB, hostname string, fn func(stats Stats) bool) error {
+	cursor := StatsCursor("")
+	for {
+		stats, next, err := hostDB.GetStatsPage(hostname, cursor, pageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, stat := range stats {
+			if !fn(stat) {
+				return nil
+			}
+		}
+		if len(stats) < pageSize {
+			return nil
+		}
+		cursor = next
+	}
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrUnknownProcessSort if processes should be sorted by an unknown field.
+var ErrUnknownProcessSort = errors.New("db: Unknown field to sort processes by")
+
+// ProcessUsage is the aggregated resource usage of all processes with the same name over multiple stats.
+type ProcessUsage struct {
+	Name    string  `json:"name"`
+	Samples int     `json:"samples"`
+	AvgCPU  float64 `json:"avgCpu"`
+	MaxCPU  float64 `json:"maxCpu"`
+	AvgRSS  int     `json:"avgRss"`
+	MaxRSS  int     `json:"maxRss"`
+}
+
+// ProcessUsageAggregator sums up the processes of stats by their name.
+type ProcessUsageAggregator struct {
+	usages map[string]*processUsageSum
+}
+
+type processUsageSum struct {
+	samples int
+	cpu     float64
+	maxCPU  float64
+	rss     int
+	maxRSS  int
+}
+
+// NewProcessUsageAggregator is a constructor for the ProcessUsageAggregator.
+func NewProcessUsageAggregator() *ProcessUsageAggregator {
+	return &ProcessUsageAggregator{usages: make(map[string]*processUsageSum)}
+}
+
+// Add all processes of the stats to the aggregation.
+func (pa *ProcessUsageAggregator) Add(stats Stats) {
+	for _, process := range stats.Processes {
+		sum, found := pa.usages[process.Name]
+		if !found {
+			sum = &processUsageSum{}
+			pa.usages[process.Name] = sum
+		}
+
+		sum.samples++
+		sum.cpu += process.CPU
+		sum.rss += process.RSS
+		if process.CPU > sum.maxCPU {
+			sum.maxCPU = process.CPU
+		}
+		if process.RSS > sum.maxRSS {
+			sum.maxRSS = process.RSS
+		}
+	}
+}
+
+// Top returns the processes with the highest average usage of the field 'cpu' or 'rss'.
+// Returns ErrUnknownProcessSort if the field is not known.
+func (pa *ProcessUsageAggregator) Top(by string, limit int) ([]ProcessUsage, error) {
+	usages := make([]ProcessUsage, 0, len(pa.usages))
+	for name, sum := range pa.usages {
+		usages = append(usages, ProcessUsage{
+			Name:    name,
+			Samples: sum.samples,
+			AvgCPU:  sum.cpu / float64(sum.samples),
+			MaxCPU:  sum.maxCPU,
+			AvgRSS:  sum.rss / sum.samples,
+			MaxRSS:  sum.maxRSS,
+		})
+	}
+
+	var less func(i, j int) bool
+	switch by {
+	case "cpu":
+		less = func(i, j int) bool { return usages[i].AvgCPU > usages[j].AvgCPU }
+	case "rss":
+		less = func(i, j int) bool { return usages[i].AvgRSS > usages[j].AvgRSS }
+	default:
+		return []ProcessUsage{}, ErrUnknownProcessSort
+	}
+	sort.SliceStable(usages, func(i, j int) bool {
+		if less(i, j) || less(j, i) {
+			return less(i, j)
+		}
+		return usages[i].Name < usages[j].Name
+	})
+
+	if len(usages) > limit {
+		usages = usages[:limit]
+	}
+	return usages, nil
+}
@@ -0,0 +1,71 @@
+package db_test
+
+import (
+	"testing"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessUsageAggregator(t *testing.T) {
+	t.Run("should aggregate the processes by name", func(t *testing.T) {
+		aggregator := db.NewProcessUsageAggregator()
+		aggregator.Add(db.Stats{Processes: []db.Process{{Name: "foo", CPU: 1, RSS: 10}, {Name: "bar", CPU: 5, RSS: 1}}})
+		aggregator.Add(db.Stats{Processes: []db.Process{{Name: "foo", CPU: 3, RSS: 30}}})
+
+		got, err := aggregator.Top("rss", 10)
+		want := []db.ProcessUsage{
+			{Name: "foo", Samples: 2, AvgCPU: 2, MaxCPU: 3, AvgRSS: 20, MaxRSS: 30},
+			{Name: "bar", Samples: 1, AvgCPU: 5, MaxCPU: 5, AvgRSS: 1, MaxRSS: 1},
+		}
+
+		require.NoError(t, err)
+		require.Equal(t, want, got)
+	})
+
+	t.Run("should respect the limit", func(t *testing.T) {
+		aggregator := db.NewProcessUsageAggregator()
+		aggregator.Add(db.Stats{Processes: []db.Process{{Name: "foo", CPU: 1}, {Name: "bar", CPU: 5}}})
+
+		got, err := aggregator.Top("cpu", 1)
+
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, "bar", got[0].Name)
+	})
+
+	t.Run("should return error on unknown sort field", func(t *testing.T) {
+		aggregator := db.NewProcessUsageAggregator()
+
+		_, err := aggregator.Top("pid", 1)
+
+		require.EqualError(t, err, db.ErrUnknownProcessSort.Error())
+	})
+}
+
+func TestForEachStats(t *testing.T) {
+	t.Run("should iterate over all pages", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		for i := 0; i < 250; i++ {
+			require.NoError(t, memDB.InsertStats("foo", db.Stats{CPU: float64(i)}))
+		}
+
+		count := 0
+		err := db.ForEachStats(memDB, "foo", func(stats db.Stats) bool {
+			require.Equal(t, float64(249-count), stats.CPU)
+			count++
+			return true
+		})
+
+		require.NoError(t, err)
+		require.Equal(t, 250, count)
+	})
+
+	t.Run("should return error if the host was not found", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+
+		err := db.ForEachStats(memDB, "foo", func(stats db.Stats) bool { return true })
+
+		require.EqualError(t, err, db.ErrHostNotFound.Error())
+	})
+}
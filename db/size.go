@@ -0,0 +1,28 @@
+package db
+
+import "unsafe"
+
+// mapEntryOverhead is a rough guess of the bytes a map needs per entry besides the key and the value.
+const mapEntryOverhead = 16
+
+// size estimates the bytes the stats occupy in memory including everything they point to.
+func (s Stats) size() int {
+	size := int(unsafe.Sizeof(s)) + len(s.Hostname)
+	for _, process := range s.Processes {
+		size += int(unsafe.Sizeof(process)) + len(process.Name) + len(process.User) + len(process.Command) + len(process.State)
+	}
+	for name := range s.Metrics {
+		size += len(name) + int(unsafe.Sizeof(name)) + 8 + mapEntryOverhead
+	}
+	size += len(s.Cores) * 8
+	if s.Load != nil {
+		size += int(unsafe.Sizeof(*s.Load))
+	}
+	for _, mount := range s.Mounts {
+		size += int(unsafe.Sizeof(mount)) + len(mount.Path) + len(mount.FsType)
+	}
+	for _, networkInterface := range s.Interfaces {
+		size += int(unsafe.Sizeof(networkInterface)) + len(networkInterface.Name)
+	}
+	return size
+}
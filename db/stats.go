@@ -1,6 +1,16 @@
 package db
 
-import "time"
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// MaxMetricNameLength is the maximum length a custom metric name can have.
+const MaxMetricNameLength = 128
+
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.]*$`)
 
 // Stats struct represents a stats datapoint information of a host to be stored.
 type Stats struct {
@@ -10,6 +20,83 @@ type Stats struct {
 	Processes []Process `json:"processes"`
 	Disk      Memory
 	Mem       Memory
+	// Metrics holds custom metrics like application specific gauges by their name.
+	Metrics map[string]float64 `json:"metrics,omitempty"`
+	// Cores is the usage of every CPU core.
+	Cores      []float64          `json:"cores,omitempty"`
+	Load       *LoadAverage       `json:"load,omitempty"`
+	Mounts     []Mount            `json:"mounts,omitempty"`
+	Interfaces []NetworkInterface `json:"interfaces,omitempty"`
+}
+
+// Normalize fills the fields of the old data shape from the detailed information if they are missing.
+// The Disk gets summed up from all mounts so that clients only reading the Disk still get the usage.
+func (s Stats) Normalize() Stats {
+	if s.Disk == (Memory{}) {
+		for _, mount := range s.Mounts {
+			s.Disk.Used += mount.Used
+			s.Disk.Total += mount.Total
+		}
+	}
+	return s
+}
+
+// Validate checks if the stats are valid to be stored.
+// Returns ErrInvalidMetricName if a custom metric name is not valid.
+func (s Stats) Validate() error {
+	for name := range s.Metrics {
+		if err := ValidateMetricName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectMetrics returns a copy of the stats that only contains the custom metrics with the given names.
+// Names that don't exist inside the stats are ignored.
+func (s Stats) SelectMetrics(names []string) Stats {
+	metrics := make(map[string]float64)
+	for _, name := range names {
+		if value, found := s.Metrics[name]; found {
+			metrics[name] = value
+		}
+	}
+	s.Metrics = metrics
+	return s
+}
+
+// SelectMounts returns a copy of the stats that only contains the mounts with the given paths.
+func (s Stats) SelectMounts(paths []string) Stats {
+	mounts := make([]Mount, 0)
+	for _, mount := range s.Mounts {
+		if isIncluded(paths, mount.Path) {
+			mounts = append(mounts, mount)
+		}
+	}
+	s.Mounts = mounts
+	return s
+}
+
+// SelectInterfaces returns a copy of the stats that only contains the network interfaces with the given names.
+func (s Stats) SelectInterfaces(names []string) Stats {
+	interfaces := make([]NetworkInterface, 0)
+	for _, networkInterface := range s.Interfaces {
+		if isIncluded(names, networkInterface.Name) {
+			interfaces = append(interfaces, networkInterface)
+		}
+	}
+	s.Interfaces = interfaces
+	return s
+}
+
+// ValidateMetricName checks if the name is allowed as custom metric name.
+// A name has to start with a letter or an underscore followed by letters, digits, underscores or dots.
+// Returns ErrInvalidMetricName if the name is not valid.
+func ValidateMetricName(name string) error {
+	if len(name) > MaxMetricNameLength || !metricNamePattern.MatchString(name) {
+		return fmt.Errorf("%w: '%s'", ErrInvalidMetricName, name)
+	}
+	return nil
 }
 
 // Process is the representation of a UNIX process with some of its information.
@@ -17,6 +104,12 @@ type Process struct {
 	Name string  `json:"name"`
 	Pid  int     `json:"pid"`
 	CPU  float64 `json:"cpu"`
+	// RSS is the resident set size in bytes.
+	RSS       int       `json:"rss"`
+	User      string    `json:"user"`
+	Command   string    `json:"command"`
+	StartTime time.Time `json:"startTime"`
+	State     string    `json:"state"`
 }
 
 // Memory represents the usage of disk or RAM space.
@@ -25,3 +118,46 @@ type Memory struct {
 	Used  int `json:"used"`
 	Total int `json:"total"`
 }
+
+// LoadAverage is the system load average over 1, 5 and 15 minutes.
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// Mount represents the usage of a mounted filesystem.
+type Mount struct {
+	Path        string `json:"path"`
+	FsType      string `json:"fsType"`
+	Used        int    `json:"used"`
+	Total       int    `json:"total"`
+	InodesUsed  int    `json:"inodesUsed"`
+	InodesTotal int    `json:"inodesTotal"`
+}
+
+// NetworkInterface represents the traffic counters of a network interface.
+type NetworkInterface struct {
+	Name     string `json:"name"`
+	RxBytes  int    `json:"rxBytes"`
+	TxBytes  int    `json:"txBytes"`
+	RxErrors int    `json:"rxErrors"`
+	TxErrors int    `json:"txErrors"`
+}
+
+func isIncluded(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// sortStatsByDate sorts the stats in place with the newest date first.
+// Stats with the same date keep their order.
+func sortStatsByDate(stats []Stats) {
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].Date.After(stats[j].Date)
+	})
+}
@@ -0,0 +1,90 @@
+package db_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateMetricName(t *testing.T) {
+	t.Run("should accept valid names", func(t *testing.T) {
+		for _, name := range []string{"load1", "_private", "net.eth0.rx_bytes", "Temperature"} {
+			require.NoError(t, db.ValidateMetricName(name), name)
+		}
+	})
+
+	t.Run("should reject invalid names", func(t *testing.T) {
+		names := []string{"", "1load", "load avg", "load-1", strings.Repeat("a", db.MaxMetricNameLength+1)}
+		for _, name := range names {
+			err := db.ValidateMetricName(name)
+			require.True(t, errors.Is(err, db.ErrInvalidMetricName), name)
+		}
+	})
+}
+
+func TestStats_Validate(t *testing.T) {
+	t.Run("should accept stats without metrics", func(t *testing.T) {
+		require.NoError(t, db.Stats{}.Validate())
+	})
+
+	t.Run("should reject stats with an invalid metric name", func(t *testing.T) {
+		stats := db.Stats{Metrics: map[string]float64{"load1": 1, "load 5": 2}}
+
+		err := stats.Validate()
+
+		require.True(t, errors.Is(err, db.ErrInvalidMetricName))
+	})
+}
+
+func TestStats_SelectMetrics(t *testing.T) {
+	t.Run("should only keep the selected metrics", func(t *testing.T) {
+		stats := db.Stats{Hostname: "foo", Metrics: map[string]float64{"load1": 1, "load5": 5}}
+
+		got := stats.SelectMetrics([]string{"load5", "temp"})
+		want := db.Stats{Hostname: "foo", Metrics: map[string]float64{"load5": 5}}
+
+		require.Equal(t, want, got)
+		require.Len(t, stats.Metrics, 2, "the original stats should not be modified")
+	})
+}
+
+func TestStats_SelectMounts(t *testing.T) {
+	t.Run("should only keep the selected mounts", func(t *testing.T) {
+		stats := db.Stats{Mounts: []db.Mount{{Path: "/"}, {Path: "/var"}}}
+
+		got := stats.SelectMounts([]string{"/var"})
+
+		require.Equal(t, []db.Mount{{Path: "/var"}}, got.Mounts)
+	})
+}
+
+func TestStats_SelectInterfaces(t *testing.T) {
+	t.Run("should only keep the selected interfaces", func(t *testing.T) {
+		stats := db.Stats{Interfaces: []db.NetworkInterface{{Name: "lo"}, {Name: "eth0"}}}
+
+		got := stats.SelectInterfaces([]string{"eth0"})
+
+		require.Equal(t, []db.NetworkInterface{{Name: "eth0"}}, got.Interfaces)
+	})
+}
+
+func TestStats_Normalize(t *testing.T) {
+	t.Run("should sum up the disk from the mounts", func(t *testing.T) {
+		stats := db.Stats{Mounts: []db.Mount{{Path: "/", Used: 1, Total: 10}, {Path: "/var", Used: 2, Total: 20}}}
+
+		got := stats.Normalize()
+
+		require.Equal(t, db.Memory{Used: 3, Total: 30}, got.Disk)
+	})
+
+	t.Run("should keep the disk from old agents", func(t *testing.T) {
+		stats := db.Stats{Disk: db.Memory{Used: 5, Total: 10}}
+
+		got := stats.Normalize()
+
+		require.Equal(t, stats, got)
+	})
+}
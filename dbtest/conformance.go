@@ -0,0 +1,740 @@
+// Package dbtest provides a test suite that every db.HostDB implementation has to pass.
+package dbtest
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory creates a new empty db for every test.
+type Factory func() db.HostDB
+
+// RunConformance runs the shared contract of the db.HostDB interface against the db created by the factory.
+func RunConformance(t *testing.T, factory Factory) {
+	t.Run("GetHosts", func(t *testing.T) { testGetHosts(t, factory) })
+	t.Run("GetHost", func(t *testing.T) { testGetHost(t, factory) })
+	t.Run("GetStatsByHostname", func(t *testing.T) { testGetStatsByHostname(t, factory) })
+	t.Run("GetStatsPage", func(t *testing.T) { testGetStatsPage(t, factory) })
+	t.Run("InsertStats", func(t *testing.T) { testInsertStats(t, factory) })
+	t.Run("DeleteHost", func(t *testing.T) { testDeleteHost(t, factory) })
+	t.Run("MergeHosts", func(t *testing.T) { testMergeHosts(t, factory) })
+	t.Run("DeleteStatsBefore", func(t *testing.T) { testDeleteStatsBefore(t, factory) })
+	t.Run("Events", func(t *testing.T) { testEvents(t, factory) })
+	t.Run("SnapshotAndRestore", func(t *testing.T) { testSnapshotAndRestore(t, factory) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, factory) })
+	t.Run("Close", func(t *testing.T) { testClose(t, factory) })
+}
+
+var baseDate = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// insertStats inserts a stat per CPU value with an increasing date.
+func insertStats(t *testing.T, hostDB db.HostDB, hostname string, cpus ...float64) {
+	t.Helper()
+	for i, cpu := range cpus {
+		stats := db.Stats{Hostname: hostname, Date: baseDate.Add(time.Duration(i) * time.Minute), CPU: cpu}
+		require.NoError(t, hostDB.InsertStats(hostname, stats))
+	}
+}
+
+func cpus(stats []db.Stats) []float64 {
+	values := make([]float64, 0, len(stats))
+	for _, stat := range stats {
+		values = append(values, stat.CPU)
+	}
+	return values
+}
+
+func hostnames(hosts []db.HostInfo) []string {
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		names = append(names, host.Hostname)
+	}
+	return names
+}
+
+func testGetHosts(t *testing.T, factory Factory) {
+	t.Run("should return ErrHostsNotFound on an empty db", func(t *testing.T) {
+		_, err := factory().GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 10})
+		require.Equal(t, db.ErrHostsNotFound, err)
+	})
+
+	t.Run("should return all hosts", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		insertStats(t, hostDB, "bar", 1)
+
+		got, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{"bar", "foo"}, hostnames(got))
+	})
+
+	t.Run("should paginate without duplicates", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "a", 1)
+		insertStats(t, hostDB, "b", 1)
+		insertStats(t, hostDB, "c", 1)
+
+		for i := 0; i < 10; i++ {
+			first, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 2})
+			require.NoError(t, err)
+			second, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 2, Limit: 2})
+			require.NoError(t, err)
+			require.Equal(t, []string{"a", "b", "c"}, append(hostnames(first), hostnames(second)...))
+		}
+	})
+
+	t.Run("should sort the hosts", func(t *testing.T) {
+		hostDB := factory()
+		// the pauses make sure that every host has a distinct LastInsert
+		insertStats(t, hostDB, "b", 1, 2, 3)
+		time.Sleep(time.Millisecond)
+		insertStats(t, hostDB, "c", 1)
+		time.Sleep(time.Millisecond)
+		insertStats(t, hostDB, "a", 1)
+		time.Sleep(time.Millisecond)
+		insertStats(t, hostDB, "d", 1, 2, 3)
+
+		tests := []struct {
+			query db.HostQuery
+			want  []string
+		}{
+			{db.HostQuery{Sort: db.SortByHostname}, []string{"a", "b", "c", "d"}},
+			{db.HostQuery{Sort: db.SortByHostname, Order: db.OrderDesc}, []string{"d", "c", "b", "a"}},
+			{db.HostQuery{Sort: db.SortByLastInsert}, []string{"b", "c", "a", "d"}},
+			{db.HostQuery{Sort: db.SortByLastInsert, Order: db.OrderDesc}, []string{"d", "a", "c", "b"}},
+			{db.HostQuery{Sort: db.SortByDataPoints}, []string{"a", "c", "b", "d"}},
+			{db.HostQuery{Sort: db.SortByDataPoints, Order: db.OrderDesc}, []string{"b", "d", "a", "c"}},
+		}
+		for _, tt := range tests {
+			got, err := hostDB.GetHosts(tt.query, db.Pagination{Skip: 0, Limit: 10})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, hostnames(got), "query %+v", tt.query)
+
+			got, err = hostDB.GetHosts(tt.query, db.Pagination{Skip: 1, Limit: 2})
+			require.NoError(t, err)
+			require.Equal(t, tt.want[1:3], hostnames(got), "query %+v", tt.query)
+		}
+	})
+
+	t.Run("should filter the hosts", func(t *testing.T) {
+		hostDB := factory()
+		for _, hostname := range []string{"db-1", "my-web-1", "web-1", "web-2", "webmail"} {
+			insertStats(t, hostDB, hostname, 1)
+		}
+
+		tests := []struct {
+			query db.HostQuery
+			want  []string
+		}{
+			{db.HostQuery{Search: "web"}, []string{"my-web-1", "web-1", "web-2", "webmail"}},
+			{db.HostQuery{Match: "web-*"}, []string{"web-1", "web-2"}},
+			{db.HostQuery{Match: "*-1"}, []string{"db-1", "my-web-1", "web-1"}},
+			{db.HostQuery{Regex: "web-[0-9]+$"}, []string{"my-web-1", "web-1", "web-2"}},
+			{db.HostQuery{Regex: "^web-[0-9]+$"}, []string{"web-1", "web-2"}},
+			{db.HostQuery{Regex: "^web"}, []string{"web-1", "web-2", "webmail"}},
+			{db.HostQuery{Match: "web*", Search: "mail"}, []string{"webmail"}},
+			{db.HostQuery{Match: "web-*", Order: db.OrderDesc}, []string{"web-2", "web-1"}},
+			{db.HostQuery{LastSeenWithin: time.Hour}, []string{"db-1", "my-web-1", "web-1", "web-2", "webmail"}},
+		}
+		for _, tt := range tests {
+			got, err := hostDB.GetHosts(tt.query, db.Pagination{Skip: 0, Limit: 10})
+			require.NoError(t, err)
+			require.Equal(t, tt.want, hostnames(got), "query %+v", tt.query)
+		}
+	})
+
+	t.Run("should filter the hosts by the last insert", func(t *testing.T) {
+		hostDB := factory()
+		// the last inserts are restored so that the test does not depend on the time an insert takes
+		now := time.Now()
+		snapshot := db.Snapshot{Hosts: []db.Host{
+			{HostInfo: db.HostInfo{Hostname: "old", LastInsert: now.Add(-2 * time.Hour)}},
+			{HostInfo: db.HostInfo{Hostname: "new", LastInsert: now.Add(-time.Minute)}},
+		}}
+		require.NoError(t, hostDB.Restore(snapshot))
+
+		got, err := hostDB.GetHosts(db.HostQuery{LastSeenWithin: time.Hour}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []string{"new"}, hostnames(got))
+	})
+
+	t.Run("should return ErrHostsNotFound if no host matches", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		_, err := hostDB.GetHosts(db.HostQuery{Match: "bar*"}, db.Pagination{Skip: 0, Limit: 10})
+		require.Equal(t, db.ErrHostsNotFound, err)
+	})
+
+	t.Run("should reject an invalid query", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		_, err := hostDB.GetHosts(db.HostQuery{Sort: "cpu"}, db.Pagination{Skip: 0, Limit: 10})
+		require.True(t, errors.Is(err, db.ErrUnknownHostSort))
+		_, err = hostDB.GetHosts(db.HostQuery{Order: "up"}, db.Pagination{Skip: 0, Limit: 10})
+		require.True(t, errors.Is(err, db.ErrUnknownSortOrder))
+		_, err = hostDB.GetHosts(db.HostQuery{Match: "web-["}, db.Pagination{Skip: 0, Limit: 10})
+		require.True(t, errors.Is(err, db.ErrInvalidHostFilter))
+		_, err = hostDB.GetHosts(db.HostQuery{Regex: "web-("}, db.Pagination{Skip: 0, Limit: 10})
+		require.True(t, errors.Is(err, db.ErrInvalidHostFilter))
+		_, err = hostDB.GetHosts(db.HostQuery{LastSeenWithin: -time.Minute}, db.Pagination{Skip: 0, Limit: 10})
+		require.True(t, errors.Is(err, db.ErrInvalidHostFilter))
+	})
+
+	t.Run("should return an empty result if exactly all entries are skipped", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		got, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 1, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("should return ErrAllEntriesSkipped if more entries are skipped than exist", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		_, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 2, Limit: 10})
+		require.Equal(t, db.ErrAllEntriesSkipped, err)
+	})
+
+	t.Run("should return an empty result for a zero limit", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		got, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 0})
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+}
+
+func testGetHost(t *testing.T, factory Factory) {
+	t.Run("should return ErrHostNotFound for an unknown host", func(t *testing.T) {
+		_, err := factory().GetHost("foo")
+		require.Equal(t, db.ErrHostNotFound, err)
+	})
+
+	t.Run("should return the host", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		got, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, "foo", got.Hostname)
+	})
+}
+
+func testGetStatsByHostname(t *testing.T, factory Factory) {
+	t.Run("should return ErrHostNotFound for an unknown host", func(t *testing.T) {
+		_, err := factory().GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.Equal(t, db.ErrHostNotFound, err)
+	})
+
+	t.Run("should return the newest insert first", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3)
+
+		got, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{3, 2, 1}, cpus(got))
+	})
+
+	t.Run("should keep the insert order for equal dates", func(t *testing.T) {
+		hostDB := factory()
+		for _, cpu := range []float64{1, 2, 3} {
+			require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: baseDate, CPU: cpu}))
+		}
+
+		got, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{3, 2, 1}, cpus(got))
+	})
+
+	t.Run("should return the stats unchanged", func(t *testing.T) {
+		hostDB := factory()
+		stats := db.Stats{
+			Hostname:  "foo",
+			Date:      baseDate,
+			CPU:       42.5,
+			Processes: []db.Process{{Name: "gsave", Pid: 1, CPU: 1.5}},
+			Metrics:   map[string]float64{"temperature": 21},
+		}
+		require.NoError(t, hostDB.InsertStats("foo", stats))
+
+		got, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{stats}, got)
+	})
+
+	t.Run("should paginate", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3, 4, 5)
+
+		tests := []struct {
+			pagination db.Pagination
+			want       []float64
+		}{
+			{db.Pagination{Skip: 0, Limit: 2}, []float64{5, 4}},
+			{db.Pagination{Skip: 2, Limit: 2}, []float64{3, 2}},
+			{db.Pagination{Skip: 4, Limit: 2}, []float64{1}},
+			{db.Pagination{Skip: 5, Limit: 2}, []float64{}},
+			{db.Pagination{Skip: 1, Limit: 0}, []float64{}},
+		}
+		for _, tt := range tests {
+			got, err := hostDB.GetStatsByHostname("foo", tt.pagination)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, cpus(got), "pagination %+v", tt.pagination)
+		}
+	})
+
+	t.Run("should return ErrAllEntriesSkipped if more entries are skipped than exist", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		_, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 2, Limit: 10})
+		require.Equal(t, db.ErrAllEntriesSkipped, err)
+	})
+}
+
+func testGetStatsPage(t *testing.T, factory Factory) {
+	t.Run("should return ErrHostNotFound for an unknown host", func(t *testing.T) {
+		_, _, err := factory().GetStatsPage("foo", "", 10)
+		require.Equal(t, db.ErrHostNotFound, err)
+	})
+
+	t.Run("should page with the newest insert first", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3, 4, 5)
+
+		got, cursor, err := hostDB.GetStatsPage("foo", "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{5, 4}, cpus(got))
+
+		got, cursor, err = hostDB.GetStatsPage("foo", cursor, 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{3, 2}, cpus(got))
+
+		got, cursor, err = hostDB.GetStatsPage("foo", cursor, 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{1}, cpus(got))
+
+		got, _, err = hostDB.GetStatsPage("foo", cursor, 2)
+		require.NoError(t, err)
+		require.Empty(t, got)
+	})
+
+	t.Run("should not shift the pages by stats inserted meanwhile", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3, 4)
+
+		got, cursor, err := hostDB.GetStatsPage("foo", "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{4, 3}, cpus(got))
+
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: baseDate.Add(time.Hour), CPU: 5}))
+
+		got, _, err = hostDB.GetStatsPage("foo", cursor, 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{2, 1}, cpus(got))
+	})
+
+	t.Run("should continue after the stats of the cursor got deleted", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3, 4)
+
+		got, cursor, err := hostDB.GetStatsPage("foo", "", 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{4, 3}, cpus(got))
+
+		// deletes the stats with the cpu 1 and 3
+		_, err = hostDB.DeleteStatsBefore(baseDate.Add(time.Minute))
+		require.NoError(t, err)
+
+		got, _, err = hostDB.GetStatsPage("foo", cursor, 2)
+		require.NoError(t, err)
+		require.Equal(t, []float64{2}, cpus(got))
+	})
+
+	t.Run("should return ErrInvalidStatsCursor for a foreign cursor", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		_, _, err := hostDB.GetStatsPage("foo", "not a cursor", 2)
+		require.True(t, errors.Is(err, db.ErrInvalidStatsCursor))
+	})
+}
+
+func testInsertStats(t *testing.T, factory Factory) {
+	t.Run("should create the host with one data point", func(t *testing.T) {
+		hostDB := factory()
+		before := time.Now()
+		insertStats(t, hostDB, "foo", 1)
+
+		got, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.DataPoints)
+		require.False(t, got.LastInsert.Before(before), "LastInsert %v is before the insert %v", got.LastInsert, before)
+	})
+
+	t.Run("should count the data points and update the last insert", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		first, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+
+		insertStats(t, hostDB, "foo", 2, 3)
+		got, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 3, got.DataPoints)
+		require.False(t, got.LastInsert.Before(first.LastInsert))
+	})
+
+	t.Run("should date stats without a date with the insert time", func(t *testing.T) {
+		hostDB := factory()
+		before := time.Now()
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", CPU: 1}))
+
+		got, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.False(t, got[0].Date.Before(before), "date %v is before the insert %v", got[0].Date, before)
+
+		deleted, err := hostDB.DeleteStatsBefore(time.Now().Add(time.Minute))
+		require.NoError(t, err)
+		require.Equal(t, 1, deleted, "the retention should delete the dated stats")
+	})
+
+	t.Run("should not touch other hosts", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		insertStats(t, hostDB, "bar", 1, 2)
+
+		got, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.DataPoints)
+	})
+}
+
+func testDeleteHost(t *testing.T, factory Factory) {
+	t.Run("should return ErrHostNotFound for an unknown host", func(t *testing.T) {
+		require.Equal(t, db.ErrHostNotFound, factory().DeleteHost("foo"))
+	})
+
+	t.Run("should delete the host with its stats and events", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		insertStats(t, hostDB, "bar", 1)
+		_, err := hostDB.InsertEvent(db.Event{Hostname: "foo", Date: baseDate, Title: "deploy"})
+		require.NoError(t, err)
+
+		require.NoError(t, hostDB.DeleteHost("foo"))
+
+		_, err = hostDB.GetHost("foo")
+		require.Equal(t, db.ErrHostNotFound, err)
+		_, err = hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.Equal(t, db.ErrHostNotFound, err)
+		events, err := hostDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Empty(t, events)
+		_, err = hostDB.GetHost("bar")
+		require.NoError(t, err)
+	})
+
+	t.Run("should start from scratch if the host gets recreated", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2)
+		require.NoError(t, hostDB.DeleteHost("foo"))
+		insertStats(t, hostDB, "foo", 3)
+
+		got, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{3}, cpus(got))
+		info, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, info.DataPoints)
+	})
+}
+
+func testMergeHosts(t *testing.T, factory Factory) {
+	t.Run("should return ErrMergeSameHost", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		require.Equal(t, db.ErrMergeSameHost, hostDB.MergeHosts("foo", "foo"))
+	})
+
+	t.Run("should return ErrHostNotFound for an unknown source", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "bar", 1)
+		require.Equal(t, db.ErrHostNotFound, hostDB.MergeHosts("foo", "bar"))
+	})
+
+	t.Run("should rename the source if the target does not exist", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2)
+		source, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+
+		require.NoError(t, hostDB.MergeHosts("foo", "bar"))
+
+		_, err = hostDB.GetHost("foo")
+		require.Equal(t, db.ErrHostNotFound, err)
+		got, err := hostDB.GetHost("bar")
+		require.NoError(t, err)
+		require.Equal(t, 2, got.DataPoints)
+		require.True(t, source.LastInsert.Equal(got.LastInsert))
+
+		stats, err := hostDB.GetStatsByHostname("bar", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{2, 1}, cpus(stats))
+		for _, stat := range stats {
+			require.Equal(t, "bar", stat.Hostname)
+		}
+	})
+
+	t.Run("should interleave the stats by date", func(t *testing.T) {
+		hostDB := factory()
+		for i, cpu := range []float64{1, 3} {
+			require.NoError(t, hostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: baseDate.Add(time.Duration(2*i) * time.Minute), CPU: cpu}))
+		}
+		for i, cpu := range []float64{2, 4} {
+			require.NoError(t, hostDB.InsertStats("bar", db.Stats{Hostname: "bar", Date: baseDate.Add(time.Duration(2*i+1) * time.Minute), CPU: cpu}))
+		}
+		source, err := hostDB.GetHost("bar")
+		require.NoError(t, err)
+
+		require.NoError(t, hostDB.MergeHosts("bar", "foo"))
+
+		stats, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{4, 3, 2, 1}, cpus(stats))
+		got, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 4, got.DataPoints)
+		require.True(t, source.LastInsert.Equal(got.LastInsert))
+	})
+
+	t.Run("should move the events of the source", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+		_, err := hostDB.InsertEvent(db.Event{Hostname: "foo", Date: baseDate, Title: "deploy"})
+		require.NoError(t, err)
+
+		require.NoError(t, hostDB.MergeHosts("foo", "bar"))
+
+		events, err := hostDB.GetEvents(db.EventFilter{Hostname: "bar"}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, events, 1)
+		require.Equal(t, "bar", events[0].Hostname)
+	})
+}
+
+func testDeleteStatsBefore(t *testing.T, factory Factory) {
+	t.Run("should delete the older stats and update the data points", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2, 3)
+		insertStats(t, hostDB, "bar", 1)
+		require.NoError(t, hostDB.InsertStats("bar", db.Stats{Hostname: "bar", CPU: 2}))
+
+		deleted, err := hostDB.DeleteStatsBefore(baseDate.Add(90 * time.Second))
+		require.NoError(t, err)
+		require.Equal(t, 3, deleted)
+
+		stats, err := hostDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{3}, cpus(stats))
+		info, err := hostDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, info.DataPoints)
+
+		stats, err = hostDB.GetStatsByHostname("bar", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{2}, cpus(stats), "stats without a date should be kept")
+	})
+
+	t.Run("should update the data points of every host", func(t *testing.T) {
+		hostDB := factory()
+		hostnames := make([]string, 0, 100)
+		for i := 0; i < 100; i++ {
+			hostname := fmt.Sprintf("host-%03d", i)
+			hostnames = append(hostnames, hostname)
+			insertStats(t, hostDB, hostname, 1, 2)
+		}
+
+		deleted, err := hostDB.DeleteStatsBefore(baseDate.Add(30 * time.Second))
+		require.NoError(t, err)
+		require.Equal(t, 100, deleted)
+
+		for _, hostname := range hostnames {
+			info, err := hostDB.GetHost(hostname)
+			require.NoError(t, err)
+			require.Equal(t, 1, info.DataPoints, hostname)
+		}
+	})
+}
+
+func testEvents(t *testing.T, factory Factory) {
+	t.Run("should assign increasing ids", func(t *testing.T) {
+		hostDB := factory()
+		first, err := hostDB.InsertEvent(db.Event{Date: baseDate, Title: "first"})
+		require.NoError(t, err)
+		second, err := hostDB.InsertEvent(db.Event{Date: baseDate, Title: "second"})
+		require.NoError(t, err)
+		require.Greater(t, second.ID, first.ID)
+	})
+
+	t.Run("should return the newest event first", func(t *testing.T) {
+		hostDB := factory()
+		for i, title := range []string{"a", "b", "c"} {
+			_, err := hostDB.InsertEvent(db.Event{Date: baseDate.Add(time.Duration(i) * time.Minute), Title: title})
+			require.NoError(t, err)
+		}
+		_, err := hostDB.InsertEvent(db.Event{Date: baseDate, Title: "d"})
+		require.NoError(t, err)
+
+		got, err := hostDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		titles := make([]string, 0, len(got))
+		for _, event := range got {
+			titles = append(titles, event.Title)
+		}
+		require.Equal(t, []string{"c", "b", "d", "a"}, titles)
+
+		got, err = hostDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 3, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		_, err = hostDB.GetEvents(db.EventFilter{}, db.Pagination{Skip: 5, Limit: 10})
+		require.Equal(t, db.ErrAllEntriesSkipped, err)
+	})
+
+	t.Run("should filter the events", func(t *testing.T) {
+		hostDB := factory()
+		_, err := hostDB.InsertEvent(db.Event{Hostname: "foo", Date: baseDate, Title: "deploy", Tags: []string{"release"}})
+		require.NoError(t, err)
+		_, err = hostDB.InsertEvent(db.Event{Hostname: "bar", Date: baseDate, Title: "reboot"})
+		require.NoError(t, err)
+		_, err = hostDB.InsertEvent(db.Event{Date: baseDate.Add(time.Hour), Title: "fleet"})
+		require.NoError(t, err)
+
+		got, err := hostDB.GetEvents(db.EventFilter{Hostname: "foo"}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 2)
+
+		got, err = hostDB.GetEvents(db.EventFilter{Tags: []string{"release"}}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, "deploy", got[0].Title)
+
+		got, err = hostDB.GetEvents(db.EventFilter{From: baseDate.Add(time.Minute)}, db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+		require.Equal(t, "fleet", got[0].Title)
+	})
+}
+
+func testSnapshotAndRestore(t *testing.T, factory Factory) {
+	t.Run("should restore the snapshot into another db", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2)
+		insertStats(t, hostDB, "bar", 3)
+		_, err := hostDB.InsertEvent(db.Event{Hostname: "foo", Date: baseDate, Title: "deploy"})
+		require.NoError(t, err)
+
+		snapshot, err := hostDB.Snapshot()
+		require.NoError(t, err)
+		require.Len(t, snapshot.Hosts, 2)
+		require.Len(t, snapshot.Events, 1)
+
+		restored := factory()
+		insertStats(t, restored, "baz", 1)
+		require.NoError(t, restored.Restore(snapshot))
+
+		_, err = restored.GetHost("baz")
+		require.Equal(t, db.ErrHostNotFound, err)
+		stats, err := restored.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []float64{2, 1}, cpus(stats))
+		info, err := restored.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 2, info.DataPoints)
+
+		event, err := restored.InsertEvent(db.Event{Date: baseDate, Title: "restart"})
+		require.NoError(t, err)
+		require.Greater(t, event.ID, snapshot.Events[0].ID)
+	})
+}
+
+func testConcurrency(t *testing.T, factory Factory) {
+	t.Run("should not lose concurrent inserts", func(t *testing.T) {
+		const workers, inserts = 8, 25
+		hostDB := factory()
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < inserts; i++ {
+					hostname := fmt.Sprintf("host-%d", w%2)
+					if err := hostDB.InsertStats(hostname, db.Stats{Hostname: hostname, CPU: float64(i)}); err != nil {
+						t.Error(err)
+						return
+					}
+					if _, err := hostDB.GetStatsByHostname(hostname, db.Pagination{Skip: 0, Limit: 10}); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		for _, hostname := range []string{"host-0", "host-1"} {
+			info, err := hostDB.GetHost(hostname)
+			require.NoError(t, err)
+			require.Equal(t, workers/2*inserts, info.DataPoints)
+			stats, err := hostDB.GetStatsByHostname(hostname, db.Pagination{Skip: 0, Limit: workers * inserts})
+			require.NoError(t, err)
+			require.Len(t, stats, workers/2*inserts)
+		}
+	})
+
+	t.Run("should copy every host consistently while stats get inserted", func(t *testing.T) {
+		const inserts = 50
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < inserts; i++ {
+				if err := hostDB.InsertStats("foo", db.Stats{Hostname: "foo", CPU: float64(i)}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		for i := 0; i < 5; i++ {
+			snapshot, err := hostDB.Snapshot()
+			require.NoError(t, err)
+			require.Len(t, snapshot.Hosts, 1)
+			require.Equal(t, snapshot.Hosts[0].HostInfo.DataPoints, len(snapshot.Hosts[0].Stats))
+		}
+		<-done
+	})
+}
+
+func testClose(t *testing.T, factory Factory) {
+	t.Run("should close the db after writes", func(t *testing.T) {
+		hostDB := factory()
+		insertStats(t, hostDB, "foo", 1, 2)
+
+		require.NoError(t, hostDB.Close())
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/exporter"
+	"github.com/hamburghammer/gsave/server"
+)
+
+type exportCommand struct {
+	Format  string   `short:"f" long:"format" choice:"ndjson" choice:"csv" default:"ndjson" description:"The format of the export."`
+	Output  string   `short:"o" long:"output" description:"The file to write the export to. (default: stdout)"`
+	Hosts   []string `long:"host" description:"A host to export. Can be set multiple times. (default: all hosts)"`
+	Metrics []string `long:"metric" description:"A custom metric to export. Can be set multiple times. For CSV every metric gets its own column."`
+}
+
+// Execute exports the stats from the configured db backend.
+func (ec *exportCommand) Execute([]string) error {
+	cfg, err := readConfig(args)
+	if err != nil {
+		return err
+	}
+	applyLogConfig(cfg.Log)
+
+	for _, metric := range ec.Metrics {
+		if err := db.ValidateMetricName(metric); err != nil {
+			return err
+		}
+	}
+
+	hostDB, err := server.NewHostDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer closeHostDB(hostDB)
+	if cfg.DB.Backend == "memory" {
+		logPackage.Warn("The memory db backend has no stored stats to export")
+	}
+
+	var output io.Writer = os.Stdout
+	if ec.Output != "" {
+		file, err := os.Create(ec.Output)
+		if err != nil {
+			return fmt.Errorf("Could not create the export file: %w", err)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	statsExporter := exporter.NewExporter(hostDB).WithMetrics(ec.Metrics)
+	format := exporter.Format(ec.Format)
+	if len(ec.Hosts) == 0 {
+		return statsExporter.ExportAll(output, format)
+	}
+	return statsExporter.Export(output, ec.Hosts, format)
+}
@@ -0,0 +1,139 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hamburghammer/gsave/db"
+)
+
+// Format is the file format the stats get exported in.
+type Format string
+
+const (
+	// NDJSON has one JSON encoded stats entry per line.
+	NDJSON Format = "ndjson"
+	// CSV are the flattened stats with a header as described by db.CSVHeader.
+	CSV Format = "csv"
+)
+
+// ErrUnknownFormat if the format is not supported.
+var ErrUnknownFormat = errors.New("exporter: Unknown format")
+
+// ParseFormat checks if the format is supported.
+// Returns ErrUnknownFormat if it is not.
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case NDJSON, CSV:
+		return Format(format), nil
+	default:
+		return "", fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+	}
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+// NewExporter is a constructor for the Exporter.
+func NewExporter(hostDB db.HostDB) *Exporter {
+	return &Exporter{hostDB: hostDB}
+}
+
+// Exporter writes the stats of hosts page by page without loading all of them into memory.
+type Exporter struct {
+	hostDB  db.HostDB
+	metrics []string
+}
+
+// WithMetrics selects the custom metrics that get exported.
+// For CSV every metric gets its own column. Without metrics no custom metrics are part of the CSV.
+// Returns the Exporter.
+func (e *Exporter) WithMetrics(metrics []string) *Exporter {
+	e.metrics = metrics
+	return e
+}
+
+// Export writes all stats of the hosts, newest first, in the format to the writer.
+// Returns db.ErrHostNotFound if one of the hosts does not exist.
+func (e *Exporter) Export(w io.Writer, hostnames []string, format Format) error {
+	switch format {
+	case NDJSON:
+		return e.exportNDJSON(w, hostnames)
+	case CSV:
+		return e.exportCSV(w, hostnames)
+	default:
+		return fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+	}
+}
+
+// ExportAll writes the stats of all hosts inside the db.
+func (e *Exporter) ExportAll(w io.Writer, format Format) error {
+	hostnames := make([]string, 0)
+	err := db.ForEachHost(e.hostDB, func(host db.HostInfo) bool {
+		hostnames = append(hostnames, host.Hostname)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.Export(w, hostnames, format)
+}
+
+func (e *Exporter) exportNDJSON(w io.Writer, hostnames []string) error {
+	encoder := json.NewEncoder(w)
+	return e.forEachStats(hostnames, func(stats db.Stats) error {
+		if len(e.metrics) > 0 {
+			stats = stats.SelectMetrics(e.metrics)
+		}
+		return encoder.Encode(stats)
+	})
+}
+
+func (e *Exporter) exportCSV(w io.Writer, hostnames []string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(db.CSVHeader(e.metrics)); err != nil {
+		return err
+	}
+
+	err := e.forEachStats(hostnames, func(stats db.Stats) error {
+		record, err := stats.CSVRecord(e.metrics)
+		if err != nil {
+			return err
+		}
+		return writer.Write(record)
+	})
+	if err != nil {
+		return err
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// forEachStats calls fn for all stats of the hosts until fn returns an error.
+// Stats inserted during the export are not written.
+func (e *Exporter) forEachStats(hostnames []string, fn func(stats db.Stats) error) error {
+	for _, hostname := range hostnames {
+		var writeErr error
+		err := db.ForEachStats(e.hostDB, hostname, func(stats db.Stats) bool {
+			writeErr = fn(stats)
+			return writeErr == nil
+		})
+		if err != nil {
+			return fmt.Errorf("exporter: Could not export the host '%s': %w", hostname, err)
+		}
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+	return nil
+}
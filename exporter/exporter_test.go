@@ -0,0 +1,154 @@
+package exporter_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/exporter"
+	"github.com/hamburghammer/gsave/importer"
+	"github.com/stretchr/testify/require"
+)
+
+func newDB(t *testing.T) *db.InMemoryDB {
+	memDB := db.NewInMemoryDB()
+	date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 150; i++ {
+		stats := db.Stats{Hostname: "foo", Date: date.Add(time.Duration(i) * time.Minute), Metrics: map[string]float64{"load1": float64(i), "temp": 1}}
+		require.NoError(t, memDB.InsertStats("foo", stats))
+	}
+	require.NoError(t, memDB.InsertStats("bar", db.Stats{Hostname: "bar", Date: date}))
+	return memDB
+}
+
+// insertingDB inserts a new stat before every read of the stats like a running agent.
+type insertingDB struct {
+	*db.InMemoryDB
+	inserted int
+}
+
+func (i *insertingDB) GetStatsPage(hostname string, cursor db.StatsCursor, limit int) ([]db.Stats, db.StatsCursor, error) {
+	i.inserted++
+	date := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i.inserted) * time.Minute)
+	if err := i.InMemoryDB.InsertStats(hostname, db.Stats{Hostname: hostname, Date: date}); err != nil {
+		return nil, "", err
+	}
+	return i.InMemoryDB.GetStatsPage(hostname, cursor, limit)
+}
+
+func TestExporter_Export(t *testing.T) {
+	t.Run("should export all stats as NDJSON newest first", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := exporter.NewExporter(newDB(t)).WithMetrics([]string{"load1"}).Export(&buf, []string{"foo"}, exporter.NDJSON)
+		require.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 150)
+
+		var first db.Stats
+		require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+		require.Equal(t, map[string]float64{"load1": 149}, first.Metrics)
+	})
+
+	t.Run("should export CSV that can be imported again", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := exporter.NewExporter(newDB(t)).WithMetrics([]string{"load1"}).Export(&buf, []string{"foo", "bar"}, exporter.CSV)
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(buf.String(), "hostname,date,cpu,disk_used,disk_total,mem_used,mem_total,processes,cores,load,mounts,interfaces,metric.load1\n"))
+
+		memDB := db.NewInMemoryDB()
+		result, err := importer.NewImporter(memDB).Import(&buf, importer.CSV)
+		require.NoError(t, err)
+		require.Equal(t, importer.Result{Imported: 151}, result)
+	})
+
+	t.Run("should keep all fields through CSV and the import", func(t *testing.T) {
+		stats := db.Stats{
+			Hostname:   "foo",
+			Date:       time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			CPU:        0.5,
+			Processes:  []db.Process{{Name: "bash", Pid: 1}},
+			Disk:       db.Memory{Used: 1, Total: 2},
+			Mem:        db.Memory{Used: 3, Total: 4},
+			Metrics:    map[string]float64{"load1": 1.5},
+			Cores:      []float64{0.25, 0.75},
+			Load:       &db.LoadAverage{Load1: 1, Load5: 2, Load15: 3},
+			Mounts:     []db.Mount{{Path: "/", FsType: "ext4", Used: 1, Total: 2}},
+			Interfaces: []db.NetworkInterface{{Name: "eth0", RxBytes: 1, TxBytes: 2}},
+		}
+		sourceDB := db.NewInMemoryDB()
+		require.NoError(t, sourceDB.InsertStats("foo", stats))
+		var buf bytes.Buffer
+
+		require.NoError(t, exporter.NewExporter(sourceDB).WithMetrics([]string{"load1"}).Export(&buf, []string{"foo"}, exporter.CSV))
+		memDB := db.NewInMemoryDB()
+		_, err := importer.NewImporter(memDB).Import(&buf, importer.CSV)
+		require.NoError(t, err)
+
+		got, err := memDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{stats}, got)
+	})
+
+	t.Run("should not export stats twice that get inserted meanwhile", func(t *testing.T) {
+		hostDB := &insertingDB{InMemoryDB: newDB(t)}
+		var buf bytes.Buffer
+
+		require.NoError(t, exporter.NewExporter(hostDB).Export(&buf, []string{"foo"}, exporter.NDJSON))
+
+		seen := make(map[string]bool)
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			require.False(t, seen[line], "exported twice: %s", line)
+			seen[line] = true
+		}
+		require.GreaterOrEqual(t, len(seen), 150)
+	})
+
+	t.Run("should return error if a host does not exist", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := exporter.NewExporter(newDB(t)).Export(&buf, []string{"baz"}, exporter.NDJSON)
+
+		require.True(t, errors.Is(err, db.ErrHostNotFound))
+	})
+
+	t.Run("should return error on unknown format", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := exporter.NewExporter(newDB(t)).Export(&buf, []string{"foo"}, "parquet")
+
+		require.True(t, errors.Is(err, exporter.ErrUnknownFormat))
+	})
+}
+
+func TestExporter_ExportAll(t *testing.T) {
+	t.Run("should export the stats of all hosts", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		err := exporter.NewExporter(newDB(t)).ExportAll(&buf, exporter.NDJSON)
+
+		require.NoError(t, err)
+		require.Equal(t, 151, strings.Count(buf.String(), "\n"))
+	})
+}
+
+func TestParseFormat(t *testing.T) {
+	t.Run("should accept the known formats", func(t *testing.T) {
+		got, err := exporter.ParseFormat("csv")
+
+		require.NoError(t, err)
+		require.Equal(t, exporter.CSV, got)
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		_, err := exporter.ParseFormat("xml")
+
+		require.True(t, errors.Is(err, exporter.ErrUnknownFormat))
+	})
+}
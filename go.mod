@@ -5,6 +5,14 @@ go 1.15
 require (
 	github.com/gorilla/mux v1.8.0
 	github.com/jessevdk/go-flags v1.4.0
+	github.com/prometheus/client_golang v1.11.0
 	github.com/sirupsen/logrus v1.7.0
-	github.com/stretchr/testify v1.6.1
+	github.com/stretchr/testify v1.7.0
+	go.etcd.io/bbolt v1.3.6
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/exporters/stdout/stdouttrace v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/importer"
+	"github.com/hamburghammer/gsave/server"
+)
+
+type importCommand struct {
+	Format string `short:"f" long:"format" choice:"json" choice:"ndjson" choice:"csv" description:"The format of the files. (default: guessed from the file extension)"`
+	DryRun bool   `long:"dry-run" description:"Only read and validate the files without importing them."`
+	Args   struct {
+		Files []string `positional-arg-name:"FILE" required:"1"`
+	} `positional-args:"yes"`
+}
+
+// Execute imports all files into the configured db backend.
+func (ic *importCommand) Execute([]string) error {
+	cfg, err := readConfig(args)
+	if err != nil {
+		return err
+	}
+	applyLogConfig(cfg.Log)
+
+	hostDB, err := server.NewHostDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer closeHostDB(hostDB)
+	if cfg.DB.Backend == "memory" && !ic.DryRun {
+		logPackage.Warn("The memory db backend does not persist the imported stats")
+	}
+
+	failed := 0
+	for _, file := range ic.Args.Files {
+		result, err := importFile(hostDB, file, importer.Format(ic.Format), ic.DryRun)
+		if err != nil {
+			return err
+		}
+		failed += len(result.Errors)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d entries could not be imported", failed)
+	}
+	return nil
+}
+
+// importFile imports the stats from the file into the db.
+// If no format is given it gets guessed by the file extension.
+// Entries that could not be imported get logged and are part of the result.
+func importFile(hostDB db.HostDB, path string, format importer.Format, dryRun bool) (importer.Result, error) {
+	if format == "" {
+		var err error
+		format, err = importer.FormatFromPath(path)
+		if err != nil {
+			return importer.Result{}, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return importer.Result{}, fmt.Errorf("Could not open the file to import: %w", err)
+	}
+	defer file.Close()
+
+	logFile := logPackage.WithField("File", path)
+	result, err := importer.NewImporter(hostDB).
+		WithDryRun(dryRun).
+		WithProgress(func(imported int) {
+			logFile.Infof("Imported %d stats...", imported)
+		}).
+		Import(file, format)
+	for _, lineErr := range result.Errors {
+		logFile.Error(lineErr)
+	}
+	if err != nil {
+		return result, fmt.Errorf("Could not import '%s': %w", path, err)
+	}
+
+	if dryRun {
+		logFile.Infof("Validated %d stats with %d errors", result.Imported, len(result.Errors))
+	} else {
+		logFile.Infof("Imported %d stats with %d errors", result.Imported, len(result.Errors))
+	}
+	return result, nil
+}
@@ -0,0 +1,208 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hamburghammer/gsave/db"
+)
+
+// Format is the file format of the stats to import.
+type Format string
+
+const (
+	// JSON is a JSON array of stats.
+	JSON Format = "json"
+	// NDJSON has one JSON encoded stats entry per line.
+	NDJSON Format = "ndjson"
+	// CSV are the flattened stats with a header as described by db.CSVHeader.
+	CSV Format = "csv"
+)
+
+// progressInterval is the amount of entries after which the progress gets reported.
+const progressInterval = 1000
+
+var (
+	// ErrUnknownFormat if the format is not supported.
+	ErrUnknownFormat = errors.New("importer: Unknown format")
+	// ErrMissingHostname if a stats entry has no hostname.
+	ErrMissingHostname = errors.New("importer: Missing the hostname")
+)
+
+// FormatFromPath guesses the format by the file extension.
+// Returns ErrUnknownFormat if the extension is not known.
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".ndjson", ".jsonl":
+		return NDJSON, nil
+	case ".csv":
+		return CSV, nil
+	default:
+		return "", fmt.Errorf("%w: can not guess it from '%s'", ErrUnknownFormat, path)
+	}
+}
+
+// LineError is an error of a single entry that could not be imported.
+// For the JSON format the line is the position of the entry inside the array.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (le LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", le.Line, le.Err)
+}
+
+func (le LineError) Unwrap() error {
+	return le.Err
+}
+
+// Result is the summary of an import.
+type Result struct {
+	Imported int
+	Errors   []LineError
+}
+
+// NewImporter is a constructor for the Importer.
+func NewImporter(hostDB db.HostDB) *Importer {
+	return &Importer{hostDB: hostDB, progress: func(int) {}}
+}
+
+// Importer reads stats from files and inserts them into the db.
+type Importer struct {
+	hostDB   db.HostDB
+	dryRun   bool
+	progress func(imported int)
+}
+
+// WithDryRun only reads and validates the entries without inserting them.
+// Returns the Importer.
+func (i *Importer) WithDryRun(dryRun bool) *Importer {
+	i.dryRun = dryRun
+	return i
+}
+
+// WithProgress sets a function that gets called with the amount of imported entries every 1000 entries.
+// Returns the Importer.
+func (i *Importer) WithProgress(progress func(imported int)) *Importer {
+	i.progress = progress
+	return i
+}
+
+// Import reads all stats in the format from the reader and inserts them into the db.
+// Entries that are not valid are skipped and reported in the Result.
+// Returns an error if the reader can not be read any further.
+func (i *Importer) Import(r io.Reader, format Format) (Result, error) {
+	switch format {
+	case JSON:
+		return i.importJSON(r)
+	case NDJSON:
+		return i.importNDJSON(r)
+	case CSV:
+		return i.importCSV(r)
+	default:
+		return Result{}, fmt.Errorf("%w: '%s'", ErrUnknownFormat, format)
+	}
+}
+
+func (i *Importer) importJSON(r io.Reader) (Result, error) {
+	var result Result
+	decoder := json.NewDecoder(r)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return result, errors.New("importer: Expected a JSON array")
+	}
+
+	for line := 1; decoder.More(); line++ {
+		var stats db.Stats
+		err := decoder.Decode(&stats)
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return result, LineError{Line: line, Err: err}
+		}
+		i.insert(&result, line, stats, err)
+	}
+
+	return result, nil
+}
+
+func (i *Importer) importNDJSON(r io.Reader) (Result, error) {
+	var result Result
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var stats db.Stats
+		err := json.Unmarshal(scanner.Bytes(), &stats)
+		i.insert(&result, line, stats, err)
+	}
+
+	return result, scanner.Err()
+}
+
+func (i *Importer) importCSV(r io.Reader) (Result, error) {
+	var result Result
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return result, fmt.Errorf("importer: Could not read the CSV header: %w", err)
+	}
+	if err := db.ValidateCSVHeader(header); err != nil {
+		return result, err
+	}
+
+	// the header is the first line
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				i.insert(&result, line, db.Stats{}, err)
+				continue
+			}
+			return result, err
+		}
+
+		stats, err := db.StatsFromCSVRecord(header, record)
+		i.insert(&result, line, stats, err)
+	}
+}
+
+// insert the stats if the decoding had no error and the stats are valid.
+// Any error gets added to the result.
+func (i *Importer) insert(result *Result, line int, stats db.Stats, err error) {
+	if err == nil && stats.Hostname == "" {
+		err = ErrMissingHostname
+	}
+	if err == nil {
+		err = stats.Validate()
+	}
+	if err == nil && !i.dryRun {
+		err = i.hostDB.InsertStats(stats.Hostname, stats.Normalize())
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, LineError{Line: line, Err: err})
+		return
+	}
+
+	result.Imported++
+	if result.Imported%progressInterval == 0 {
+		i.progress(result.Imported)
+	}
+}
@@ -0,0 +1,133 @@
+package importer_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/importer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatFromPath(t *testing.T) {
+	t.Run("should guess the format by the extension", func(t *testing.T) {
+		tests := map[string]importer.Format{
+			"stats.json":   importer.JSON,
+			"stats.ndjson": importer.NDJSON,
+			"stats.jsonl":  importer.NDJSON,
+			"stats.CSV":    importer.CSV,
+		}
+		for path, want := range tests {
+			got, err := importer.FormatFromPath(path)
+
+			require.NoError(t, err)
+			require.Equal(t, want, got)
+		}
+	})
+
+	t.Run("should return error on unknown extension", func(t *testing.T) {
+		_, err := importer.FormatFromPath("stats.txt")
+
+		require.True(t, errors.Is(err, importer.ErrUnknownFormat))
+	})
+}
+
+func TestImporter_Import(t *testing.T) {
+	t.Run("should import a JSON array", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		input := `[{"hostname":"foo","cpu":1},{"hostname":"bar","date":"2020-01-01T00:00:00Z","cpu":2}]`
+
+		result, err := importer.NewImporter(memDB).Import(strings.NewReader(input), importer.JSON)
+
+		require.NoError(t, err)
+		require.Equal(t, importer.Result{Imported: 2}, result)
+
+		got, err := memDB.GetStatsByHostname("bar", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{{Hostname: "bar", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), CPU: 2}}, got)
+	})
+
+	t.Run("should report errors per line of NDJSON", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		input := "{\"hostname\":\"foo\"}\n\n{\"cpu\":1}\nnot json\n{\"hostname\":\"foo\",\"metrics\":{\"load 1\":1}}\n"
+
+		result, err := importer.NewImporter(memDB).Import(strings.NewReader(input), importer.NDJSON)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Imported)
+		require.Len(t, result.Errors, 3)
+		require.Equal(t, 3, result.Errors[0].Line)
+		require.True(t, errors.Is(result.Errors[0], importer.ErrMissingHostname))
+		require.Equal(t, 4, result.Errors[1].Line)
+		require.Equal(t, 5, result.Errors[2].Line)
+		require.True(t, errors.Is(result.Errors[2], db.ErrInvalidMetricName))
+	})
+
+	t.Run("should import CSV", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		input := "hostname,date,cpu,mem_used,metric.load1\nfoo,2020-01-01T00:00:00Z,0.5,10,1.5\nfoo,yesterday,1,1,\n"
+
+		result, err := importer.NewImporter(memDB).Import(strings.NewReader(input), importer.CSV)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Imported)
+		require.Len(t, result.Errors, 1)
+		require.Equal(t, 3, result.Errors[0].Line)
+
+		got, err := memDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		want := db.Stats{
+			Hostname: "foo",
+			Date:     time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			CPU:      0.5,
+			Mem:      db.Memory{Used: 10},
+			Metrics:  map[string]float64{"load1": 1.5},
+		}
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{want}, got)
+	})
+
+	t.Run("should reject an unknown CSV column", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		input := "hostname,temperature\nfoo,1\n"
+
+		_, err := importer.NewImporter(memDB).Import(strings.NewReader(input), importer.CSV)
+
+		require.True(t, errors.Is(err, db.ErrUnknownCSVColumn))
+	})
+
+	t.Run("should not insert on a dry run", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		input := "{\"hostname\":\"foo\"}\n"
+
+		result, err := importer.NewImporter(memDB).WithDryRun(true).Import(strings.NewReader(input), importer.NDJSON)
+
+		require.NoError(t, err)
+		require.Equal(t, 1, result.Imported)
+
+		_, err = memDB.GetHost("foo")
+		require.EqualError(t, err, db.ErrHostNotFound.Error())
+	})
+
+	t.Run("should report the progress", func(t *testing.T) {
+		var input strings.Builder
+		for i := 0; i < 2500; i++ {
+			input.WriteString("{\"hostname\":\"foo\"}\n")
+		}
+
+		progress := []int{}
+		_, err := importer.NewImporter(db.NewInMemoryDB()).
+			WithProgress(func(imported int) { progress = append(progress, imported) }).
+			Import(strings.NewReader(input.String()), importer.NDJSON)
+
+		require.NoError(t, err)
+		require.Equal(t, []int{1000, 2000}, progress)
+	})
+
+	t.Run("should return error on unknown format", func(t *testing.T) {
+		_, err := importer.NewImporter(db.NewInMemoryDB()).Import(strings.NewReader(""), "xml")
+
+		require.True(t, errors.Is(err, importer.ErrUnknownFormat))
+	})
+}
@@ -2,148 +2,233 @@ package main
 
 import (
 	"context"
-	"errors"
-	"fmt"
-	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/mux"
-	"github.com/hamburghammer/gsave/controller"
-	"github.com/hamburghammer/gsave/controller/middleware"
+	"github.com/hamburghammer/gsave/config"
 	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/server"
 	"github.com/jessevdk/go-flags"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
-	servePort  int
+	args       arguments
+	parser     = flags.NewParser(&args, flags.Default)
 	logPackage = log.WithField("Package", "main")
 )
 
 type arguments struct {
-	Port        int    `short:"p" long:"port" default:"8080" description:"The port for the HTTP server." env:"GSAVE_PORT"`
-	Token       string `short:"t" long:"token" required:"yes" description:"The token for the authentication through HTTP." env:"GSAVE_TOKEN"`
-	Verbose     bool   `short:"v" long:"verbose" description:"Enable trace logging level output."`
-	Quiet       bool   `short:"q" long:"quiet" description:"Disable standard logging output and only prints errors."`
-	JSONLogging bool   `long:"json" description:"Set the logging format to json."`
+	Config          string        `short:"c" long:"config" description:"Path to a YAML config file. It gets reloaded on SIGHUP." env:"GSAVE_CONFIG"`
+	Port            int           `short:"p" long:"port" description:"The port for the HTTP server. (default: 8080)" env:"GSAVE_PORT"`
+	Listen          []string      `long:"listen" description:"An address like :8080 or unix:///run/gsave.sock to serve on instead of the port. Can be set multiple times." env:"GSAVE_LISTEN" env-delim:","`
+	Token           string        `short:"t" long:"token" description:"The token for the authentication through HTTP." env:"GSAVE_TOKEN"`
+	AdminTokens     []string      `long:"admin-token" description:"A token with the admin scope to delete and merge hosts. Can be set multiple times." env:"GSAVE_ADMIN_TOKENS" env-delim:","`
+	DBBackend       string        `long:"db-backend" description:"The db backend to store the stats. (default: memory)" choice:"memory" choice:"bolt" env:"GSAVE_DB_BACKEND"`
+	DBPath          string        `long:"db-path" description:"The file of the bolt db backend." env:"GSAVE_DB_PATH"`
+	TLSCert         string        `long:"tls-cert" description:"The certificate file to serve HTTPS. It gets reloaded on SIGHUP or when the file changes." env:"GSAVE_TLS_CERT"`
+	TLSKey          string        `long:"tls-key" description:"The key file of the certificate to serve HTTPS." env:"GSAVE_TLS_KEY"`
+	TLSClientCA     string        `long:"tls-client-ca" description:"A CA file to authenticate agents by their client certificate. The certificate name must match the host." env:"GSAVE_TLS_CLIENT_CA"`
+	SigningSecret   string        `long:"signing-secret" description:"A secret shared with the agents to require HMAC signed requests for posting stats." env:"GSAVE_SIGNING_SECRET"`
+	AuditLog        string        `long:"audit-log" description:"A file to record who accessed which route and host. It gets rotated by its size." env:"GSAVE_AUDIT_LOG"`
+	TracingExporter string        `long:"tracing-exporter" description:"Export OpenTelemetry spans of the requests and db calls with OTLP/HTTP or to the standard output." choice:"otlp" choice:"stdout" env:"GSAVE_TRACING_EXPORTER"`
+	TracingEndpoint string        `long:"tracing-endpoint" description:"The host and port of the OTLP/HTTP collector." env:"GSAVE_TRACING_ENDPOINT"`
+	MetricsListen   string        `long:"metrics-listen" description:"An address like 127.0.0.1:9100 to serve the metrics of gsave without authentication on /metrics." env:"GSAVE_METRICS_LISTEN"`
+	Retention       time.Duration `long:"retention" description:"Delete stats that are older than the duration. (default: keep forever)" env:"GSAVE_RETENTION"`
+	Verbose         bool          `short:"v" long:"verbose" description:"Enable trace logging level output."`
+	Quiet           bool          `short:"q" long:"quiet" description:"Disable standard logging output and only prints errors."`
+	JSONLogging     bool          `long:"json" description:"Set the logging format to json."`
+	AccessLog       string        `long:"access-log" description:"Write a line for every request to stdout in the common or combined log format." choice:"common" choice:"combined" env:"GSAVE_ACCESS_LOG"`
+	SeedFiles       []string      `long:"seed-file" description:"A JSON, NDJSON or CSV file with stats to import on start. Can be set multiple times." env:"GSAVE_SEED_FILES" env-delim:","`
 }
 
-func init() {
-	args := arguments{}
-	_, err := flags.Parse(&args)
-	if err != nil {
-		if _, ok := err.(*flags.Error); ok {
-			os.Exit(1)
-			return
-		}
-		logPackage.Fatal(err)
+// override the values of the config with the arguments that are set.
+func (a arguments) override(cfg config.Config) config.Config {
+	if a.Port != 0 {
+		cfg.Port = a.Port
 	}
-
-	servePort = args.Port
-
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp: true,
-	})
-
-	if args.Verbose {
-		log.SetLevel(log.TraceLevel)
+	if a.Token != "" {
+		cfg.Tokens = []string{a.Token}
 	}
-	if args.Quiet {
-		log.SetLevel(log.ErrorLevel)
+	if len(a.AdminTokens) > 0 {
+		cfg.AdminTokens = a.AdminTokens
 	}
-	if args.JSONLogging {
-		log.SetFormatter(&log.JSONFormatter{})
+	if a.DBBackend != "" {
+		cfg.DB.Backend = a.DBBackend
+	}
+	if a.DBPath != "" {
+		cfg.DB.Path = a.DBPath
+	}
+	if a.TLSCert != "" {
+		cfg.TLS.Cert = a.TLSCert
+	}
+	if a.TLSKey != "" {
+		cfg.TLS.Key = a.TLSKey
+	}
+	if a.TLSClientCA != "" {
+		cfg.TLS.ClientCA = a.TLSClientCA
+	}
+	if a.SigningSecret != "" {
+		cfg.Signing.Secret = a.SigningSecret
 	}
+	if a.AuditLog != "" {
+		cfg.Audit.Path = a.AuditLog
+	}
+	if a.TracingExporter != "" {
+		cfg.Tracing.Exporter = a.TracingExporter
+	}
+	if a.TracingEndpoint != "" {
+		cfg.Tracing.Endpoint = a.TracingEndpoint
+	}
+	if len(a.Listen) > 0 {
+		cfg.Listen = a.Listen
+	}
+	if a.MetricsListen != "" {
+		cfg.Metrics.Listen = a.MetricsListen
+	}
+	if a.Retention != 0 {
+		cfg.Retention = a.Retention
+	}
+	if a.Verbose {
+		cfg.Log.Level = log.TraceLevel.String()
+	}
+	if a.Quiet {
+		cfg.Log.Level = log.ErrorLevel.String()
+	}
+	if a.JSONLogging {
+		cfg.Log.JSON = true
+	}
+	if a.AccessLog != "" {
+		cfg.Log.Access = a.AccessLog
+	}
+	return cfg
 }
 
 func main() {
-	logPackage.Info("Initializing the DB...")
-	stats := []db.Stats{
-		{Hostname: "foo", CPU: 0, Disk: db.Memory{Total: 10, Used: 5}, Mem: db.Memory{Total: 20, Used: 10}, Processes: []db.Process{{Name: "foo", Pid: 1, CPU: 0.5}}},
-		{Hostname: "foo", CPU: 1},
-		{Hostname: "bar", CPU: 0},
+	parser.SubcommandsOptional = true
+	parser.AddCommand("import", "Import stats from files", "Import stats from JSON, NDJSON or CSV files into the configured db backend.", &importCommand{})
+	parser.AddCommand("export", "Export stats to a file", "Export the stats of one or all hosts from the configured db backend as NDJSON or CSV.", &exportCommand{})
+	parser.AddCommand("restore", "Restore a backup", "Replace the data of the configured db backend with a backup from POST /admin/backup.", &restoreCommand{})
+
+	if _, err := parser.Parse(); err != nil {
+		// the error was already printed by the parser
+		os.Exit(1)
+	}
+	if parser.Active != nil {
+		// a command was executed
+		return
+	}
+
+	cfg, err := loadConfig(args)
+	if err != nil {
+		logPackage.Fatal(err)
 	}
-	hostDB, err := initDB(stats)
+	applyLogConfig(cfg.Log)
+
+	logPackage.Info("Starting the HTTP server...")
+	srv, err := server.New(server.Config{Config: cfg})
 	if err != nil {
 		logPackage.Fatal(err)
 	}
 
-	logPackage.Info("Initializing the routes...")
-	controllers := []controller.Router{
-		controller.NewHostsRouter(hostDB),
+	for _, seedFile := range args.SeedFiles {
+		logPackage.Infof("Seeding the DB from '%s'...", seedFile)
+		if _, err := importFile(srv.HostDB(), seedFile, "", false); err != nil {
+			logPackage.Fatal(err)
+		}
 	}
-	router := initRouter(hostDB, controllers)
 
-	auth := middleware.NewAuthMiddleware([]string{"foo"})
-	// Add default middlewares
-	router.Use(middleware.RequestTimeLoggingHandler)
-	router.Use(middleware.PanicRecoverHandler)
-	router.Use(auth.AuthHandler)
+	ctx, cancel := context.WithCancel(context.Background())
+	go listenToStop(cancel)
+	go listenToReloadConfig(args, srv)
 
-	logPackage.Info("Starting the HTTP server...")
-	server := &http.Server{
-		Handler:      router,
-		Addr:         fmt.Sprintf(":%d", servePort),
-		WriteTimeout: 15 * time.Second,
-		ReadTimeout:  15 * time.Second,
-		IdleTimeout:  120 * time.Second,
+	// Run closes the db after the running requests and the background jobs finished
+	if err := srv.Run(ctx); err != nil {
+		logPackage.Fatal(err)
 	}
+	logPackage.Info("Stopped")
+}
 
-	var wg sync.WaitGroup
-	wg.Add(2)
-	go startHTTPServer(server, &wg)
-	go listenToStopHTTPServer(server, &wg)
-
-	wg.Wait()
+// closeHostDB closes the db backend of a command.
+func closeHostDB(hostDB db.HostDB) {
+	if err := hostDB.Close(); err != nil {
+		logPackage.Errorf("Could not close the db: %v", err)
+	}
 }
 
-func initDB(stats []db.Stats) (db.HostDB, error) {
-	hostDB := db.NewInMemoryDB()
-	for _, stat := range stats {
-		if err := hostDB.InsertStats(stat.Hostname, stat); err != nil {
-			return hostDB, fmt.Errorf("Init db throwed an error: %w", err)
+// readConfig reads the config file if one is set and overrides it with the arguments.
+func readConfig(args arguments) (config.Config, error) {
+	cfg := config.Default()
+	if args.Config != "" {
+		var err error
+		cfg, err = config.Load(args.Config)
+		if err != nil {
+			return config.Config{}, err
 		}
 	}
 
-	return hostDB, nil
+	return args.override(cfg), nil
 }
 
-func initRouter(hostDB db.HostDB, controllers []controller.Router) *mux.Router {
-	router := mux.NewRouter()
-	for _, controller := range controllers {
-		subrouter := router.PathPrefix(controller.GetPrefix()).Name(controller.GetRouteName()).Subrouter()
-		controller.Register(subrouter)
+// loadConfig reads the config like readConfig and validates it.
+func loadConfig(args arguments) (config.Config, error) {
+	cfg, err := readConfig(args)
+	if err != nil {
+		return config.Config{}, err
 	}
-
-	return router
+	if err := cfg.Validate(); err != nil {
+		return config.Config{}, err
+	}
+	return cfg, nil
 }
 
-func startHTTPServer(server *http.Server, wg *sync.WaitGroup) {
-	defer wg.Done()
-	logPackage.Infof("The HTTP server is running: http://localhost:%d/hosts\n", servePort)
-	if err := server.ListenAndServe(); err != nil {
-		if errors.Is(err, http.ErrServerClosed) {
-			logPackage.Info("Shutting down the server...")
-			return
-		}
-		logPackage.Fatalf("An unexpected error happend while running the HTTP server: %v\n", err)
+func applyLogConfig(logCfg config.Log) {
+	if logCfg.JSON {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{
+			FullTimestamp: true,
+		})
 	}
-}
 
-func listenToStopHTTPServer(server *http.Server, wg *sync.WaitGroup) {
-	defer wg.Done()
+	level, err := log.ParseLevel(logCfg.Level)
+	if err != nil {
+		logPackage.Errorf("Could not set the log level: %v", err)
+		return
+	}
+	log.SetLevel(level)
+}
 
+// listenToStop cancels the context to stop the server on an interrupt or a SIGTERM.
+func listenToStop(cancel context.CancelFunc) {
 	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, os.Interrupt, os.Kill)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	<-stop
+	cancel()
+}
+
+// listenToReloadConfig reloads the config on every SIGHUP.
+// The log config, tokens and retention are applied to the running server.
+// An invalid config gets rejected and the running config stays untouched.
+func listenToReloadConfig(args arguments, srv *server.Server) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+
+	for range reload {
+		logPackage.Info("Reloading the config...")
+		cfg, err := loadConfig(args)
+		if err == nil {
+			err = srv.Reload(cfg)
+		}
+		if err != nil {
+			logPackage.Errorf("The config was not reloaded: %v", err)
+			continue
+		}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		logPackage.Errorf("An error happened on the shutdown of the server: %v", err)
+		applyLogConfig(cfg.Log)
+		logPackage.Info("The config got reloaded")
 	}
 }
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+)
+
+// NewHostDB wraps the HostDB so that the duration and the errors of every call get recorded.
+func (m *Metrics) NewHostDB(hostDB db.HostDB) *HostDB {
+	return &HostDB{hostDB: hostDB, metrics: m}
+}
+
+// HostDB is a decorator for any db.HostDB that records the metrics of its calls.
+type HostDB struct {
+	hostDB  db.HostDB
+	metrics *Metrics
+}
+
+// WithContext binds the context to the wrapped HostDB if it uses one.
+func (h *HostDB) WithContext(ctx context.Context) db.HostDB {
+	return &HostDB{hostDB: db.WithContext(ctx, h.hostDB), metrics: h.metrics}
+}
+
+// GetHosts measures db.HostDB.GetHosts.
+func (h *HostDB) GetHosts(query db.HostQuery, pagination db.Pagination) ([]db.HostInfo, error) {
+	start := time.Now()
+	hosts, err := h.hostDB.GetHosts(query, pagination)
+	h.metrics.observeDB("GetHosts", start, err)
+	return hosts, err
+}
+
+// GetHost measures db.HostDB.GetHost.
+func (h *HostDB) GetHost(hostname string) (db.HostInfo, error) {
+	start := time.Now()
+	host, err := h.hostDB.GetHost(hostname)
+	h.metrics.observeDB("GetHost", start, err)
+	return host, err
+}
+
+// GetStatsByHostname measures db.HostDB.GetStatsByHostname.
+func (h *HostDB) GetStatsByHostname(hostname string, pagination db.Pagination) ([]db.Stats, error) {
+	start := time.Now()
+	stats, err := h.hostDB.GetStatsByHostname(hostname, pagination)
+	h.metrics.observeDB("GetStatsByHostname", start, err)
+	return stats, err
+}
+
+// GetStatsPage measures db.HostDB.GetStatsPage.
+func (h *HostDB) GetStatsPage(hostname string, cursor db.StatsCursor, limit int) ([]db.Stats, db.StatsCursor, error) {
+	start := time.Now()
+	stats, next, err := h.hostDB.GetStatsPage(hostname, cursor, limit)
+	h.metrics.observeDB("GetStatsPage", start, err)
+	return stats, next, err
+}
+
+// InsertStats measures db.HostDB.InsertStats and counts the inserted stats.
+func (h *HostDB) InsertStats(hostname string, stats db.Stats) error {
+	start := time.Now()
+	err := h.hostDB.InsertStats(hostname, stats)
+	h.metrics.observeDB("InsertStats", start, err)
+	if err == nil {
+		h.metrics.insertedStats.Inc()
+	}
+	return err
+}
+
+// DeleteHost measures db.HostDB.DeleteHost.
+func (h *HostDB) DeleteHost(hostname string) error {
+	start := time.Now()
+	err := h.hostDB.DeleteHost(hostname)
+	h.metrics.observeDB("DeleteHost", start, err)
+	return err
+}
+
+// MergeHosts measures db.HostDB.MergeHosts.
+func (h *HostDB) MergeHosts(source, target string) error {
+	start := time.Now()
+	err := h.hostDB.MergeHosts(source, target)
+	h.metrics.observeDB("MergeHosts", start, err)
+	return err
+}
+
+// DeleteStatsBefore measures db.HostDB.DeleteStatsBefore.
+func (h *HostDB) DeleteStatsBefore(date time.Time) (int, error) {
+	start := time.Now()
+	deleted, err := h.hostDB.DeleteStatsBefore(date)
+	h.metrics.observeDB("DeleteStatsBefore", start, err)
+	return deleted, err
+}
+
+// InsertEvent measures db.HostDB.InsertEvent.
+func (h *HostDB) InsertEvent(event db.Event) (db.Event, error) {
+	start := time.Now()
+	event, err := h.hostDB.InsertEvent(event)
+	h.metrics.observeDB("InsertEvent", start, err)
+	return event, err
+}
+
+// GetEvents measures db.HostDB.GetEvents.
+func (h *HostDB) GetEvents(filter db.EventFilter, pagination db.Pagination) ([]db.Event, error) {
+	start := time.Now()
+	events, err := h.hostDB.GetEvents(filter, pagination)
+	h.metrics.observeDB("GetEvents", start, err)
+	return events, err
+}
+
+// Snapshot measures db.HostDB.Snapshot.
+func (h *HostDB) Snapshot() (db.Snapshot, error) {
+	start := time.Now()
+	snapshot, err := h.hostDB.Snapshot()
+	h.metrics.observeDB("Snapshot", start, err)
+	return snapshot, err
+}
+
+// Restore measures db.HostDB.Restore.
+func (h *HostDB) Restore(snapshot db.Snapshot) error {
+	start := time.Now()
+	err := h.hostDB.Restore(snapshot)
+	h.metrics.observeDB("Restore", start, err)
+	return err
+}
+
+// Close closes the wrapped HostDB.
+func (h *HostDB) Close() error {
+	return h.hostDB.Close()
+}
@@ -0,0 +1,140 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+var logPackage = log.WithField("Package", "metrics")
+
+const namespace = "gsave"
+
+// MemoryUser is implemented by db backends that know how much memory their data occupies.
+type MemoryUser interface {
+	// MemoryUsage returns the estimated bytes of the data.
+	MemoryUsage() int
+}
+
+// New creates the metrics of gsave itself in an own registry.
+// The data points of the hosts and the memory usage are read from the db when the metrics get collected.
+func New(hostDB db.HostDB) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "Handled HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of the HTTP requests by route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route"}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "db_operation_duration_seconds",
+			Help:      "Duration of the db operations.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1, 5},
+		}, []string{"operation"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "db_operation_errors_total",
+			Help:      "Failed db operations including not found errors.",
+		}, []string{"operation"}),
+		insertedStats: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "inserted_stats_total",
+			Help:      "Stats inserted into the db.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.dbDuration,
+		m.dbErrors,
+		m.insertedStats,
+		newHostsCollector(hostDB),
+		prometheus.NewExpvarCollector(map[string]*prometheus.Desc{
+			"throttledRequests": prometheus.NewDesc(namespace+"_throttled_requests_total", "Requests rejected by the rate limit by route.", []string{"route"}, nil),
+			"authFailures":      prometheus.NewDesc(namespace+"_auth_failures_total", "Requests rejected by the authentication by reason.", []string{"reason"}, nil),
+			"panicsRecovered":   prometheus.NewDesc(namespace+"_panics_recovered_total", "Panics recovered while handling a request.", nil, nil),
+		}),
+	)
+	if memoryUser, ok := hostDB.(MemoryUser); ok {
+		m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "memory_db_bytes",
+			Help:      "Estimated memory occupied by the stats of the in memory db.",
+		}, func() float64 { return float64(memoryUser.MemoryUsage()) }))
+	}
+
+	return m
+}
+
+// Metrics holds the metrics of gsave itself.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	dbDuration      *prometheus.HistogramVec
+	dbErrors        *prometheus.CounterVec
+	insertedStats   prometheus.Counter
+}
+
+// ObserveRequest counts the request and records its duration.
+func (m *Metrics) ObserveRequest(routeName, method string, statusCode int, duration time.Duration) {
+	m.requests.WithLabelValues(routeName, method, strconv.Itoa(statusCode)).Inc()
+	m.requestDuration.WithLabelValues(routeName).Observe(duration.Seconds())
+}
+
+// observeDB records the duration and the error of a db operation.
+func (m *Metrics) observeDB(operation string, start time.Time, err error) {
+	m.dbDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.dbErrors.WithLabelValues(operation).Inc()
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{ErrorLog: logPackage})
+}
+
+// hostsCollector collects the data points of every host from the db.
+type hostsCollector struct {
+	hostDB     db.HostDB
+	dataPoints *prometheus.Desc
+}
+
+func newHostsCollector(hostDB db.HostDB) *hostsCollector {
+	return &hostsCollector{
+		hostDB:     hostDB,
+		dataPoints: prometheus.NewDesc(namespace+"_host_data_points", "Stored stats by host.", []string{"hostname"}, nil),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (hc *hostsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hc.dataPoints
+}
+
+// Collect implements prometheus.Collector.
+func (hc *hostsCollector) Collect(ch chan<- prometheus.Metric) {
+	err := db.ForEachHost(hc.hostDB, func(host db.HostInfo) bool {
+		ch <- prometheus.MustNewConstMetric(hc.dataPoints, prometheus.GaugeValue, float64(host.DataPoints), host.Hostname)
+		return true
+	})
+	if err != nil {
+		logPackage.Errorf("Could not collect the data points of the hosts: %v", err)
+	}
+}
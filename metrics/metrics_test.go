@@ -0,0 +1,79 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/dbtest"
+	"github.com/hamburghammer/gsave/metrics"
+	"github.com/stretchr/testify/require"
+)
+
+// scrape returns the metrics in the Prometheus text format.
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	return rr.Body.String()
+}
+
+func TestHostDB_Conformance(t *testing.T) {
+	dbtest.RunConformance(t, func() db.HostDB {
+		hostDB := db.NewInMemoryDB()
+		return metrics.New(hostDB).NewHostDB(hostDB)
+	})
+}
+
+func TestMetrics(t *testing.T) {
+	t.Run("should count the requests by route", func(t *testing.T) {
+		m := metrics.New(db.NewInMemoryDB())
+
+		m.ObserveRequest("PostStats", http.MethodPost, http.StatusCreated, time.Millisecond)
+		m.ObserveRequest("PostStats", http.MethodPost, http.StatusCreated, time.Millisecond)
+
+		got := scrape(t, m)
+		require.Contains(t, got, `gsave_http_requests_total{code="201",method="POST",route="PostStats"} 2`)
+		require.Contains(t, got, `gsave_http_request_duration_seconds_count{route="PostStats"} 2`)
+	})
+
+	t.Run("should record the db operations", func(t *testing.T) {
+		rawDB := db.NewInMemoryDB()
+		m := metrics.New(rawDB)
+		hostDB := m.NewHostDB(rawDB)
+
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{}))
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{}))
+		_, err := hostDB.GetHost("bar")
+		require.Error(t, err)
+
+		got := scrape(t, m)
+		require.Contains(t, got, `gsave_db_operation_duration_seconds_count{operation="InsertStats"} 2`)
+		require.Contains(t, got, `gsave_db_operation_errors_total{operation="GetHost"} 1`)
+		require.Contains(t, got, "gsave_inserted_stats_total 2")
+		require.Contains(t, got, `gsave_host_data_points{hostname="foo"} 2`)
+	})
+
+	t.Run("should report the memory of the in memory db", func(t *testing.T) {
+		rawDB := db.NewInMemoryDB()
+		require.NoError(t, rawDB.InsertStats("foo", db.Stats{Hostname: "foo"}))
+
+		got := scrape(t, metrics.New(rawDB))
+
+		require.Contains(t, got, "gsave_memory_db_bytes ")
+		require.NotContains(t, got, "gsave_memory_db_bytes 0\n")
+	})
+
+	t.Run("should not report the memory of other dbs", func(t *testing.T) {
+		boltDB, err := db.NewBoltDB(filepath.Join(t.TempDir(), "gsave.db"))
+		require.NoError(t, err)
+		defer boltDB.Close()
+
+		got := scrape(t, metrics.New(boltDB))
+
+		require.NotContains(t, got, "gsave_memory_db_bytes")
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hamburghammer/gsave/backup"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/server"
+)
+
+type restoreCommand struct {
+	Force bool `long:"force" description:"Replace the data even if the db backend is not empty."`
+	Args  struct {
+		File string `positional-arg-name:"FILE" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+// Execute replaces the data of the configured db backend with the backup.
+func (rc *restoreCommand) Execute([]string) error {
+	cfg, err := readConfig(args)
+	if err != nil {
+		return err
+	}
+	applyLogConfig(cfg.Log)
+
+	file, err := os.Open(rc.Args.File)
+	if err != nil {
+		return fmt.Errorf("Could not open the backup: %w", err)
+	}
+	defer file.Close()
+
+	snapshot, err := backup.Read(file)
+	if err != nil {
+		return err
+	}
+
+	hostDB, err := server.NewHostDB(cfg.DB)
+	if err != nil {
+		return err
+	}
+	defer closeHostDB(hostDB)
+	if cfg.DB.Backend == "memory" {
+		logPackage.Warn("The memory db backend does not persist the restored data")
+	}
+
+	if !rc.Force {
+		_, err := hostDB.GetHosts(db.HostQuery{}, db.Pagination{Skip: 0, Limit: 1})
+		if !errors.Is(err, db.ErrHostsNotFound) {
+			return errors.New("The db backend is not empty, use --force to replace its data")
+		}
+	}
+
+	if err := hostDB.Restore(snapshot); err != nil {
+		return err
+	}
+	logPackage.Infof("Restored %d hosts and %d events", len(snapshot.Hosts), len(snapshot.Events))
+	return nil
+}
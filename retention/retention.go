@@ -0,0 +1,82 @@
+package retention
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	log "github.com/sirupsen/logrus"
+)
+
+var logPackage = log.WithField("Package", "retention")
+
+// NewJob is a constructor for the retention Job.
+// A retention of zero keeps the stats forever.
+func NewJob(hostDB db.HostDB, retention time.Duration) *Job {
+	return &Job{hostDB: hostDB, retention: retention, interval: time.Minute}
+}
+
+// Job periodically deletes all stats that are older than the retention.
+type Job struct {
+	hostDB    db.HostDB
+	retention time.Duration
+	interval  time.Duration
+	m         sync.RWMutex
+}
+
+// WithInterval sets the interval between two runs.
+// Returns the Job.
+func (j *Job) WithInterval(interval time.Duration) *Job {
+	j.interval = interval
+	return j
+}
+
+// SetRetention changes the retention while the job is running.
+func (j *Job) SetRetention(retention time.Duration) {
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	j.retention = retention
+}
+
+// Retention returns the current retention.
+func (j *Job) Retention() time.Duration {
+	j.m.RLock()
+	defer j.m.RUnlock()
+
+	return j.retention
+}
+
+// Run deletes the old stats every interval until the context is done.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			j.RunOnce()
+		}
+	}
+}
+
+// RunOnce deletes all stats older than the retention.
+// It does nothing if the retention is zero.
+func (j *Job) RunOnce() {
+	retention := j.Retention()
+	if retention <= 0 {
+		return
+	}
+
+	deleted, err := j.hostDB.DeleteStatsBefore(time.Now().Add(-retention))
+	if err != nil {
+		logPackage.Errorf("Could not delete the old stats: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logPackage.Infof("Deleted %d stats older than %v", deleted, retention)
+	}
+}
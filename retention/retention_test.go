@@ -0,0 +1,48 @@
+package retention_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/retention"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJob_RunOnce(t *testing.T) {
+	t.Run("should delete the stats older than the retention", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertStats("foo", db.Stats{Date: time.Now().Add(-2 * time.Hour)})
+		memDB.InsertStats("foo", db.Stats{Date: time.Now()})
+
+		retention.NewJob(memDB, time.Hour).RunOnce()
+
+		got, err := memDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.DataPoints)
+	})
+
+	t.Run("should keep everything without a retention", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertStats("foo", db.Stats{Date: time.Now().Add(-2 * time.Hour)})
+
+		retention.NewJob(memDB, 0).RunOnce()
+
+		got, err := memDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 1, got.DataPoints)
+	})
+
+	t.Run("should use the changed retention", func(t *testing.T) {
+		memDB := db.NewInMemoryDB()
+		memDB.InsertStats("foo", db.Stats{Date: time.Now().Add(-2 * time.Hour)})
+
+		job := retention.NewJob(memDB, 0)
+		job.SetRetention(time.Hour)
+		job.RunOnce()
+
+		got, err := memDB.GetHost("foo")
+		require.NoError(t, err)
+		require.Equal(t, 0, got.DataPoints)
+	})
+}
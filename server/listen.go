@@ -0,0 +1,126 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/hamburghammer/gsave/config"
+	"github.com/hamburghammer/gsave/systemd"
+)
+
+// ErrSocketInUse if another process serves on the unix socket.
+var ErrSocketInUse = errors.New("server: The unix socket is used by another process")
+
+// openListeners opens the sockets passed by systemd or otherwise the configured addresses.
+// Without configured addresses it listens on the port.
+func openListeners(cfg config.Config) ([]net.Listener, error) {
+	listeners, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(listeners) > 0 {
+		logPackage.Infof("Using %d sockets of the systemd socket activation", len(listeners))
+		return listeners, nil
+	}
+
+	addresses := cfg.Listen
+	if len(addresses) == 0 {
+		addresses = []string{fmt.Sprintf(":%d", cfg.Port)}
+	}
+	for _, address := range addresses {
+		listener, err := listen(address, cfg.UnixSocket)
+		if err != nil {
+			closeListeners(listeners)
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// listen opens a unix socket for "unix://" addresses and a TCP socket for all others.
+func listen(address string, socket config.UnixSocket) (net.Listener, error) {
+	if !strings.HasPrefix(address, "unix://") {
+		listener, err := net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+		if err != nil {
+			return nil, fmt.Errorf("server: Could not listen on %s: %w", address, err)
+		}
+		return listener, nil
+	}
+
+	path := strings.TrimPrefix(address, "unix://")
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("server: Could not listen on %s: %w", address, err)
+	}
+	if err := setPermissions(path, socket); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// removeStaleSocket removes the socket file that was left by a process that did not stop properly.
+// Returns ErrSocketInUse if a process still serves on it.
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		// nothing to remove or not a socket that gets reported by the listen
+		return nil
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%w: '%s'", ErrSocketInUse, path)
+	}
+	return os.Remove(path)
+}
+
+// setPermissions sets the mode and the group of the socket file.
+func setPermissions(path string, socket config.UnixSocket) error {
+	mode, err := socket.FileMode()
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(path, mode); err != nil {
+		return fmt.Errorf("server: Could not set the mode of the unix socket: %w", err)
+	}
+	if socket.Group == "" {
+		return nil
+	}
+
+	group, err := user.LookupGroup(socket.Group)
+	if err != nil {
+		return fmt.Errorf("server: Could not find the group of the unix socket: %w", err)
+	}
+	gid, err := strconv.Atoi(group.Gid)
+	if err != nil {
+		return fmt.Errorf("server: Invalid id of the group '%s': %w", socket.Group, err)
+	}
+	if err := os.Chown(path, -1, gid); err != nil {
+		return fmt.Errorf("server: Could not set the group of the unix socket: %w", err)
+	}
+	return nil
+}
+
+// closeListeners closes all listeners.
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// listenerURL returns the URL of the listener for the log output.
+func listenerURL(scheme string, listener net.Listener) string {
+	if listener.Addr().Network() == "unix" {
+		return fmt.Sprintf("unix://%s", listener.Addr())
+	}
+	return fmt.Sprintf("%s://%s", scheme, listener.Addr())
+}
@@ -0,0 +1,579 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/hamburghammer/gsave/config"
+	"github.com/hamburghammer/gsave/controller"
+	"github.com/hamburghammer/gsave/controller/middleware"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/metrics"
+	"github.com/hamburghammer/gsave/retention"
+	"github.com/hamburghammer/gsave/signature"
+	"github.com/hamburghammer/gsave/systemd"
+	"github.com/hamburghammer/gsave/tracing"
+	log "github.com/sirupsen/logrus"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+var logPackage = log.WithField("Package", "server")
+
+// ErrDBInUse if the db could not be closed on the shutdown because requests or background jobs did not stop in time.
+var ErrDBInUse = errors.New("server: The db is still in use and was not closed")
+
+// tracingFlushTimeout is the time the remaining spans get to be exported when the server stops.
+const tracingFlushTimeout = 5 * time.Second
+
+// Config is the configuration to build a Server.
+type Config struct {
+	config.Config
+	// HostDB is used as storage instead of creating the configured backend if it is set.
+	// It gets closed when the server stops.
+	HostDB db.HostDB
+	// AccessLog is written with the lines of the access log instead of stdout if it is set.
+	AccessLog io.Writer
+}
+
+// Server is the gsave HTTP server with all its dependencies.
+type Server struct {
+	cfg          Config
+	cfgM         sync.RWMutex
+	hostDB       db.HostDB
+	auth         *middleware.AuthMiddleware
+	rateLimit    *middleware.RateLimitMiddleware
+	ipRateLimit  *middleware.RateLimitMiddleware
+	accessLog    *middleware.AccessLogMiddleware
+	certs        *certReloader
+	verifier     *signature.Verifier
+	auditLog     *audit.Log
+	tracer       *sdktrace.TracerProvider
+	tracing      *middleware.TracingMiddleware
+	metrics      *metrics.Metrics
+	health       *controller.HealthRouter
+	inFlight     *middleware.InFlightMiddleware
+	retentionJob *retention.Job
+	httpServer   *http.Server
+	listeners    []net.Listener
+	// metricsServer serves the metrics on their own listener if it is configured.
+	metricsServer   *http.Server
+	metricsListener net.Listener
+	// drained is closed after Shutdown finished draining the running requests.
+	drained     chan struct{}
+	drainedOnce sync.Once
+}
+
+// New builds a new Server from the config and opens its listeners.
+// The sockets of a systemd socket activation are used instead of the configured listen addresses and port.
+// A port of zero listens on a random free port which can be read with Addr.
+func New(cfg Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	var certs *certReloader
+	var tlsConfig *tls.Config
+	if cfg.TLS.Enabled() {
+		var err error
+		if certs, err = newCertReloader(cfg.TLS.Cert, cfg.TLS.Key); err != nil {
+			return nil, err
+		}
+		if tlsConfig, err = newTLSConfig(cfg.TLS, certs); err != nil {
+			return nil, err
+		}
+	}
+
+	var auditLog *audit.Log
+	if cfg.Audit.Enabled() {
+		var err error
+		if auditLog, err = audit.NewLog(cfg.Audit.Path); err != nil {
+			return nil, err
+		}
+		auditLog.WithMaxSize(int64(cfg.Audit.MaxSizeMB) << 20).WithMaxBackups(cfg.Audit.MaxBackups)
+	}
+
+	hostDB := cfg.HostDB
+	if hostDB == nil {
+		var err error
+		hostDB, err = NewHostDB(cfg.DB)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	selfMetrics := metrics.New(hostDB)
+	var tracer *sdktrace.TracerProvider
+	if cfg.Tracing.Enabled() {
+		var err error
+		if tracer, err = tracing.NewTracerProvider(context.Background(), cfg.Tracing); err != nil {
+			return nil, err
+		}
+		hostDB = tracing.NewHostDB(hostDB, tracer)
+	}
+	hostDB = selfMetrics.NewHostDB(hostDB)
+
+	s := &Server{
+		cfg:    cfg,
+		hostDB: hostDB,
+		auth: middleware.NewAuthMiddleware(cfg.Tokens).
+			WithAdminTokens(cfg.AdminTokens).
+			WithHostIdentityRoutes("PostStats").
+			WithPublicRoutes(controller.HealthRoutes...).
+			WithTokenNames(cfg.TokenNames),
+		rateLimit:    newRateLimitMiddleware(cfg.RateLimit),
+		ipRateLimit:  newIPRateLimitMiddleware(cfg.RateLimit),
+		accessLog:    newAccessLogMiddleware(cfg),
+		certs:        certs,
+		auditLog:     auditLog,
+		tracer:       tracer,
+		metrics:      selfMetrics,
+		health:       controller.NewHealthRouter(hostDB),
+		inFlight:     middleware.NewInFlightMiddleware(),
+		drained:      make(chan struct{}),
+		retentionJob: retention.NewJob(hostDB, cfg.Retention),
+	}
+	if tracer != nil {
+		s.tracing = middleware.NewTracingMiddleware(tracer)
+	}
+	if cfg.Signing.Enabled() {
+		s.verifier = signature.NewVerifier([]byte(cfg.Signing.Secret)).WithMaxSkew(cfg.Signing.MaxSkew)
+	}
+
+	s.httpServer = &http.Server{
+		Handler:      s.newRouter(),
+		TLSConfig:    tlsConfig,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	listeners, err := openListeners(cfg.Config)
+	if err != nil {
+		return nil, err
+	}
+	s.listeners = listeners
+
+	if cfg.Metrics.Listen != "" {
+		if s.metricsListener, err = net.Listen("tcp", cfg.Metrics.Listen); err != nil {
+			closeListeners(listeners)
+			return nil, fmt.Errorf("server: Could not listen for the metrics on %s: %w", cfg.Metrics.Listen, err)
+		}
+		s.metricsServer = &http.Server{
+			Handler:      s.newMetricsRouter(),
+			WriteTimeout: 15 * time.Second,
+			ReadTimeout:  15 * time.Second,
+		}
+	}
+
+	return s, nil
+}
+
+// NewHostDB creates the db backend from the config.
+func NewHostDB(cfg config.DB) (db.HostDB, error) {
+	switch cfg.Backend {
+	case "memory":
+		return db.NewInMemoryDB(), nil
+	case "bolt":
+		return db.NewBoltDB(cfg.Path)
+	default:
+		return nil, fmt.Errorf("%w: '%s'", config.ErrUnknownDBBackend, cfg.Backend)
+	}
+}
+
+// newAccessLogMiddleware builds the access log middleware from the config.
+func newAccessLogMiddleware(cfg Config) *middleware.AccessLogMiddleware {
+	al := middleware.NewAccessLogMiddleware(middleware.AccessLogFormat(cfg.Log.Access))
+	if cfg.AccessLog != nil {
+		al.WithWriter(cfg.AccessLog)
+	}
+	return al
+}
+
+// ingestRoutes are the routes limited by the ingest limit instead of the read limit.
+var ingestRoutes = []string{"PostStats", "PostHostEvent", "PostEvent"}
+
+// newRateLimitMiddleware builds the rate limit middleware from the config.
+func newRateLimitMiddleware(cfg config.RateLimit) *middleware.RateLimitMiddleware {
+	rl := middleware.NewRateLimitMiddleware(middleware.RateLimitKey(cfg.Key), toLimit(cfg.Read))
+	for route, limit := range routeLimits(cfg) {
+		rl.WithRouteLimit(route, limit)
+	}
+	return rl
+}
+
+// newIPRateLimitMiddleware builds the rate limit middleware for all requests of an ip from the config.
+func newIPRateLimitMiddleware(cfg config.RateLimit) *middleware.RateLimitMiddleware {
+	rl := middleware.NewRateLimitMiddleware(middleware.KeyByIP, toLimit(cfg.IP))
+	for route, limit := range healthLimits() {
+		rl.WithRouteLimit(route, limit)
+	}
+	return rl
+}
+
+// routeLimits returns the limit for every ingest route and no limit for the probes of the health routes.
+func routeLimits(cfg config.RateLimit) map[string]middleware.Limit {
+	limits := make(map[string]middleware.Limit, len(ingestRoutes)+len(controller.HealthRoutes))
+	for _, route := range ingestRoutes {
+		limits[route] = toLimit(cfg.Ingest)
+	}
+	for route, limit := range healthLimits() {
+		limits[route] = limit
+	}
+	return limits
+}
+
+// healthLimits returns no limit for the probes of the health routes.
+func healthLimits() map[string]middleware.Limit {
+	limits := make(map[string]middleware.Limit, len(controller.HealthRoutes))
+	for _, route := range controller.HealthRoutes {
+		limits[route] = middleware.Limit{}
+	}
+	return limits
+}
+
+func toLimit(limit config.Limit) middleware.Limit {
+	return middleware.Limit{Rate: limit.Rate, Burst: limit.Burst}
+}
+
+// adminRoutes are the routes that get recorded as administration in the audit log.
+var adminRoutes = []string{"MergeHost", "PostBackup", "GetVars", "GetMetrics", "GetAuditLog"}
+
+// newRouter registers all controllers and middlewares.
+func (s *Server) newRouter() *mux.Router {
+	adminRouter := controller.NewAdminRouter(s.hostDB).WithMetrics(s.metrics.Handler())
+	if s.auditLog != nil {
+		adminRouter.WithAuditLog(s.auditLog)
+	}
+	controllers := []controller.Router{
+		s.health,
+		controller.NewHostsRouter(s.hostDB),
+		controller.NewProcessesRouter(s.hostDB),
+		controller.NewEventsRouter(s.hostDB),
+		adminRouter,
+	}
+
+	router := mux.NewRouter()
+	for _, controller := range controllers {
+		subrouter := router.PathPrefix(controller.GetPrefix()).Name(controller.GetRouteName()).Subrouter()
+		controller.Register(subrouter)
+	}
+
+	// Add default middlewares
+	router.Use(s.inFlight.InFlightHandler)
+	router.Use(middleware.RequestIDHandler)
+	if s.tracing != nil {
+		router.Use(s.tracing.TracingHandler)
+	}
+	router.Use(middleware.NewMetricsMiddleware(s.metrics).MetricsHandler)
+	router.Use(middleware.RequestTimeLoggingHandler)
+	router.Use(s.accessLog.AccessLogHandler)
+	if s.auditLog != nil {
+		router.Use(middleware.NewAuditMiddleware(s.auditLog).WithAdminRoutes(adminRoutes...).WithPublicRoutes(controller.HealthRoutes...).AuditHandler)
+	}
+	router.Use(middleware.PanicRecoverHandler)
+	// the rate limits run before the auth to also throttle clients that try tokens
+	router.Use(s.traced("ipRateLimit", s.ipRateLimit.RateLimitHandler))
+	router.Use(s.traced("rateLimit", s.rateLimit.RateLimitHandler))
+	router.Use(s.traced("auth", s.auth.AuthHandler))
+	if s.verifier != nil {
+		router.Use(s.traced("signature", middleware.NewSignatureMiddleware(s.verifier, "PostStats").SignatureHandler))
+	}
+
+	return router
+}
+
+// newMetricsRouter serves the metrics without authentication.
+// The expvar variables are not served because they contain the command line with the tokens.
+// Their counters are part of the metrics.
+func (s *Server) newMetricsRouter() *mux.Router {
+	router := mux.NewRouter()
+	router.Use(s.inFlight.InFlightHandler)
+	router.Handle("/metrics", s.metrics.Handler()).Methods(http.MethodGet)
+	return router
+}
+
+// traced records the middleware as span if the tracing is enabled.
+func (s *Server) traced(name string, mw mux.MiddlewareFunc) mux.MiddlewareFunc {
+	if s.tracing == nil {
+		return mw
+	}
+	return s.tracing.Traced(name, mw)
+}
+
+// Addr returns the address of the first listener of the server.
+func (s *Server) Addr() net.Addr {
+	return s.listeners[0].Addr()
+}
+
+// Addrs returns the addresses of all listeners of the server.
+func (s *Server) Addrs() []net.Addr {
+	addrs := make([]net.Addr, 0, len(s.listeners))
+	for _, listener := range s.listeners {
+		addrs = append(addrs, listener.Addr())
+	}
+	return addrs
+}
+
+// MetricsAddr returns the address of the metrics listener or nil if it is not configured.
+func (s *Server) MetricsAddr() net.Addr {
+	if s.metricsListener == nil {
+		return nil
+	}
+	return s.metricsListener.Addr()
+}
+
+// HostDB returns the storage of the server.
+func (s *Server) HostDB() db.HostDB {
+	return s.hostDB
+}
+
+// Run serves the HTTP requests on all listeners and runs the background jobs until the context is done or the server got shut down.
+// The shutdown stops accepting new requests and drains the running ones, stops the background jobs
+// and then flushes and closes the db, the audit log and the tracing.
+// If one listener fails the others get shut down the same way.
+func (s *Server) Run(ctx context.Context) error {
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	jobs := s.startJobs(jobsCtx)
+
+	serveErr := make(chan error, len(s.listeners))
+	var serving sync.WaitGroup
+	for _, listener := range s.listeners {
+		serving.Add(1)
+		go func(listener net.Listener) {
+			defer serving.Done()
+			serveErr <- s.serve(listener)
+		}(listener)
+	}
+	if s.metricsServer != nil {
+		go s.serveMetrics()
+	}
+	if err := systemd.Notify(systemd.Ready); err != nil {
+		logPackage.Warn(err)
+	}
+
+	var err error
+	select {
+	case err = <-serveErr:
+		if err == nil {
+			// the server got shut down with Shutdown which is still draining the running requests
+			<-s.drained
+		} else {
+			s.drain()
+		}
+	case <-ctx.Done():
+		err = s.drain()
+	}
+	serving.Wait()
+
+	// the interrupted requests and the background jobs must not use the closed db
+	stopped := s.stopWork(cancelJobs, jobs)
+	if !stopped {
+		logPackage.Error("The db is not closed because it is still in use")
+		if err == nil {
+			err = ErrDBInUse
+		}
+	} else if closeErr := s.closeHostDB(); err == nil {
+		err = closeErr
+	}
+	s.closeAuditLog()
+	s.shutdownTracing()
+	return err
+}
+
+// drain shuts the server down with the readiness delay and the drain timeout.
+func (s *Server) drain() error {
+	shutdown := s.config().Shutdown
+	ctx, cancel := context.WithTimeout(context.Background(), shutdown.ReadinessDelay+shutdown.DrainTimeout)
+	defer cancel()
+	return s.Shutdown(ctx)
+}
+
+// startJobs runs the background jobs until the context is done.
+func (s *Server) startJobs(ctx context.Context) *sync.WaitGroup {
+	jobs := &sync.WaitGroup{}
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		s.retentionJob.Run(ctx)
+	}()
+	if s.certs != nil {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			s.certs.Watch(ctx, certCheckInterval)
+		}()
+	}
+	return jobs
+}
+
+// stopWork waits for the handlers of the interrupted requests, cancels the background jobs and waits until they stopped.
+// Returns false if they did not stop within the jobs timeout.
+func (s *Server) stopWork(cancelJobs context.CancelFunc, jobs *sync.WaitGroup) bool {
+	logPackage.Info("Stopping the background jobs...")
+	cancelJobs()
+	timeout := s.config().Shutdown.JobsTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := s.inFlight.Wait(ctx); err != nil {
+		logPackage.Warnf("The interrupted requests did not stop within %v", timeout)
+		return false
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return true
+	case <-ctx.Done():
+		logPackage.Warnf("The background jobs did not stop within %v", timeout)
+		return false
+	}
+}
+
+// serve the HTTP requests on the listener.
+// Returns nil if the server got shut down.
+func (s *Server) serve(listener net.Listener) error {
+	var err error
+	if s.config().TLS.Enabled() {
+		logPackage.Infof("The HTTP server is running: %s\n", listenerURL("https", listener))
+		// the certificate is provided by the TLS config
+		err = s.httpServer.ServeTLS(listener, "", "")
+	} else {
+		logPackage.Infof("The HTTP server is running: %s\n", listenerURL("http", listener))
+		err = s.httpServer.Serve(listener)
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return fmt.Errorf("server: An unexpected error happend while serving on %s: %w", listener.Addr(), err)
+}
+
+// serveMetrics serves the metrics on their own listener.
+// The server keeps running without the metrics if they fail.
+func (s *Server) serveMetrics() {
+	logPackage.Infof("The metrics are served on: http://%s/metrics\n", s.MetricsAddr())
+	err := s.metricsServer.Serve(s.metricsListener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logPackage.Errorf("An unexpected error happend while serving the metrics: %v", err)
+	}
+}
+
+// closeHostDB flushes and closes the db.
+func (s *Server) closeHostDB() error {
+	logPackage.Info("Closing the db...")
+	if err := s.hostDB.Close(); err != nil {
+		return fmt.Errorf("server: Could not close the db: %w", err)
+	}
+	return nil
+}
+
+// closeAuditLog closes the file of the audit log if it is enabled.
+func (s *Server) closeAuditLog() {
+	if s.auditLog == nil {
+		return
+	}
+	if err := s.auditLog.Close(); err != nil {
+		logPackage.Errorf("Could not close the audit log: %v", err)
+	}
+}
+
+// shutdownTracing exports the remaining spans if the tracing is enabled.
+func (s *Server) shutdownTracing() {
+	if s.tracer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+	defer cancel()
+	if err := s.tracer.Shutdown(ctx); err != nil {
+		logPackage.Errorf("Could not export the remaining spans: %v", err)
+	}
+}
+
+// Shutdown marks the server as not ready, waits the readiness delay, stops accepting new requests
+// and waits until the running requests are finished.
+// The requests that are still running when the context is done get interrupted.
+// Run stops the background jobs and closes the db afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	defer s.drainedOnce.Do(func() { close(s.drained) })
+
+	logPackage.Info("Shutting down the server and draining the running requests...")
+	if err := systemd.Notify(systemd.Stopping); err != nil {
+		logPackage.Warn(err)
+	}
+	s.health.SetShuttingDown()
+	if delay := s.config().Shutdown.ReadinessDelay; delay > 0 {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+		}
+	}
+	err := s.httpServer.Shutdown(ctx)
+	if err != nil {
+		s.httpServer.Close()
+		err = fmt.Errorf("server: The running requests did not finish in time: %w", err)
+	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
+	return err
+}
+
+// Reload applies the tokens and their names, the access log format, the rate limits, the retention and the shutdown timeouts
+// of the config to the running server and reloads the TLS certificate from its files.
+// The config is kept to only warn once about changes that need a restart.
+// Returns an error without changing anything if the config is not valid.
+func (s *Server) Reload(cfg config.Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if s.certs != nil {
+		if err := s.certs.Reload(); err != nil {
+			return err
+		}
+	}
+
+	s.cfgM.Lock()
+	defer s.cfgM.Unlock()
+
+	s.auth.SetTokens(cfg.Tokens, cfg.AdminTokens)
+	s.auth.SetTokenNames(cfg.TokenNames)
+	s.accessLog.SetFormat(middleware.AccessLogFormat(cfg.Log.Access))
+	s.retentionJob.SetRetention(cfg.Retention)
+	s.rateLimit.SetLimits(middleware.RateLimitKey(cfg.RateLimit.Key), toLimit(cfg.RateLimit.Read), routeLimits(cfg.RateLimit))
+	s.ipRateLimit.SetLimits(middleware.KeyByIP, toLimit(cfg.RateLimit.IP), healthLimits())
+	if s.verifier != nil && cfg.Signing.Enabled() {
+		s.verifier.SetSecret([]byte(cfg.Signing.Secret))
+		s.verifier.WithMaxSkew(cfg.Signing.MaxSkew)
+	}
+	if cfg.Port != s.cfg.Port || !reflect.DeepEqual(cfg.Listen, s.cfg.Listen) || cfg.UnixSocket != s.cfg.UnixSocket || cfg.DB != s.cfg.DB || cfg.TLS != s.cfg.TLS || cfg.Audit != s.cfg.Audit || cfg.Tracing != s.cfg.Tracing || cfg.Metrics != s.cfg.Metrics ||
+		cfg.Signing.Enabled() != s.cfg.Signing.Enabled() {
+		logPackage.Warn("Changes to the port, listen addresses, unix socket, db, TLS, audit, tracing or metrics config and enabling or disabling signatures need a restart to be applied")
+	}
+	s.cfg.Config = cfg
+	return nil
+}
+
+// config returns the config of the last Reload or the one the server got built with.
+func (s *Server) config() Config {
+	s.cfgM.RLock()
+	defer s.cfgM.RUnlock()
+
+	return s.cfg
+}
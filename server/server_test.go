@@ -0,0 +1,712 @@
+package server_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/audit"
+	"github.com/hamburghammer/gsave/backup"
+	"github.com/hamburghammer/gsave/config"
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/server"
+	"github.com/hamburghammer/gsave/signature"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/require"
+)
+
+// startServer starts a server on a random port and stops it at the end of the test.
+func startServer(t *testing.T, cfg server.Config) (*server.Server, string) {
+	srv, err := server.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		require.NoError(t, <-done)
+	})
+
+	return srv, fmt.Sprintf("http://%s", srv.Addr())
+}
+
+func testConfig() server.Config {
+	cfg := config.Default()
+	cfg.Port = 0
+	cfg.Tokens = []string{"foo"}
+	cfg.AdminTokens = []string{"admin"}
+	return server.Config{Config: cfg}
+}
+
+func doRequest(t *testing.T, method, url, token string, body interface{}) *http.Response {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Token", token)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestServer(t *testing.T) {
+	t.Run("stores and returns stats", func(t *testing.T) {
+		_, url := startServer(t, testConfig())
+
+		stats := db.Stats{Hostname: "foo", Date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), CPU: 1}
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", stats)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var got []db.Stats
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+		require.Equal(t, []db.Stats{stats}, got)
+	})
+
+	t.Run("dates stats without a date with the time they were received", func(t *testing.T) {
+		_, url := startServer(t, testConfig())
+
+		before := time.Now()
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{Hostname: "foo", CPU: 1})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		var got []db.Stats
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&got))
+		require.Len(t, got, 1)
+		require.WithinDuration(t, before, got[0].Date, time.Minute)
+	})
+
+	t.Run("returns the request ID", func(t *testing.T) {
+		_, url := startServer(t, testConfig())
+
+		req, err := http.NewRequest(http.MethodGet, url+"/hosts", nil)
+		require.NoError(t, err)
+		req.Header.Set("Token", "foo")
+		req.Header.Set("X-Request-ID", "abc-123")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+
+		require.Equal(t, "abc-123", res.Header.Get("X-Request-ID"))
+	})
+
+	t.Run("serves the probes without a token", func(t *testing.T) {
+		_, url := startServer(t, testConfig())
+
+		for _, path := range []string{"/healthz", "/readyz", "/version"} {
+			res := doRequest(t, http.MethodGet, url+path, "", nil)
+			require.Equal(t, http.StatusOK, res.StatusCode, path)
+		}
+
+		res := doRequest(t, http.MethodGet, url+"/hosts", "", nil)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("requires a valid token", func(t *testing.T) {
+		_, url := startServer(t, testConfig())
+
+		res := doRequest(t, http.MethodGet, url+"/hosts", "bar", nil)
+
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("requires signed stats if a signing secret is set", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Signing.Secret = "secret"
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{Hostname: "foo"})
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		req, err := http.NewRequest(http.MethodPost, url+"/hosts/foo/stats", strings.NewReader(`{"Hostname":"foo"}`))
+		require.NoError(t, err)
+		req.Header.Set("Token", "foo")
+		require.NoError(t, signature.Sign(req, []byte("secret")))
+		res, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		// replaying the same request gets rejected
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"Hostname":"foo"}`))
+		res, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("throttles clients over their limit", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.RateLimit.Ingest = config.Limit{Rate: 0.01, Burst: 1}
+		srv, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		res = doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		require.Equal(t, "100", res.Header.Get("Retry-After"))
+
+		// reads have their own limit
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/admin/vars", "admin", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var vars struct {
+			ThrottledRequests map[string]int `json:"throttledRequests"`
+		}
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&vars))
+		require.GreaterOrEqual(t, vars.ThrottledRequests["PostStats"], 1)
+
+		reloaded := testConfig().Config
+		require.NoError(t, srv.Reload(reloaded))
+		res = doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	})
+
+	t.Run("writes the access log as raw lines", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Log.Access = "common"
+		var out syncBuffer
+		cfg.AccessLog = &out
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodGet, url+"/version", "", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		require.Eventually(t, func() bool { return out.String() != "" }, time.Second, 10*time.Millisecond)
+		require.Regexp(t, `^\S+ - - \[.+\] "GET /version HTTP/1\.1" 200 \d+\n$`, out.String())
+	})
+
+	t.Run("throttles clients that try tokens before the authentication", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.RateLimit.IP = config.Limit{Rate: 0.01, Burst: 2}
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "bar", nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "baz", nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/hosts/foo/stats", "foo", nil)
+		require.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+
+		// the probes are never throttled
+		res = doRequest(t, http.MethodGet, url+"/healthz", "", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("records the requests in the audit log", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Audit.Path = filepath.Join(t.TempDir(), "audit.log")
+		cfg.TokenNames = map[string]string{"agents": "foo"}
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		res = doRequest(t, http.MethodGet, url+"/hosts", "bar", nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/admin/audit", "admin", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var entries []audit.Entry
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&entries))
+		require.Len(t, entries, 2)
+		require.Equal(t, "", entries[0].Principal)
+		require.Equal(t, http.StatusUnauthorized, entries[0].Status)
+		require.Equal(t, "agents", entries[1].Principal)
+		require.Equal(t, audit.ActionWrite, entries[1].Action)
+		require.Equal(t, "PostStats", entries[1].Route)
+		require.Equal(t, "foo", entries[1].Hostname)
+
+		content, err := ioutil.ReadFile(cfg.Audit.Path)
+		require.NoError(t, err)
+		require.NotContains(t, string(content), "bar")
+	})
+
+	t.Run("exports the spans of the requests and the db", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Tracing.Exporter = "stdout"
+		cfg.Tracing.Path = filepath.Join(t.TempDir(), "spans.json")
+		srv, err := server.New(cfg)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/hosts/foo/stats", srv.Addr()), strings.NewReader(`{}`))
+		require.NoError(t, err)
+		req.Header.Set("Token", "foo")
+		req.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		// the spans are flushed when the server stops
+		cancel()
+		require.NoError(t, <-done)
+
+		content, err := ioutil.ReadFile(cfg.Tracing.Path)
+		require.NoError(t, err)
+		for _, name := range []string{`"PostStats"`, `"middleware.auth"`, `"db.InsertStats"`, "4bf92f3577b34da6a3ce929d0e0e4736"} {
+			require.Contains(t, string(content), name)
+		}
+	})
+
+	t.Run("serves the metrics for admins and on the metrics listener", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Metrics.Listen = "127.0.0.1:0"
+		srv, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		res = doRequest(t, http.MethodGet, url+"/hosts", "bar", nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, url+"/admin/metrics", "foo", nil)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+		res = doRequest(t, http.MethodGet, url+"/admin/metrics", "admin", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		res = doRequest(t, http.MethodGet, fmt.Sprintf("http://%s/metrics", srv.MetricsAddr()), "", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		content, err := ioutil.ReadAll(res.Body)
+		require.NoError(t, err)
+		for _, metric := range []string{
+			`gsave_http_requests_total{code="201",method="POST",route="PostStats"} 1`,
+			`gsave_db_operation_duration_seconds_count{operation="InsertStats"} 1`,
+			`gsave_host_data_points{hostname="foo"} 1`,
+			"gsave_inserted_stats_total 1",
+			"gsave_memory_db_bytes",
+			`gsave_auth_failures_total{reason="invalidToken"}`,
+		} {
+			require.Contains(t, string(content), metric)
+		}
+
+		// the expvar variables contain the command line with the tokens
+		res = doRequest(t, http.MethodGet, fmt.Sprintf("http://%s/debug/vars", srv.MetricsAddr()), "", nil)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("requires an admin token to delete a host", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.HostDB = db.NewInMemoryDB()
+		cfg.HostDB.InsertStats("foo", db.Stats{})
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodDelete, url+"/hosts/foo", "foo", nil)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res = doRequest(t, http.MethodDelete, url+"/hosts/foo", "admin", nil)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+	})
+
+	t.Run("creates a backup that can be restored", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.HostDB = db.NewInMemoryDB()
+		date := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		cfg.HostDB.InsertStats("foo", db.Stats{Hostname: "foo", Date: date, CPU: 1})
+		_, url := startServer(t, cfg)
+
+		res := doRequest(t, http.MethodPost, url+"/admin/backup", "foo", nil)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res = doRequest(t, http.MethodPost, url+"/admin/backup", "admin", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		snapshot, err := backup.Read(res.Body)
+		require.NoError(t, err)
+		restoredDB := db.NewInMemoryDB()
+		require.NoError(t, restoredDB.Restore(snapshot))
+
+		got, err := restoredDB.GetStatsByHostname("foo", db.Pagination{Skip: 0, Limit: 10})
+		require.NoError(t, err)
+		require.Equal(t, []db.Stats{{Hostname: "foo", Date: date, CPU: 1}}, got)
+	})
+
+	t.Run("applies reloaded tokens", func(t *testing.T) {
+		srv, url := startServer(t, testConfig())
+
+		cfg := testConfig().Config
+		cfg.Tokens = []string{"bar"}
+		require.NoError(t, srv.Reload(cfg))
+
+		res := doRequest(t, http.MethodGet, url+"/hosts", "foo", nil)
+		require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("warns only once about a change that needs a restart", func(t *testing.T) {
+		srv, _ := startServer(t, testConfig())
+		hook := test.NewGlobal()
+		t.Cleanup(hook.Reset)
+
+		cfg := testConfig().Config
+		cfg.Retention = time.Hour
+		require.NoError(t, srv.Reload(cfg))
+		require.Empty(t, hook.AllEntries())
+
+		cfg.DB.Path = "other.db"
+		require.NoError(t, srv.Reload(cfg))
+		require.Len(t, hook.AllEntries(), 1)
+		require.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+
+		require.NoError(t, srv.Reload(cfg))
+		require.Len(t, hook.AllEntries(), 1)
+	})
+
+	t.Run("rejects an invalid reload", func(t *testing.T) {
+		srv, url := startServer(t, testConfig())
+
+		cfg := testConfig().Config
+		cfg.Tokens = []string{}
+		require.Error(t, srv.Reload(cfg))
+
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	})
+
+	t.Run("stops on shutdown", func(t *testing.T) {
+		srv, err := server.New(testConfig())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(context.Background())
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		require.NoError(t, srv.Shutdown(ctx))
+		require.NoError(t, <-done)
+	})
+}
+
+// blockingDB blocks every insert until it gets released and records the order of the inserts and the close.
+type blockingDB struct {
+	db.HostDB
+	inserting chan struct{}
+	release   chan struct{}
+	events    chan string
+}
+
+func newBlockingDB() *blockingDB {
+	return &blockingDB{
+		HostDB:    db.NewInMemoryDB(),
+		inserting: make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		events:    make(chan string, 2),
+	}
+}
+
+func (b *blockingDB) InsertStats(hostname string, stats db.Stats) error {
+	b.inserting <- struct{}{}
+	<-b.release
+	b.events <- "insert"
+	return b.HostDB.InsertStats(hostname, stats)
+}
+
+func (b *blockingDB) Close() error {
+	b.events <- "close"
+	return b.HostDB.Close()
+}
+
+func TestServer_Run_Shutdown(t *testing.T) {
+	// run starts the server with the db and posts stats until the insert blocks.
+	run := func(t *testing.T, cfg server.Config) (context.CancelFunc, chan error, chan *http.Response, string) {
+		srv, err := server.New(cfg)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+
+		url := fmt.Sprintf("http://%s", srv.Addr())
+		responses := make(chan *http.Response, 1)
+		go func() {
+			req, _ := http.NewRequest(http.MethodPost, url+"/hosts/foo/stats", strings.NewReader(`{}`))
+			req.Header.Set("Token", "foo")
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				responses <- nil
+				return
+			}
+			res.Body.Close()
+			responses <- res
+		}()
+		<-cfg.HostDB.(*blockingDB).inserting
+		return cancel, done, responses, url
+	}
+
+	t.Run("drains the running requests before closing the db", func(t *testing.T) {
+		hostDB := newBlockingDB()
+		cfg := testConfig()
+		cfg.HostDB = hostDB
+		cancel, done, responses, url := run(t, cfg)
+
+		cancel()
+		// new connections are not accepted anymore
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		require.Eventually(t, func() bool {
+			res, err := client.Get(url + "/healthz")
+			if err == nil {
+				res.Body.Close()
+			}
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+		select {
+		case <-done:
+			t.Fatal("the server stopped before the running request finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(hostDB.release)
+		res := <-responses
+		require.NotNil(t, res)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+		require.NoError(t, <-done)
+		require.Equal(t, "insert", <-hostDB.events)
+		require.Equal(t, "close", <-hostDB.events)
+	})
+
+	t.Run("fails the readiness before it stops accepting new requests", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Shutdown.ReadinessDelay = 500 * time.Millisecond
+		srv, err := server.New(cfg)
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+		url := fmt.Sprintf("http://%s", srv.Addr())
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		require.Eventually(t, func() bool {
+			res, err := client.Get(url + "/readyz")
+			if err != nil {
+				return false
+			}
+			res.Body.Close()
+			return res.StatusCode == http.StatusOK
+		}, time.Second, 10*time.Millisecond)
+
+		cancel()
+		require.Eventually(t, func() bool {
+			res, err := client.Get(url + "/readyz")
+			require.NoError(t, err, "the server stopped accepting requests before the readiness failed")
+			res.Body.Close()
+			return res.StatusCode == http.StatusServiceUnavailable
+		}, time.Second, 10*time.Millisecond)
+		require.NoError(t, <-done)
+		_, err = client.Get(url + "/readyz")
+		require.Error(t, err)
+	})
+
+	t.Run("waits for the interrupted requests before closing the db", func(t *testing.T) {
+		hostDB := newBlockingDB()
+		cfg := testConfig()
+		cfg.HostDB = hostDB
+		cfg.Shutdown.DrainTimeout = 50 * time.Millisecond
+		cancel, done, responses, _ := run(t, cfg)
+
+		cancel()
+		// the connection gets closed after the drain timeout
+		require.Nil(t, <-responses)
+		select {
+		case <-done:
+			t.Fatal("the server stopped before the interrupted request finished")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		close(hostDB.release)
+		require.ErrorIs(t, <-done, context.DeadlineExceeded)
+		require.Equal(t, "insert", <-hostDB.events)
+		require.Equal(t, "close", <-hostDB.events)
+	})
+
+	t.Run("does not close the db if the interrupted requests do not stop", func(t *testing.T) {
+		hostDB := newBlockingDB()
+		cfg := testConfig()
+		cfg.HostDB = hostDB
+		cfg.Shutdown.DrainTimeout = 50 * time.Millisecond
+		cfg.Shutdown.JobsTimeout = 50 * time.Millisecond
+		cancel, done, responses, _ := run(t, cfg)
+
+		cancel()
+
+		require.Error(t, <-done)
+		require.Nil(t, <-responses)
+		close(hostDB.release)
+		require.Equal(t, "insert", <-hostDB.events)
+		select {
+		case event := <-hostDB.events:
+			t.Fatalf("the db got used after the shutdown: %s", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+}
+
+func TestServer_Listen(t *testing.T) {
+	// unixClient sends all requests to the unix socket.
+	unixClient := func(path string) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}}
+	}
+
+	t.Run("serves on a unix socket and TCP", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gsave.sock")
+		cfg := testConfig()
+		cfg.Listen = []string{"127.0.0.1:0", "unix://" + path}
+		cfg.UnixSocket.Mode = "0600"
+		srv, url := startServer(t, cfg)
+
+		require.Len(t, srv.Addrs(), 2)
+		res := doRequest(t, http.MethodPost, url+"/hosts/foo/stats", "foo", db.Stats{})
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		req, err := http.NewRequest(http.MethodGet, "http://gsave/hosts/foo/stats", nil)
+		require.NoError(t, err)
+		req.Header.Set("Token", "foo")
+		res, err = unixClient(path).Do(req)
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("replaces a stale unix socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gsave.sock")
+		stale, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		// keep the file like a killed process
+		stale.(*net.UnixListener).SetUnlinkOnClose(false)
+		stale.Close()
+		cfg := testConfig()
+		cfg.Listen = []string{"unix://" + path}
+		startServer(t, cfg)
+
+		res, err := unixClient(path).Get("http://gsave/healthz")
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	})
+
+	t.Run("rejects a unix socket of a running server", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "gsave.sock")
+		cfg := testConfig()
+		cfg.Listen = []string{"unix://" + path}
+		startServer(t, cfg)
+
+		_, err := server.New(cfg)
+
+		require.ErrorIs(t, err, server.ErrSocketInUse)
+	})
+
+	t.Run("notifies systemd when it is ready and stopping", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		require.NoError(t, err)
+		defer conn.Close()
+		os.Setenv("NOTIFY_SOCKET", path)
+		defer os.Unsetenv("NOTIFY_SOCKET")
+
+		srv, err := server.New(testConfig())
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 1)
+		go func() {
+			done <- srv.Run(ctx)
+		}()
+
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "READY=1", string(buf[:n]))
+
+		cancel()
+		n, err = conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, "STOPPING=1", string(buf[:n]))
+		require.NoError(t, <-done)
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Run("rejects an invalid config", func(t *testing.T) {
+		cfg := testConfig()
+		cfg.Tokens = nil
+
+		_, err := server.New(cfg)
+
+		require.Error(t, err)
+	})
+}
+
+// syncBuffer is a bytes.Buffer that can be written by the server while the test reads it.
+type syncBuffer struct {
+	buf bytes.Buffer
+	m   sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.m.Lock()
+	defer b.m.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hamburghammer/gsave/config"
+)
+
+// certCheckInterval is the interval in which the certificate files are checked for changes.
+const certCheckInterval = 10 * time.Second
+
+// newTLSConfig builds the TLS config with a reloadable certificate.
+// If a client CA is configured clients can authenticate with a certificate signed by it.
+func newTLSConfig(cfg config.TLS, certs *certReloader) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	if cfg.ClientCA == "" {
+		return tlsConfig, nil
+	}
+
+	content, err := ioutil.ReadFile(cfg.ClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("server: Could not read the client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("server: The client CA '%s' contains no PEM certificate", cfg.ClientCA)
+	}
+
+	// tokens stay valid so a client certificate is optional
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	tlsConfig.ClientCAs = pool
+	return tlsConfig, nil
+}
+
+// certReloader holds the certificate of the server and reloads it from its files.
+// It can be used while the server is running.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	cert     *tls.Certificate
+	modTime  time.Time
+	m        sync.RWMutex
+}
+
+// newCertReloader loads the certificate from the files.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cr.Reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// GetCertificate returns the current certificate for a TLS handshake.
+func (cr *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.m.RLock()
+	defer cr.m.RUnlock()
+
+	return cr.cert, nil
+}
+
+// Reload loads the certificate from the files.
+// The current certificate is kept if the files are not valid.
+func (cr *certReloader) Reload() error {
+	modTime, err := cr.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return fmt.Errorf("server: Could not load the TLS certificate: %w", err)
+	}
+
+	cr.m.Lock()
+	defer cr.m.Unlock()
+
+	cr.cert = &cert
+	cr.modTime = modTime
+	return nil
+}
+
+// Watch reloads the certificate every interval if one of the files changed until the context is done.
+func (cr *certReloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cr.reloadIfChanged(); err != nil {
+				logPackage.Errorf("The TLS certificate was not reloaded: %v", err)
+			}
+		}
+	}
+}
+
+// reloadIfChanged reloads the certificate if a file was modified since the last load.
+func (cr *certReloader) reloadIfChanged() error {
+	modTime, err := cr.lastModified()
+	if err != nil {
+		return err
+	}
+
+	cr.m.RLock()
+	changed := !modTime.Equal(cr.modTime)
+	cr.m.RUnlock()
+	if !changed {
+		return nil
+	}
+
+	if err := cr.Reload(); err != nil {
+		return err
+	}
+	logPackage.Info("The TLS certificate got reloaded")
+	return nil
+}
+
+// lastModified returns the latest modification time of the certificate and the key file.
+func (cr *certReloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("server: Could not read the TLS certificate: %w", err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
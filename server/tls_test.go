@@ -0,0 +1,180 @@
+package server_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA signs the certificates of the server and the agents inside the tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gsave test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return testCA{cert: cert, key: key}
+}
+
+func (ca testCA) pem() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+}
+
+// issue creates a certificate for the common name that is valid for servers and clients.
+func (ca testCA) issue(t *testing.T, serial int64, commonName string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.IPv6loopback},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, content []byte) string {
+	require.NoError(t, ioutil.WriteFile(path, content, 0600))
+	return path
+}
+
+// newTLSClient trusts the CA and authenticates with the client certificate if one is given.
+func newTLSClient(t *testing.T, ca testCA, certPEM, keyPEM []byte) *http.Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	tlsConfig := &tls.Config{RootCAs: pool}
+	if certPEM != nil {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		require.NoError(t, err)
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	t.Cleanup(client.CloseIdleConnections)
+	return client
+}
+
+func doTLSRequest(t *testing.T, client *http.Client, method, url, token string, body interface{}) *http.Response {
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req, err := http.NewRequest(method, url, &buf)
+	require.NoError(t, err)
+	if token != "" {
+		req.Header.Set("Token", token)
+	}
+
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { res.Body.Close() })
+	return res
+}
+
+func TestServer_TLS(t *testing.T) {
+	ca := newTestCA(t)
+	dir := t.TempDir()
+	serverCert, serverKey := ca.issue(t, 2, "gsave")
+
+	cfg := testConfig()
+	cfg.TLS.Cert = writeFile(t, filepath.Join(dir, "cert.pem"), serverCert)
+	cfg.TLS.Key = writeFile(t, filepath.Join(dir, "key.pem"), serverKey)
+	cfg.TLS.ClientCA = writeFile(t, filepath.Join(dir, "ca.pem"), ca.pem())
+
+	srv, _ := startServer(t, cfg)
+	url := fmt.Sprintf("https://127.0.0.1:%d", srv.Addr().(*net.TCPAddr).Port)
+	stats := db.Stats{Hostname: "web-1", CPU: 1}
+
+	t.Run("should serve HTTPS with a token", func(t *testing.T) {
+		client := newTLSClient(t, ca, nil, nil)
+
+		res := doTLSRequest(t, client, http.MethodPost, url+"/hosts/web-1/stats", "foo", stats)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+	})
+
+	t.Run("should accept a client certificate for the own host", func(t *testing.T) {
+		agentCert, agentKey := ca.issue(t, 3, "web-1")
+		client := newTLSClient(t, ca, agentCert, agentKey)
+
+		res := doTLSRequest(t, client, http.MethodPost, url+"/hosts/web-1/stats", "", stats)
+		require.Equal(t, http.StatusCreated, res.StatusCode)
+
+		res = doTLSRequest(t, client, http.MethodPost, url+"/hosts/web-2/stats", "", stats)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+
+		res = doTLSRequest(t, client, http.MethodGet, url+"/hosts", "", nil)
+		require.Equal(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("should reject a client certificate of another CA", func(t *testing.T) {
+		otherCert, otherKey := newTestCA(t).issue(t, 4, "web-1")
+		client := newTLSClient(t, ca, otherCert, otherKey)
+
+		_, err := client.Post(url+"/hosts/web-1/stats", "application/json", nil)
+		require.Error(t, err)
+	})
+
+	t.Run("should reload the certificate", func(t *testing.T) {
+		newCert, newKey := ca.issue(t, 5, "gsave")
+		writeFile(t, cfg.TLS.Cert, newCert)
+		writeFile(t, cfg.TLS.Key, newKey)
+		require.NoError(t, srv.Reload(cfg.Config))
+
+		client := newTLSClient(t, ca, nil, nil)
+		res := doTLSRequest(t, client, http.MethodGet, url+"/hosts", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, int64(5), res.TLS.PeerCertificates[0].SerialNumber.Int64())
+	})
+
+	t.Run("should keep the certificate if the files are invalid", func(t *testing.T) {
+		writeFile(t, cfg.TLS.Key, []byte("invalid"))
+		require.Error(t, srv.Reload(cfg.Config))
+
+		client := newTLSClient(t, ca, nil, nil)
+		res := doTLSRequest(t, client, http.MethodGet, url+"/hosts", "foo", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, int64(5), res.TLS.PeerCertificates[0].SerialNumber.Int64())
+	})
+}
@@ -0,0 +1,187 @@
+// Package signature signs and verifies HTTP requests with a HMAC-SHA256 of a shared secret.
+//
+// The signature covers the method, the escaped path, a unix timestamp, a random nonce and the SHA256 of the body.
+// The timestamp limits the time a request is valid and the nonce prevents that a request is replayed inside that time.
+package signature
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The headers carrying the signature.
+const (
+	HeaderTimestamp = "X-Gsave-Timestamp"
+	HeaderNonce     = "X-Gsave-Nonce"
+	HeaderSignature = "X-Gsave-Signature"
+)
+
+// DefaultMaxSkew is the default time a signed request is valid before and after its timestamp.
+const DefaultMaxSkew = 5 * time.Minute
+
+// nonceCleanupInterval is the interval in which expired nonces get removed.
+const nonceCleanupInterval = time.Minute
+
+var (
+	// ErrMissingSignature if a header of the signature is missing.
+	ErrMissingSignature = errors.New("signature: The request is not signed")
+	// ErrInvalidSignature if the signature does not match the request.
+	ErrInvalidSignature = errors.New("signature: The signature is not valid")
+	// ErrClockSkew if the timestamp is outside of the allowed clock skew.
+	ErrClockSkew = errors.New("signature: The timestamp is outside of the allowed clock skew")
+	// ErrReplayedNonce if the nonce was already used.
+	ErrReplayedNonce = errors.New("signature: The nonce was already used")
+)
+
+// Sign adds the signature headers to the request.
+// The body gets read and replaced so that the request can still be sent.
+func Sign(r *http.Request, secret []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("signature: Could not create a nonce: %w", err)
+	}
+
+	return sign(r, secret, time.Now(), hex.EncodeToString(nonce))
+}
+
+func sign(r *http.Request, secret []byte, now time.Time, nonce string) error {
+	bodyHash, err := hashBody(r)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, hex.EncodeToString(mac(secret, r.Method, r.URL.EscapedPath(), timestamp, nonce, bodyHash)))
+	return nil
+}
+
+// mac calculates the HMAC of the signed parts of a request.
+func mac(secret []byte, method, path, timestamp, nonce, bodyHash string) []byte {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(strings.Join([]string{method, path, timestamp, nonce, bodyHash}, "\n")))
+	return h.Sum(nil)
+}
+
+// hashBody returns the hex encoded SHA256 of the body and replaces the body to be read again.
+func hashBody(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			return "", fmt.Errorf("signature: Could not read the body: %w", err)
+		}
+		r.Body.Close()
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// NewVerifier creates a Verifier for the secret with the DefaultMaxSkew.
+func NewVerifier(secret []byte) *Verifier {
+	return &Verifier{secret: secret, maxSkew: DefaultMaxSkew, nonces: make(map[string]time.Time), now: time.Now}
+}
+
+// Verifier checks the signature of requests and remembers the used nonces.
+// It can be used concurrently.
+type Verifier struct {
+	secret  []byte
+	maxSkew time.Duration
+	// nonces holds the used nonces until the requests would be rejected by the clock skew anyway.
+	nonces      map[string]time.Time
+	lastCleanup time.Time
+	now         func() time.Time
+	m           sync.Mutex
+}
+
+// WithMaxSkew sets the time a signed request is valid before and after its timestamp.
+// Returns the Verifier.
+func (v *Verifier) WithMaxSkew(maxSkew time.Duration) *Verifier {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.maxSkew = maxSkew
+	return v
+}
+
+// SetSecret replaces the secret while the Verifier is in use.
+func (v *Verifier) SetSecret(secret []byte) {
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	v.secret = secret
+}
+
+// Verify checks the signature, the timestamp and the nonce of the request.
+// The body gets read and replaced so that it can be read again.
+func (v *Verifier) Verify(r *http.Request) error {
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: The timestamp is not a number", ErrInvalidSignature)
+	}
+	given, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: The signature is not hex encoded", ErrInvalidSignature)
+	}
+	bodyHash, err := hashBody(r)
+	if err != nil {
+		return err
+	}
+
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	if !hmac.Equal(given, mac(v.secret, r.Method, r.URL.EscapedPath(), timestamp, nonce, bodyHash)) {
+		return ErrInvalidSignature
+	}
+
+	now := v.now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return ErrClockSkew
+	}
+
+	v.forgetExpiredNonces(now)
+	if _, used := v.nonces[nonce]; used {
+		return ErrReplayedNonce
+	}
+	v.nonces[nonce] = signedAt.Add(v.maxSkew)
+	return nil
+}
+
+// forgetExpiredNonces removes the nonces of requests that are outside of the clock skew.
+// It only runs once per nonceCleanupInterval and the caller has to hold the lock.
+func (v *Verifier) forgetExpiredNonces(now time.Time) {
+	if now.Sub(v.lastCleanup) < nonceCleanupInterval {
+		return
+	}
+	v.lastCleanup = now
+
+	for nonce, expires := range v.nonces {
+		if now.After(expires) {
+			delete(v.nonces, nonce)
+		}
+	}
+}
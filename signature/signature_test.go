@@ -0,0 +1,124 @@
+package signature
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedRequest(t *testing.T, secret string, signedAt time.Time, nonce string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, "http://localhost/hosts/foo/stats", strings.NewReader(`{"CPU":1}`))
+	require.NoError(t, err)
+	require.NoError(t, sign(req, []byte(secret), signedAt, nonce))
+	return req
+}
+
+func newTestVerifier(now time.Time) *Verifier {
+	v := NewVerifier([]byte("secret"))
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func TestSign(t *testing.T) {
+	t.Run("should keep the body readable", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/hosts/foo/stats", strings.NewReader("body"))
+		require.NoError(t, err)
+
+		require.NoError(t, Sign(req, []byte("secret")))
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.Equal(t, "body", string(body))
+		require.NotEmpty(t, req.Header.Get(HeaderNonce))
+	})
+
+	t.Run("should be verified with the same secret", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/hosts/foo/stats", strings.NewReader("body"))
+		require.NoError(t, err)
+		require.NoError(t, Sign(req, []byte("secret")))
+
+		require.NoError(t, NewVerifier([]byte("secret")).Verify(req))
+
+		body, err := ioutil.ReadAll(req.Body)
+		require.NoError(t, err)
+		require.Equal(t, "body", string(body))
+	})
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+
+	t.Run("should reject an unsigned request", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost/hosts/foo/stats", nil)
+		require.NoError(t, err)
+
+		require.Equal(t, ErrMissingSignature, newTestVerifier(now).Verify(req))
+	})
+
+	t.Run("should reject another secret", func(t *testing.T) {
+		req := newSignedRequest(t, "other", now, "1")
+		require.Equal(t, ErrInvalidSignature, newTestVerifier(now).Verify(req))
+	})
+
+	t.Run("should reject a changed body", func(t *testing.T) {
+		req := newSignedRequest(t, "secret", now, "1")
+		req.Body = ioutil.NopCloser(strings.NewReader(`{"CPU":100}`))
+
+		require.Equal(t, ErrInvalidSignature, newTestVerifier(now).Verify(req))
+	})
+
+	t.Run("should reject a changed path", func(t *testing.T) {
+		req := newSignedRequest(t, "secret", now, "1")
+		req.URL.Path = "/hosts/bar/stats"
+
+		require.Equal(t, ErrInvalidSignature, newTestVerifier(now).Verify(req))
+	})
+
+	t.Run("should reject a changed timestamp", func(t *testing.T) {
+		req := newSignedRequest(t, "secret", now, "1")
+		req.Header.Set(HeaderTimestamp, "1600000001")
+
+		require.Equal(t, ErrInvalidSignature, newTestVerifier(now).Verify(req))
+	})
+
+	t.Run("should accept a timestamp inside the clock skew", func(t *testing.T) {
+		v := newTestVerifier(now)
+		require.NoError(t, v.Verify(newSignedRequest(t, "secret", now.Add(-4*time.Minute), "1")))
+		require.NoError(t, v.Verify(newSignedRequest(t, "secret", now.Add(4*time.Minute), "2")))
+	})
+
+	t.Run("should reject a timestamp outside of the clock skew", func(t *testing.T) {
+		v := newTestVerifier(now).WithMaxSkew(time.Minute)
+		require.Equal(t, ErrClockSkew, v.Verify(newSignedRequest(t, "secret", now.Add(-2*time.Minute), "1")))
+		require.Equal(t, ErrClockSkew, v.Verify(newSignedRequest(t, "secret", now.Add(2*time.Minute), "2")))
+	})
+
+	t.Run("should reject a replayed nonce", func(t *testing.T) {
+		v := newTestVerifier(now)
+		require.NoError(t, v.Verify(newSignedRequest(t, "secret", now, "1")))
+		require.Equal(t, ErrReplayedNonce, v.Verify(newSignedRequest(t, "secret", now, "1")))
+	})
+
+	t.Run("should forget the nonces outside of the clock skew", func(t *testing.T) {
+		v := newTestVerifier(now)
+		require.NoError(t, v.Verify(newSignedRequest(t, "secret", now, "1")))
+
+		later := now.Add(DefaultMaxSkew + nonceCleanupInterval)
+		v.now = func() time.Time { return later }
+		require.NoError(t, v.Verify(newSignedRequest(t, "secret", later, "2")))
+
+		require.NotContains(t, v.nonces, "1")
+		require.Contains(t, v.nonces, "2")
+	})
+
+	t.Run("should use the replaced secret", func(t *testing.T) {
+		v := newTestVerifier(now)
+		v.SetSecret([]byte("new"))
+
+		require.NoError(t, v.Verify(newSignedRequest(t, "new", now, "1")))
+	})
+}
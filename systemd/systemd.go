@@ -0,0 +1,91 @@
+// Package systemd implements the socket activation and the notifications of the systemd service manager.
+//
+// With socket activation systemd opens the sockets and passes them to the started process
+// starting at the file descriptor 3. The number of sockets is set in LISTEN_FDS for the process in LISTEN_PID.
+// A service with Type=notify tells systemd with a datagram to NOTIFY_SOCKET when it is ready or stopping.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+const (
+	// Ready tells the service manager that the startup finished and the service accepts connections.
+	Ready = "READY=1"
+	// Stopping tells the service manager that the service is shutting down.
+	Stopping = "STOPPING=1"
+)
+
+// Listeners returns the sockets passed by systemd with the socket activation.
+// Returns no listeners if the process was not activated by a socket.
+// The environment variables of the activation are removed so that they are not used twice or inherited.
+func Listeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, nil
+	}
+
+	return listenersFrom(listenFDsStart, count)
+}
+
+// listenersFrom builds the listeners of count file descriptors beginning at the first one.
+func listenersFrom(first, count int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, count)
+	for fd := first; fd < first+count; fd++ {
+		syscall.CloseOnExec(fd)
+		file := os.NewFile(uintptr(fd), fmt.Sprintf("LISTEN_FD_%d", fd))
+		// the listener uses a duplicate of the file descriptor
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, listener := range listeners {
+				listener.Close()
+			}
+			return nil, fmt.Errorf("systemd: The file descriptor %d is no listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	return listeners, nil
+}
+
+// Notify sends the state like Ready or Stopping to the service manager.
+// It does nothing if the service manager does not expect notifications.
+func Notify(state string) error {
+	return notify(os.Getenv("NOTIFY_SOCKET"), state)
+}
+
+func notify(socket, state string) error {
+	if socket == "" {
+		return nil
+	}
+	if socket[0] == '@' {
+		// a socket in the abstract namespace
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("systemd: Could not connect to the notify socket: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("systemd: Could not send the notification: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListeners(t *testing.T) {
+	t.Run("should ignore sockets for another process", func(t *testing.T) {
+		os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+		os.Setenv("LISTEN_FDS", "1")
+
+		listeners, err := Listeners()
+
+		require.NoError(t, err)
+		require.Empty(t, listeners)
+		require.Empty(t, os.Getenv("LISTEN_FDS"))
+	})
+
+	t.Run("should return nothing without socket activation", func(t *testing.T) {
+		listeners, err := Listeners()
+
+		require.NoError(t, err)
+		require.Empty(t, listeners)
+	})
+}
+
+func TestListenersFrom(t *testing.T) {
+	t.Run("should serve on the passed sockets", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+		file, err := listener.(*net.TCPListener).File()
+		require.NoError(t, err)
+
+		listeners, err := listenersFrom(int(file.Fd()), 1)
+
+		require.NoError(t, err)
+		require.Len(t, listeners, 1)
+		defer listeners[0].Close()
+		require.Equal(t, listener.Addr().String(), listeners[0].Addr().String())
+	})
+
+	t.Run("should reject file descriptors that are no sockets", func(t *testing.T) {
+		file, err := os.Open(os.DevNull)
+		require.NoError(t, err)
+		defer file.Close()
+
+		_, err = listenersFrom(int(file.Fd()), 1)
+
+		require.Error(t, err)
+	})
+}
+
+func TestNotify(t *testing.T) {
+	t.Run("should send the state to the socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "notify.sock")
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+		require.NoError(t, err)
+		defer conn.Close()
+
+		require.NoError(t, notify(path, Ready))
+
+		buf := make([]byte, 64)
+		n, err := conn.Read(buf)
+		require.NoError(t, err)
+		require.Equal(t, Ready, string(buf[:n]))
+	})
+
+	t.Run("should do nothing without a socket", func(t *testing.T) {
+		require.NoError(t, notify("", Ready))
+	})
+
+	t.Run("should return an error if the socket does not exist", func(t *testing.T) {
+		require.Error(t, notify(filepath.Join(t.TempDir(), "missing.sock"), Ready))
+	})
+}
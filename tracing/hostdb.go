@@ -0,0 +1,164 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"github.com/hamburghammer/gsave/db"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/hamburghammer/gsave/tracing"
+
+// The attributes of the spans.
+var (
+	// HostnameKey is the host of a call.
+	HostnameKey = attribute.Key("gsave.hostname")
+	// ResultsKey is the number of returned or deleted entries of a call.
+	ResultsKey = attribute.Key("gsave.results")
+)
+
+// NewHostDB wraps the HostDB so that every call gets recorded as span.
+// The spans are children of the span inside the context bound with WithContext.
+func NewHostDB(hostDB db.HostDB, provider trace.TracerProvider) *HostDB {
+	return &HostDB{hostDB: hostDB, tracer: provider.Tracer(tracerName), ctx: context.Background()}
+}
+
+// HostDB is a tracing decorator for any db.HostDB.
+type HostDB struct {
+	hostDB db.HostDB
+	tracer trace.Tracer
+	ctx    context.Context
+}
+
+// WithContext returns a copy of the HostDB that starts its spans inside the context.
+func (t *HostDB) WithContext(ctx context.Context) db.HostDB {
+	return &HostDB{hostDB: t.hostDB, tracer: t.tracer, ctx: ctx}
+}
+
+// start starts the span of a call.
+func (t *HostDB) start(name string, attributes ...attribute.KeyValue) trace.Span {
+	_, span := t.tracer.Start(t.ctx, "db."+name, trace.WithSpanKind(trace.SpanKindInternal), trace.WithAttributes(attributes...))
+	return span
+}
+
+// end records the error and ends the span.
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// GetHosts traces db.HostDB.GetHosts.
+func (t *HostDB) GetHosts(query db.HostQuery, pagination db.Pagination) ([]db.HostInfo, error) {
+	span := t.start("GetHosts")
+	hosts, err := t.hostDB.GetHosts(query, pagination)
+	span.SetAttributes(ResultsKey.Int(len(hosts)))
+	end(span, err)
+	return hosts, err
+}
+
+// GetHost traces db.HostDB.GetHost.
+func (t *HostDB) GetHost(hostname string) (db.HostInfo, error) {
+	span := t.start("GetHost", HostnameKey.String(hostname))
+	host, err := t.hostDB.GetHost(hostname)
+	end(span, err)
+	return host, err
+}
+
+// GetStatsByHostname traces db.HostDB.GetStatsByHostname.
+func (t *HostDB) GetStatsByHostname(hostname string, pagination db.Pagination) ([]db.Stats, error) {
+	span := t.start("GetStatsByHostname", HostnameKey.String(hostname))
+	stats, err := t.hostDB.GetStatsByHostname(hostname, pagination)
+	span.SetAttributes(ResultsKey.Int(len(stats)))
+	end(span, err)
+	return stats, err
+}
+
+// GetStatsPage traces db.HostDB.GetStatsPage.
+func (t *HostDB) GetStatsPage(hostname string, cursor db.StatsCursor, limit int) ([]db.Stats, db.StatsCursor, error) {
+	span := t.start("GetStatsPage", HostnameKey.String(hostname))
+	stats, next, err := t.hostDB.GetStatsPage(hostname, cursor, limit)
+	span.SetAttributes(ResultsKey.Int(len(stats)))
+	end(span, err)
+	return stats, next, err
+}
+
+// InsertStats traces db.HostDB.InsertStats.
+func (t *HostDB) InsertStats(hostname string, stats db.Stats) error {
+	span := t.start("InsertStats", HostnameKey.String(hostname))
+	err := t.hostDB.InsertStats(hostname, stats)
+	end(span, err)
+	return err
+}
+
+// DeleteHost traces db.HostDB.DeleteHost.
+func (t *HostDB) DeleteHost(hostname string) error {
+	span := t.start("DeleteHost", HostnameKey.String(hostname))
+	err := t.hostDB.DeleteHost(hostname)
+	end(span, err)
+	return err
+}
+
+// MergeHosts traces db.HostDB.MergeHosts.
+func (t *HostDB) MergeHosts(source, target string) error {
+	span := t.start("MergeHosts", HostnameKey.String(source), attribute.String("gsave.target", target))
+	err := t.hostDB.MergeHosts(source, target)
+	end(span, err)
+	return err
+}
+
+// DeleteStatsBefore traces db.HostDB.DeleteStatsBefore.
+func (t *HostDB) DeleteStatsBefore(date time.Time) (int, error) {
+	span := t.start("DeleteStatsBefore")
+	deleted, err := t.hostDB.DeleteStatsBefore(date)
+	span.SetAttributes(ResultsKey.Int(deleted))
+	end(span, err)
+	return deleted, err
+}
+
+// InsertEvent traces db.HostDB.InsertEvent.
+func (t *HostDB) InsertEvent(event db.Event) (db.Event, error) {
+	span := t.start("InsertEvent", HostnameKey.String(event.Hostname))
+	event, err := t.hostDB.InsertEvent(event)
+	end(span, err)
+	return event, err
+}
+
+// GetEvents traces db.HostDB.GetEvents.
+func (t *HostDB) GetEvents(filter db.EventFilter, pagination db.Pagination) ([]db.Event, error) {
+	span := t.start("GetEvents", HostnameKey.String(filter.Hostname))
+	events, err := t.hostDB.GetEvents(filter, pagination)
+	span.SetAttributes(ResultsKey.Int(len(events)))
+	end(span, err)
+	return events, err
+}
+
+// Snapshot traces db.HostDB.Snapshot.
+func (t *HostDB) Snapshot() (db.Snapshot, error) {
+	span := t.start("Snapshot")
+	snapshot, err := t.hostDB.Snapshot()
+	span.SetAttributes(attribute.Int("gsave.hosts", len(snapshot.Hosts)))
+	end(span, err)
+	return snapshot, err
+}
+
+// Restore traces db.HostDB.Restore.
+func (t *HostDB) Restore(snapshot db.Snapshot) error {
+	span := t.start("Restore", attribute.Int("gsave.hosts", len(snapshot.Hosts)))
+	err := t.hostDB.Restore(snapshot)
+	end(span, err)
+	return err
+}
+
+// Close traces db.HostDB.Close.
+func (t *HostDB) Close() error {
+	span := t.start("Close")
+	err := t.hostDB.Close()
+	end(span, err)
+	return err
+}
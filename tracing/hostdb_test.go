@@ -0,0 +1,56 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hamburghammer/gsave/db"
+	"github.com/hamburghammer/gsave/dbtest"
+	"github.com/hamburghammer/gsave/tracing"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newProvider() (*sdktrace.TracerProvider, *tracetest.SpanRecorder) {
+	recorder := tracetest.NewSpanRecorder()
+	return sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)), recorder
+}
+
+func TestHostDB_Conformance(t *testing.T) {
+	provider, _ := newProvider()
+	dbtest.RunConformance(t, func() db.HostDB {
+		return tracing.NewHostDB(db.NewInMemoryDB(), provider)
+	})
+}
+
+func TestHostDB(t *testing.T) {
+	t.Run("should record the calls as children of the bound context", func(t *testing.T) {
+		provider, recorder := newProvider()
+		ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+		hostDB := db.WithContext(ctx, tracing.NewHostDB(db.NewInMemoryDB(), provider))
+
+		require.NoError(t, hostDB.InsertStats("foo", db.Stats{}))
+		parent.End()
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 2)
+		require.Equal(t, "db.InsertStats", spans[0].Name())
+		require.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+		require.Contains(t, spans[0].Attributes(), tracing.HostnameKey.String("foo"))
+	})
+
+	t.Run("should record errors", func(t *testing.T) {
+		provider, recorder := newProvider()
+		hostDB := tracing.NewHostDB(db.NewInMemoryDB(), provider)
+
+		_, err := hostDB.GetHost("foo")
+		require.ErrorIs(t, err, db.ErrHostNotFound)
+
+		spans := recorder.Ended()
+		require.Len(t, spans, 1)
+		require.Equal(t, codes.Error, spans[0].Status().Code)
+		require.Equal(t, db.ErrHostNotFound.Error(), spans[0].Status().Description)
+	})
+}
@@ -0,0 +1,26 @@
+// Package version holds the build information of gsave.
+// Version and Commit are set at build time with:
+//
+//	go build -ldflags "-X github.com/hamburghammer/gsave/version.Version=v1.0.0 -X github.com/hamburghammer/gsave/version.Commit=$(git rev-parse HEAD)"
+package version
+
+import "runtime"
+
+var (
+	// Version of the build like a git tag.
+	Version = "dev"
+	// Commit is the git commit the build is based on.
+	Commit = "unknown"
+)
+
+// Info is the build information of the running binary.
+type Info struct {
+	Version   string
+	Commit    string
+	GoVersion string
+}
+
+// Get returns the build information.
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+}